@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"reflect"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Run -browse on a pseudo-terminal, to test that it uses raw mode and the
+// terminal size, and that it restores the terminal on exit.
+//
+// Browse always uses the controlling terminal, so this runs the test binary
+// again in a new session with the pty as the controlling terminal.
+func TestBrowsePTY(t *testing.T) {
+	if os.Getenv("ELLES_TEST_BROWSE") != "" {
+		os.Args = []string{"elles", "-browse"}
+		main()
+		os.Exit(0)
+	}
+
+	tmp := start(t)
+	mkdirAll(t, "dir")
+	touch(t, "file")
+	touch(t, "other")
+
+	ptm, pts := openPTY(t)
+	err := unix.IoctlSetWinsize(int(pts.Fd()), unix.TIOCSWINSZ, &unix.Winsize{Row: 6, Col: 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := unix.IoctlGetTermios(int(pts.Fd()), unix.TCGETS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(os.Args[0], "-test.run=^TestBrowsePTY$")
+	cmd.Env = append(os.Environ(), "ELLES_TEST_BROWSE=1", "NO_COLOR=1")
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = pts, &stdout, &stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 0}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cmd.Process.Kill() })
+
+	var (
+		mu     sync.Mutex
+		screen []byte
+	)
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, err := ptm.Read(buf)
+			mu.Lock()
+			screen = append(screen, buf[:n]...)
+			mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}()
+	waitFor := func(s string) {
+		t.Helper()
+		for end := time.Now().Add(5 * time.Second); time.Now().Before(end); time.Sleep(10 * time.Millisecond) {
+			mu.Lock()
+			ok := bytes.Contains(screen, []byte(s))
+			mu.Unlock()
+			if ok {
+				return
+			}
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		t.Fatalf("timeout waiting for %q; screen:\n%q\nstderr: %s", s, screen, stderr.String())
+	}
+
+	// The status line is on the last row of the 6-row terminal.
+	waitFor("\x1b[6;1H1/3 · ? for help")
+	// Keys are read without waiting for enter, and enter is read as \r.
+	ptm.WriteString("j")
+	waitFor("\x1b[6;1H2/3 · ? for help")
+	ptm.WriteString("j\r")
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("%s; stderr: %s", err, stderr.String())
+	}
+
+	if have, want := stdout.String(), join(tmp, "other")+"\n"; have != want {
+		t.Errorf("\nhave: %q\nwant: %q", have, want)
+	}
+	// Alternate screen and hidden cursor, and restored on exit.
+	waitFor("\x1b[?25h\x1b[?1049l")
+	mu.Lock()
+	if !bytes.HasPrefix(screen, []byte("\x1b[?1049h\x1b[?25l")) {
+		t.Errorf("not on the alternate screen:\n%q", screen)
+	}
+	mu.Unlock()
+
+	after, err := unix.IoctlGetTermios(int(pts.Fd()), unix.TCGETS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(before, after) {
+		t.Errorf("terminal settings not restored:\nbefore: %+v\nafter:  %+v", before, after)
+	}
+}
+
+func openPTY(t *testing.T) (*os.File, *os.File) {
+	t.Helper()
+	ptm, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		t.Skip(err)
+	}
+	t.Cleanup(func() { ptm.Close() })
+
+	if err := unix.IoctlSetPointerInt(int(ptm.Fd()), unix.TIOCSPTLCK, 0); err != nil {
+		t.Fatal(err)
+	}
+	n, err := unix.IoctlGetInt(int(ptm.Fd()), unix.TIOCGPTN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pts, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pts.Close() })
+	return ptm, pts
+}
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"bytes"
 	"io/fs"
 	"net"
 	"os"
 	"os/exec"
+	"regexp"
 	"runtime"
 	"strings"
 	"testing"
@@ -13,15 +15,7 @@ import (
 )
 
 func clearColors() {
-	zli.WantColor, colorLinkAsTarget = false, false
-	for _, c := range []*string{
-		&colorNormal, &colorFile, &colorDir, &colorLink, &colorPipe, &colorSocket,
-		&colorBlockDev, &colorCharDev, &colorOrphan, &colorExec, &colorDoor,
-		&colorSuid, &colorSgid, &colorSticky, &colorOtherWrite,
-		&colorOtherWriteStick, &reset,
-	} {
-		*c = ""
-	}
+	zli.WantColor = false
 }
 
 // Just print out stuff for manual verification; this is not likely to regress,
@@ -63,7 +57,7 @@ func TestDefaultColor(t *testing.T) {
 	chmod(t, 0o755|fs.ModeSticky, "sticky-dir")
 	chmod(t, 0o777|fs.ModeSticky, "sticky-dir-world")
 
-	os.Setenv("ELLES_COLORS", "gnu")
+	t.Setenv("ELLES_COLORS", "default=gnu")
 	haveGNU := mustRun(t, "-CF", "--color=always") + "\n"
 	for i, l := range strings.Split(mustRun(t, "-lF", "--color=always"), "\n") {
 		if i > 0 {
@@ -77,7 +71,7 @@ func TestDefaultColor(t *testing.T) {
 		haveGNU += f[2]
 	}
 
-	os.Setenv("ELLES_COLORS", "bsd")
+	t.Setenv("ELLES_COLORS", "default=bsd")
 	haveBSD := mustRun(t, "-CF", "--color=always") + "\n"
 	for i, l := range strings.Split(mustRun(t, "-lF", "--color=always"), "\n") {
 		if i > 0 {
@@ -152,6 +146,364 @@ func TestDefaultColor(t *testing.T) {
 	//fmt.Println(testBSD())
 }
 
+func TestGNUColors(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+
+	tests := []struct {
+		name, lsColors string
+		setup          func(t *testing.T)
+		args           []string
+		want           string
+	}{
+		{"mh not linked", "mh=44;37",
+			func(t *testing.T) { touch(t, "file") },
+			[]string{"file"},
+			"file"},
+		{"mh", "mh=44;37",
+			func(t *testing.T) { touch(t, "file1"); link(t, "file1", "file2") },
+			[]string{"file1", "file2"},
+			"<44;37>file1<0>\n<44;37>file2<0>"},
+		{"mh over ext", "mh=44;37:*.png=01;35",
+			func(t *testing.T) { touch(t, "file1"); link(t, "file1", "file2.png") },
+			[]string{"file1", "file2.png"},
+			"<44;37>file1<0>\n<44;37>file2.png<0>"},
+		{"ex over mh", "mh=44;37:*.png=01;35:ex=01;32",
+			func(t *testing.T) { touch(t, "file1"); link(t, "file1", "file2.png"); chmod(t, 0o755, "file1") },
+			[]string{"file1", "file2.png"},
+			"<01;32>file1<0>\n<01;32>file2.png<0>"},
+		{"mh disabled", "mh=00:*.png=01;35",
+			func(t *testing.T) { touch(t, "file1"); link(t, "file1", "file2.png") },
+			[]string{"file1", "file2.png"},
+			"file1\n<01;35>file2.png<0>"},
+
+		{"suffix", "*~=33:*.tar.gz=31:*.png=35",
+			func(t *testing.T) { touch(t, "a~"); touch(t, "a.tar.gz"); touch(t, "b.gz"); touch(t, "c.PNG") },
+			[]string{"a~", "a.tar.gz", "b.gz", "c.PNG"},
+			"<31>a.tar.gz<0>\n<33>a~<0>\nb.gz\n<35>c.PNG<0>"},
+		{"suffix case", "*.z=33:*.Z=31",
+			func(t *testing.T) { touch(t, "a.z"); touch(t, "a.Z") },
+			[]string{"a.z", "a.Z"},
+			"<31>a.Z<0>\n<33>a.z<0>"},
+
+		{"dir types", "di=01;34:ow=34;42:st=37;44:tw=30;42",
+			func(t *testing.T) {
+				mkdirAll(t, "d")
+				mkdirAll(t, "other-writable")
+				mkdirAll(t, "sticky")
+				mkdirAll(t, "both")
+				chmod(t, 0o777, "other-writable")
+				chmod(t, 0o755|fs.ModeSticky, "sticky")
+				chmod(t, 0o777|fs.ModeSticky, "both")
+			},
+			[]string{"-d", "d", "other-writable", "sticky", "both"},
+			"<30;42>both<0>\n<01;34>d<0>\n<34;42>other-writable<0>\n<37;44>sticky<0>"},
+		{"dir fallback", "di=01;34:ow=:st=37;44:tw=00",
+			func(t *testing.T) {
+				mkdirAll(t, "other-writable")
+				mkdirAll(t, "both")
+				chmod(t, 0o777, "other-writable")
+				chmod(t, 0o777|fs.ModeSticky, "both")
+			},
+			[]string{"-d", "other-writable", "both"},
+			"<37;44>both<0>\n<01;34>other-writable<0>"},
+
+		{"ln=target", "ln=target:di=01;34:ex=01;32:or=31",
+			func(t *testing.T) {
+				mkdirAll(t, "dir")
+				touch(t, "exec")
+				chmod(t, 0o755, "exec")
+				symlink(t, "dir", "link-dir")
+				symlink(t, "exec", "link-exec")
+				symlink(t, "orphan", "link-orphan")
+			},
+			[]string{"link-dir", "link-exec", "link-orphan"},
+			"<01;34>link-dir<0>\n<01;32>link-exec<0>\n<31>link-orphan<0>"},
+		{"ln=target without or", "ln=target",
+			func(t *testing.T) { symlink(t, "orphan", "link-orphan") },
+			[]string{"link-orphan"},
+			"link-orphan"},
+		{"or and mi", "ln=36:or=31:mi=05",
+			func(t *testing.T) { touch(t, "file"); symlink(t, "file", "link"); symlink(t, "orphan", "link-orphan") },
+			[]string{"-l", "link", "link-orphan"},
+			"<36>link<0> → file\n<31>link-orphan<0> → <05>orphan<0>"},
+		{"or without mi", "ln=36:or=31",
+			func(t *testing.T) { symlink(t, "orphan", "link-orphan") },
+			[]string{"-l", "link-orphan"},
+			"<31>link-orphan<0> → <31>orphan<0>"},
+		{"target colour", "ln=36:di=34:ex=32",
+			func(t *testing.T) {
+				mkdirAll(t, "dir")
+				touch(t, "exec")
+				chmod(t, 0o755, "exec")
+				symlink(t, "dir", "link-dir")
+				symlink(t, "exec", "link-exec")
+			},
+			[]string{"-lF", "link-dir", "link-exec"},
+			"<36>link-dir<0> → <34>dir<0>/\n<36>link-exec<0> → <32>exec<0>*"},
+
+		{"lc rc ec", `lc=\e(:rc=):ec=\e(end):di=1`,
+			func(t *testing.T) { mkdirAll(t, "dir") },
+			[]string{"-d", "dir"},
+			"\x1b(1)dir\x1b(end)"},
+		{"rs", `rs=00:di=1`,
+			func(t *testing.T) { mkdirAll(t, "dir") },
+			[]string{"-d", "dir"},
+			"<1>dir<00>"},
+		{"escapes", `lc=\x1b[:rc=\155:di=1`,
+			func(t *testing.T) { mkdirAll(t, "dir") },
+			[]string{"-d", "dir"},
+			"<1>dir<0>"},
+		{"caret escapes", `lc=^[[:di=1`,
+			func(t *testing.T) { mkdirAll(t, "dir") },
+			[]string{"-d", "dir"},
+			"<1>dir<0>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer clearColors()
+			t.Setenv("ELLES_COLORS", "")
+			t.Setenv("LS_COLORS", tt.lsColors)
+			start(t)
+			tt.setup(t)
+
+			have := mustRun(t, append([]string{"-1", "--color=always"}, tt.args...)...)
+			have = regexp.MustCompile(`\x1b\[([0-9;]*)m`).ReplaceAllString(have, "<$1>")
+			have = regexp.MustCompile(`(?m)^.*│ `).ReplaceAllString(have, "")
+			if have != tt.want {
+				t.Errorf("\nhave:\n%s\n\nwant:\n%s\n\nhave: %[1]q\nwant: %[2]q", have, tt.want)
+			}
+		})
+	}
+}
+
+func TestColorRules(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+
+	setup := func(t *testing.T) {
+		touch(t, "Makefile")
+		touch(t, "README.md")
+		touch(t, "a.go")
+		touch(t, "a_test.go")
+		touch(t, "a.tar.gz")
+		touch(t, "run.sh")
+		touch(t, "lib.sh")
+		chmod(t, 0o755, "run.sh")
+		mkdirAll(t, ".git")
+		mkdirAll(t, "Makefile.d")
+		symlink(t, "a.go", "link.go")
+	}
+	tests := []struct {
+		name, ellesColors string
+		want              string
+	}{
+		{"exact", "Makefile=33",
+			"<01;34>.git<0>\n<33>Makefile<0>\n<01;34>Makefile.d<0>\nREADME.md\na.go\na.tar.gz\na_test.go\nlib.sh\n<01;36>link.go<0>\n<01;32>run.sh<0>"},
+		{"glob", "README*=1:Makefile*=33",
+			"<01;34>.git<0>\n<33>Makefile<0>\n<01;34>Makefile.d<0>\n<1>README.md<0>\na.go\na.tar.gz\na_test.go\nlib.sh\n<01;36>link.go<0>\n<01;32>run.sh<0>"},
+		{"exact before glob", "Makefile=33:Make*=31",
+			"<01;34>.git<0>\n<33>Makefile<0>\n<01;34>Makefile.d<0>\nREADME.md\na.go\na.tar.gz\na_test.go\nlib.sh\n<01;36>link.go<0>\n<01;32>run.sh<0>"},
+		{"glob before suffix", "*.go=34:a_*=35",
+			"<01;34>.git<0>\nMakefile\n<01;34>Makefile.d<0>\nREADME.md\n<34>a.go<0>\na.tar.gz\n<35>a_test.go<0>\nlib.sh\n<01;36>link.go<0>\n<01;32>run.sh<0>"},
+		{"suffix later wins", "*.go=34:*_test.go=36:*.tar.gz=31",
+			"<01;34>.git<0>\nMakefile\n<01;34>Makefile.d<0>\nREADME.md\n<34>a.go<0>\n<31>a.tar.gz<0>\n<36>a_test.go<0>\nlib.sh\n<01;36>link.go<0>\n<01;32>run.sh<0>"},
+		{"typed", "*.sh=33:ex&*.sh=35",
+			"<01;34>.git<0>\nMakefile\n<01;34>Makefile.d<0>\nREADME.md\na.go\na.tar.gz\na_test.go\n<33>lib.sh<0>\n<01;36>link.go<0>\n<35>run.sh<0>"},
+		{"typed without pattern", "di&hidden=90",
+			"<90>.git<0>\nMakefile\n<01;34>Makefile.d<0>\nREADME.md\na.go\na.tar.gz\na_test.go\nlib.sh\n<01;36>link.go<0>\n<01;32>run.sh<0>"},
+		{"typed dir", "di&Makefile*=36",
+			"<01;34>.git<0>\nMakefile\n<36>Makefile.d<0>\nREADME.md\na.go\na.tar.gz\na_test.go\nlib.sh\n<01;36>link.go<0>\n<01;32>run.sh<0>"},
+		{"untyped not for dirs", "Makefile*=33",
+			"<01;34>.git<0>\n<33>Makefile<0>\n<01;34>Makefile.d<0>\nREADME.md\na.go\na.tar.gz\na_test.go\nlib.sh\n<01;36>link.go<0>\n<01;32>run.sh<0>"},
+		{"symlink", "*.go=34:ln&*.go=35",
+			"<01;34>.git<0>\nMakefile\n<01;34>Makefile.d<0>\nREADME.md\n<34>a.go<0>\na.tar.gz\n<34>a_test.go<0>\nlib.sh\n<35>link.go<0>\n<01;32>run.sh<0>"},
+		{"two types", "fi&ex&*=36",
+			"<01;34>.git<0>\nMakefile\n<01;34>Makefile.d<0>\nREADME.md\na.go\na.tar.gz\na_test.go\nlib.sh\n<01;36>link.go<0>\n<36>run.sh<0>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer clearColors()
+			t.Setenv("ELLES_COLORS", tt.ellesColors)
+			start(t)
+			setup(t)
+
+			have := mustRun(t, "-1a", "--color=always")
+			have = regexp.MustCompile(`\x1b\[([0-9;]*)m`).ReplaceAllString(have, "<$1>")
+			if have != tt.want {
+				t.Errorf("\nhave:\n%s\n\nwant:\n%s\n\nhave: %[1]q\nwant: %[2]q", have, tt.want)
+			}
+		})
+	}
+
+	t.Run("default", func(t *testing.T) {
+		defer clearColors()
+		t.Setenv("ELLES_COLORS", "default=gnu:Makefile=33")
+		start(t)
+		touch(t, "default")
+		touch(t, "Makefile")
+
+		have := mustRun(t, "-1", "--color=always")
+		have = regexp.MustCompile(`\x1b\[([0-9;]*)m`).ReplaceAllString(have, "<$1>")
+		if want := "<33>Makefile<0>\ndefault"; have != want {
+			t.Errorf("\nhave: %q\nwant: %q", have, want)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		for _, c := range []string{"a&b=1", "[=1", "ex&=1"} {
+			t.Run(c, func(t *testing.T) {
+				defer clearColors()
+				t.Setenv("ELLES_COLORS", c)
+				start(t)
+				mustRun(t, "--color=always")
+				if e := zli.Stderr.(*bytes.Buffer).String(); !strings.Contains(e, "ELLES_COLORS") {
+					t.Errorf("no error: %q", e)
+				}
+			})
+		}
+	})
+}
+
+func TestSniffColors(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+
+	defer clearColors()
+	t.Setenv("ELLES_COLORS", "image/*=35:*.sh=33:text/plain=2:ex&application/x-elf=31")
+	start(t)
+	echoTrunc(t, "\x89PNG\r\n\x1a\n", "logo")
+	echoTrunc(t, "#!/bin/sh\n", "install")
+	echoTrunc(t, "#!/bin/sh\n", "run.py")
+	echoTrunc(t, "\x7fELF", "prog")
+	chmod(t, 0o755, "prog")
+	echoTrunc(t, "hello\n", "notes")
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-1", "--color=always"},
+			"install\nlogo\nnotes\n<01;32>prog<0>\nrun.py"},
+		{[]string{"-1", "--color=always", "-sniff"},
+			"text/x-script.sh          <33>install<0>\n" +
+				"image/png                 <35>logo<0>\n" +
+				"text/plain; charset=utf-8 <2>notes<0>\n" +
+				"application/x-elf         <31>prog<0>\n" +
+				"text/x-script.sh          <33>run.py<0>"},
+	}
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			have := mustRun(t, tt.args...)
+			have = regexp.MustCompile(`\x1b\[([0-9;]*)m`).ReplaceAllString(have, "<$1>")
+			if have != tt.want {
+				t.Errorf("\nhave:\n%s\n\nwant:\n%s\n\nhave: %[1]q\nwant: %[2]q", have, tt.want)
+			}
+		})
+	}
+}
+
+func TestTheme(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+
+	tests := []struct {
+		ellesColors, colorfgbg, colorterm string
+		want                              string
+	}{
+		{"", "15;0", "", "<01;34>dir<0>"},
+		{"", "0;15", "", "<34>dir<0>"},
+		{"", "0;default;15", "", "<34>dir<0>"},
+		{"default=auto", "15;0", "", "<01;34>dir<0>"},
+		{"default=gnu", "0;15", "", "<01;34>dir<0>"},
+		{"default=bsd", "15;0", "", "<34>dir<0>"},
+		{"default=dark,light", "15;0", "", "<1;38;5;75>dir<0>"},
+		{"default=dark,light", "0;15", "", "<1;38;5;26>dir<0>"},
+		{"default=dark,light", "0;15", "truecolor", "<1;38;2;0;95;215>dir<0>"},
+		{"default=light:di=#ff0000;bg#000000", "", "", "<38;5;196;48;5;16>dir<0>"},
+		{"default=light:di=#ff0000;bg#000000", "", "24bit", "<38;2;255;0;0;48;2;0;0;0>dir<0>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ellesColors+"/"+tt.colorfgbg+"/"+tt.colorterm, func(t *testing.T) {
+			defer clearColors()
+			t.Setenv("ELLES_COLORS", tt.ellesColors)
+			t.Setenv("COLORFGBG", tt.colorfgbg)
+			t.Setenv("COLORTERM", tt.colorterm)
+			start(t)
+			mkdirAll(t, "dir")
+
+			have := mustRun(t, "-d", "--color=always", "dir")
+			have = regexp.MustCompile(`\x1b\[([0-9;]*)m`).ReplaceAllString(have, "<$1>")
+			if have != tt.want {
+				t.Errorf("\nhave: %q\nwant: %q", have, tt.want)
+			}
+		})
+	}
+
+	t.Run("unknown", func(t *testing.T) {
+		defer clearColors()
+		t.Setenv("ELLES_COLORS", "default=nope")
+		start(t)
+		mustRun(t, "--color=always")
+		if e := zli.Stderr.(*bytes.Buffer).String(); !strings.Contains(e, `unknown theme in ELLES_COLORS: "nope"`) {
+			t.Errorf("wrong error: %q", e)
+		}
+	})
+
+	t.Run("osc11", func(t *testing.T) {
+		tests := []struct {
+			in, want string
+		}{
+			{"", ""},
+			{"\x1b[?62;22c", ""},
+			{"\x1b]11;rgb:0000/0000/0000\x1b\\\x1b[?62;22c", "dark"},
+			{"\x1b]11;rgb:ffff/ffff/ffff\x07\x1b[?62;22c", "light"},
+			{"\x1b]11;rgb:fd/f6/e3\x1b\\", "light"},
+			{"\x1b]11;rgb:00/2b/36\x1b\\", "dark"},
+			{"\x1b]11;rgba:ffff/ffff/ffff/ffff\x1b\\", "light"},
+		}
+		for _, tt := range tests {
+			if have := parseOSC11([]byte(tt.in)); have != tt.want {
+				t.Errorf("%q\nhave: %q\nwant: %q", tt.in, have, tt.want)
+			}
+		}
+	})
+}
+
+func TestDircolors(t *testing.T) {
+	t.Run("file", func(t *testing.T) {
+		defer clearColors()
+		tmp := start(t)
+		echoTrunc(t, "DIR 01;35\n.txt 32\n", "dircolors")
+		t.Setenv("ELLES_COLORS", "")
+		t.Setenv("LS_COLORS", "")
+		t.Setenv("LSCOLORS", "")
+		t.Setenv("ELLES_DIRCOLORS", join(tmp, "dircolors"))
+		mkdirAll(t, "dir")
+		touch(t, "a.txt")
+
+		have := mustRun(t, "-1", "--color=always", "dir", "a.txt")
+		have = regexp.MustCompile(`\x1b\[([0-9;]*)m`).ReplaceAllString(have, "<$1>")
+		want := "<32>a.txt<0>\n\ndir:"
+		if have != want {
+			t.Errorf("\nhave: %q\nwant: %q", have, want)
+		}
+
+		have = mustRun(t, "-print-colors")
+		for _, w := range []string{"Colours from: ", join(tmp, "dircolors"), "di      01;35", "*.txt   32"} {
+			if !strings.Contains(have, w) {
+				t.Errorf("%q not in output:\n%s", w, have)
+			}
+		}
+	})
+}
+
 // t.Run("color-dtype-dir", func(t *testing.T) {
 // 	// Ensure "ls --color" properly colors other-writable and sticky directories.
 // 	// Before coreutils-6.2, this test would fail, coloring all three
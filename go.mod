@@ -3,12 +3,11 @@ module zgo.at/elles
 go 1.25.5
 
 require (
+	github.com/cespare/xxhash/v2 v2.3.0
+	github.com/rivo/uniseg v0.4.7
 	golang.org/x/sys v0.39.0
 	zgo.at/termtext v1.5.1-0.20240620230817-7e8a4a59650a
 	zgo.at/zli v0.0.0-20251226224229-7bb9a5cf3265
 )
 
-require (
-	github.com/rivo/uniseg v0.4.7 // indirect
-	zgo.at/runewidth v0.1.0 // indirect
-)
+require zgo.at/runewidth v0.1.0 // indirect
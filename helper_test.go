@@ -298,6 +298,18 @@ func symlink(t *testing.T, target string, link ...string) {
 	}
 }
 
+// ln
+func link(t *testing.T, target string, link ...string) {
+	t.Helper()
+	if len(link) < 1 {
+		t.Fatalf("link: link must have at least one element: %s", link)
+	}
+	err := os.Link(target, join(link...))
+	if err != nil {
+		t.Fatalf("link(%q, %q): %s", target, join(link...), err)
+	}
+}
+
 // mkfifo
 func mkfifo(t *testing.T, path ...string) {
 	t.Helper()
@@ -0,0 +1,431 @@
+package listing
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"cmp"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Get the archive entry for fi, or nil if it's not from an archive.
+func archiveEntry(fi fs.FileInfo) *archiveInfo {
+	for {
+		switch f := fi.(type) {
+		case *archiveInfo:
+			return f
+		case fileInfo:
+			fi = f.FileInfo
+		case fsInfo:
+			fi = f.FileInfo
+		case fakeFileInfo:
+			d := f.DirEntry
+			if e, ok := d.(fsEntry); ok {
+				d = e.DirEntry
+			}
+			a, _ := d.(*archiveInfo)
+			return a
+		default:
+			return nil
+		}
+	}
+}
+
+func archiveKind(p string) string {
+	p = strings.ToLower(p)
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar.bz2", ".tbz2", ".tbz", ".tar", ".zip", ".jar"} {
+		if strings.HasSuffix(p, ext) {
+			return strings.TrimPrefix(ext, ".")
+		}
+	}
+	return ""
+}
+
+// Mount the archive if p is a path inside an archive (such as "file.zip/dir",
+// or "file.zip/" for the root), or if p is an archive and self is set, so that
+// it's read with v.lstat(), v.readDir(), etc.
+//
+// Only path components with an archive extension are looked at, so nothing is
+// read for paths that can't be in an archive. If p is the archive itself and it
+// can't be read it's listed as a regular file.
+func (v *vfs) openArchive(p string, self bool) error {
+	self = self || strings.HasSuffix(p, "/") || strings.HasSuffix(p, string(filepath.Separator))
+	p = filepath.Clean(p)
+	for i := 0; i < len(p); i++ {
+		end := strings.IndexRune(p[i:], filepath.Separator)
+		if end == -1 {
+			end = len(p)
+		} else {
+			end += i
+		}
+		dir := p[:end]
+		i = end
+		if archiveKind(filepath.Base(dir)) == "" || (dir == p && !self) {
+			continue
+		}
+
+		st, err := os.Stat(dir)
+		if err != nil {
+			return nil // Reported by v.lstat().
+		}
+		if !st.Mode().IsRegular() { // Directory named "x.zip".
+			continue
+		}
+		ad, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		if _, ok := v.archives[ad]; ok {
+			return nil
+		}
+		a, err := readArchive(ad, st)
+		if err != nil {
+			if dir == p {
+				return nil
+			}
+			return fmt.Errorf("reading archive %q: %w", dir, err)
+		}
+		if v.archives == nil {
+			v.archives = make(map[string]fs.FS)
+		}
+		v.archives[ad] = a
+		return nil
+	}
+	return nil
+}
+
+// In-memory index of all the entries in an archive. This is an fs.FS, and also
+// implements fs.ReadDirFS, fs.StatFS, and fs.ReadLinkFS. Files are read from
+// the archive when opened.
+type archiveFS struct {
+	path    string                  // Absolute path to the archive.
+	entries map[string]*archiveInfo // By path inside the archive; the root is "."
+}
+
+// Archive entry; this is both a fs.FileInfo and fs.DirEntry.
+//
+// Sys() always returns nil, as the functions in os2 expect a *syscall.Stat_t
+// or similar.
+type archiveInfo struct {
+	name         string
+	size         int64
+	mode         fs.FileMode
+	mtime, atime time.Time
+	uid, gid     string // Empty if not stored (zip).
+	uname, gname string
+	link         string   // Symlink target.
+	children     []string // Names of directory entries.
+}
+
+func (a *archiveInfo) Name() string               { return a.name }
+func (a *archiveInfo) Size() int64                { return a.size }
+func (a *archiveInfo) Mode() fs.FileMode          { return a.mode }
+func (a *archiveInfo) ModTime() time.Time         { return a.mtime }
+func (a *archiveInfo) IsDir() bool                { return a.mode.IsDir() }
+func (a *archiveInfo) Sys() any                   { return nil }
+func (a *archiveInfo) Type() fs.FileMode          { return a.mode.Type() }
+func (a *archiveInfo) Info() (fs.FileInfo, error) { return a, nil }
+
+// Get the owner and group names, falling back to the IDs.
+func (a *archiveInfo) owner(asID bool) (string, string) {
+	if asID && a.uid != "" {
+		return a.uid, a.gid
+	}
+	return cmp.Or(a.uname, a.uid, "-"), cmp.Or(a.gname, a.gid, "-")
+}
+
+func readArchive(p string, st fs.FileInfo) (*archiveFS, error) {
+	a := &archiveFS{path: p, entries: make(map[string]*archiveInfo)}
+	a.entries["."] = &archiveInfo{name: filepath.Base(p), mode: fs.ModeDir | 0o755, mtime: st.ModTime()}
+
+	if kind := archiveKind(p); kind == "zip" || kind == "jar" {
+		z, err := zip.OpenReader(p)
+		if err != nil {
+			return nil, err
+		}
+		defer z.Close()
+		for _, f := range z.File {
+			ai := &archiveInfo{size: int64(f.UncompressedSize64), mode: f.Mode(), mtime: f.Modified}
+			if ai.mode&fs.ModeSymlink != 0 {
+				fp, err := f.Open()
+				if err != nil {
+					return nil, err
+				}
+				l, err := io.ReadAll(io.LimitReader(fp, 4096))
+				fp.Close()
+				if err != nil {
+					return nil, err
+				}
+				ai.link = string(l)
+			}
+			a.add(f.Name, ai)
+		}
+		return a, nil
+	}
+
+	tr, fp, err := openTar(p)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		a.add(h.Name, &archiveInfo{
+			size:  h.Size,
+			mode:  h.FileInfo().Mode(),
+			mtime: h.ModTime,
+			atime: h.AccessTime,
+			uid:   strconv.Itoa(h.Uid),
+			gid:   strconv.Itoa(h.Gid),
+			uname: h.Uname,
+			gname: h.Gname,
+			link:  h.Linkname,
+		})
+	}
+	return a, nil
+}
+
+// Open a tar archive, decompressing it if needed.
+func openTar(p string) (*tar.Reader, io.Closer, error) {
+	fp, err := os.Open(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	var r io.Reader = fp
+	switch archiveKind(p) {
+	case "tar.gz", "tgz":
+		gz, err := gzip.NewReader(fp)
+		if err != nil {
+			fp.Close()
+			return nil, nil, err
+		}
+		r = gz
+	case "tar.bz2", "tbz2", "tbz":
+		r = bzip2.NewReader(fp)
+	}
+	return tar.NewReader(r), fp, nil
+}
+
+// Get the clean path for a name in the archive; this also removes any "../".
+func cleanArchivePath(name string) string {
+	return path.Clean("/" + name)[1:]
+}
+
+// Add an entry, creating any parent directories that aren't in the archive.
+func (a *archiveFS) add(name string, ai *archiveInfo) {
+	name = cleanArchivePath(name)
+	if name == "" {
+		return
+	}
+	ai.name = path.Base(name)
+	if e, ok := a.entries[name]; ok { // Created as parent, or duplicate entry.
+		ai.children = e.children
+	} else {
+		parent := path.Dir(name)
+		if _, ok := a.entries[parent]; !ok {
+			a.add(parent, &archiveInfo{mode: fs.ModeDir | 0o755, mtime: a.entries["."].mtime})
+		}
+		a.entries[parent].children = append(a.entries[parent].children, ai.name)
+	}
+	a.entries[name] = ai
+}
+
+func (a *archiveFS) err(op, name string, err error) error {
+	return &fs.PathError{Op: op, Path: filepath.Join(a.path, filepath.FromSlash(name)), Err: err}
+}
+
+// Get the entry for name, without following symlinks.
+func (a *archiveFS) entry(op, name string) (*archiveInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, a.err(op, name, fs.ErrInvalid)
+	}
+	e, ok := a.entries[name]
+	if !ok {
+		return nil, a.err(op, name, fs.ErrNotExist)
+	}
+	return e, nil
+}
+
+func (a *archiveFS) Lstat(name string) (fs.FileInfo, error) {
+	return a.entry("lstat", name)
+}
+
+// Stat follows symlinks, as long as the target is inside the archive.
+func (a *archiveFS) Stat(name string) (fs.FileInfo, error) {
+	_, e, err := a.resolve("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (a *archiveFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	dir, e, err := a.resolve("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !e.IsDir() {
+		return nil, a.err("readdir", name, errors.New("not a directory"))
+	}
+	ls := make([]fs.DirEntry, 0, len(e.children))
+	for _, c := range e.children {
+		ls = append(ls, a.entries[path.Join(dir, c)])
+	}
+	slices.SortFunc(ls, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return ls, nil
+}
+
+// Resolve symlinks, returning the path of the target.
+func (a *archiveFS) resolve(op, name string) (string, *archiveInfo, error) {
+	for range 40 {
+		e, err := a.entry(op, name)
+		if err != nil {
+			return "", nil, err
+		}
+		if e.mode&fs.ModeSymlink == 0 {
+			return name, e, nil
+		}
+		if path.IsAbs(e.link) {
+			return "", nil, a.err(op, name, fs.ErrNotExist)
+		}
+		name = path.Clean(path.Join(path.Dir(name), e.link))
+	}
+	return "", nil, a.err(op, name, errors.New("too many levels of symbolic links"))
+}
+
+func (a *archiveFS) ReadLink(name string) (string, error) {
+	e, err := a.entry("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	if e.mode&fs.ModeSymlink == 0 {
+		return "", a.err("readlink", name, fs.ErrInvalid)
+	}
+	return e.link, nil
+}
+
+// Open the file name; the contents of regular files are read from the archive
+// (which means decompressing a tar archive up to that file).
+func (a *archiveFS) Open(name string) (fs.File, error) {
+	name, e, err := a.resolve("open", name)
+	if err != nil {
+		return nil, err
+	}
+	f := &archiveFile{archiveInfo: e}
+	switch {
+	case e.IsDir():
+		f.dir, err = a.ReadDir(name)
+	case e.mode.IsRegular():
+		f.rc, err = a.contents(name)
+	}
+	if err != nil {
+		return nil, a.err("open", name, err)
+	}
+	return f, nil
+}
+
+// Get the contents of the file name.
+func (a *archiveFS) contents(name string) (io.ReadCloser, error) {
+	if kind := archiveKind(a.path); kind == "zip" || kind == "jar" {
+		z, err := zip.OpenReader(a.path)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range z.File {
+			if cleanArchivePath(f.Name) == name {
+				rc, err := f.Open()
+				if err != nil {
+					z.Close()
+					return nil, err
+				}
+				return readCloser{rc, func() error { return errors.Join(rc.Close(), z.Close()) }}, nil
+			}
+		}
+		z.Close()
+		return nil, fs.ErrNotExist
+	}
+
+	tr, fp, err := openTar(a.path)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		h, err := tr.Next()
+		if err != nil {
+			fp.Close()
+			if err == io.EOF {
+				err = fs.ErrNotExist
+			}
+			return nil, err
+		}
+		if cleanArchivePath(h.Name) == name && h.Typeflag == tar.TypeReg {
+			return readCloser{tr, fp.Close}, nil
+		}
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (r readCloser) Close() error { return r.close() }
+
+// File opened with archiveFS.Open(); this is a fs.ReadDirFile for
+// directories.
+type archiveFile struct {
+	*archiveInfo
+	rc  io.ReadCloser // Contents of regular files.
+	dir []fs.DirEntry // Remaining directory entries.
+}
+
+func (f *archiveFile) Stat() (fs.FileInfo, error) { return f.archiveInfo, nil }
+
+func (f *archiveFile) Read(b []byte) (int, error) {
+	if f.rc == nil {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrInvalid}
+	}
+	return f.rc.Read(b)
+}
+
+func (f *archiveFile) Close() error {
+	if f.rc == nil {
+		return nil
+	}
+	return f.rc.Close()
+}
+
+func (f *archiveFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !f.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errors.New("not a directory")}
+	}
+	if n <= 0 {
+		ls := f.dir
+		f.dir = nil
+		return ls, nil
+	}
+	if len(f.dir) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(f.dir))
+	ls := f.dir[:n]
+	f.dir = f.dir[n:]
+	return ls, nil
+}
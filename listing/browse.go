@@ -0,0 +1,340 @@
+package listing
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"zgo.at/elles/os2"
+)
+
+// Browse runs an interactive browser for dir on the controlling terminal.
+//
+// The filters in Options only apply to files; directories are always shown so
+// they can be entered.
+//
+// It returns the path the user selected: the current directory when quitting
+// with q, or the file when pressing enter on it. An empty string is returned if
+// the user cancelled with Q or ^C.
+func (l Lister) Browse(dir string) (string, error) {
+	opt, err := l.prepare()
+	if err != nil {
+		return "", err
+	}
+	tty, restore, err := os2.OpenTerminal()
+	if err != nil {
+		return "", fmt.Errorf("-browse: %w", err)
+	}
+	defer restore()
+
+	fmt.Fprint(tty, "\x1b[?1049h\x1b[?25l") // Alternate screen, hide cursor.
+	defer fmt.Fprint(tty, "\x1b[?25h\x1b[?1049l")
+
+	b := newBrowser(tty, tty, dir, opt)
+	b.size = func() (int, int) {
+		w, h, err := os2.TerminalSize(tty)
+		if err != nil {
+			return 80, 24
+		}
+		return w, h
+	}
+	return b.run()
+}
+
+type browser struct {
+	in   *bufio.Reader
+	out  io.Writer
+	size func() (width, height int)
+
+	dir            string // Absolute path.
+	opt            Options
+	filter         string
+	filtering      bool
+	p              printable // Current directory, with the filter applied.
+	cursor, offset int
+	status         string // Error or help text.
+}
+
+func newBrowser(in io.Reader, out io.Writer, dir string, opt Options) *browser {
+	// Used as a single column, as in -1, and always lists the directory
+	// contents.
+	opt.One, opt.Recurse, opt.Trim, opt.Total = true, false, false, false
+	opt.Directory, opt.DerefArgs, opt.DerefAll = false, false, false
+	opt.nostat = false
+	if f := opt.filt; len(f) > 0 {
+		opt.filt = filter{func(absdir string, fi fs.FileInfo) bool { return fi.IsDir() || f.match(absdir, fi) }}
+	}
+	return &browser{
+		in:   bufio.NewReader(in),
+		out:  out,
+		size: func() (int, int) { return 80, 24 },
+		dir:  dir,
+		opt:  opt,
+	}
+}
+
+var browseSorts = []string{"name", "size", "time", "ext"}
+
+// Run until the user quits; returns the selected path, or an empty string if
+// cancelled.
+func (b *browser) run() (string, error) {
+	d, err := b.opt.vfs.abs(b.dir)
+	if err != nil {
+		return "", err
+	}
+	b.dir = d
+	b.load("")
+
+	for {
+		b.draw()
+		k, err := b.key()
+		if err != nil {
+			if err == io.EOF {
+				return "", nil
+			}
+			return "", err
+		}
+		b.status = ""
+
+		if b.filtering {
+			switch k {
+			case "esc":
+				b.filtering, b.filter = false, ""
+			case "enter":
+				b.filtering = false
+			case "backspace":
+				if b.filter != "" {
+					r := []rune(b.filter)
+					b.filter = string(r[:len(r)-1])
+				}
+			case "ctrl-c":
+				return "", nil
+			default:
+				if len([]rune(k)) != 1 {
+					continue
+				}
+				b.filter += k
+			}
+			b.load(b.selected())
+			continue
+		}
+
+		switch k {
+		case "q":
+			return b.dir, nil
+		case "Q", "ctrl-c":
+			return "", nil
+		case "up", "k":
+			b.cursor--
+		case "down", "j":
+			b.cursor++
+		case "pgup":
+			b.cursor -= b.rows()
+		case "pgdown":
+			b.cursor += b.rows()
+		case "home", "g":
+			b.cursor = 0
+		case "end", "G":
+			b.cursor = len(b.p.fi) - 1
+		case "right", "l", "enter":
+			if len(b.p.fi) == 0 {
+				continue
+			}
+			fi := b.p.fi[b.cursor]
+			path := filepath.Join(b.dir, fi.Name())
+			if !b.opt.vfs.isDir(b.dir, fi) {
+				if k == "enter" {
+					return path, nil
+				}
+				continue
+			}
+			b.dir, b.filter = path, ""
+			b.load("")
+		case "left", "h", "backspace":
+			if parent := filepath.Dir(b.dir); parent != b.dir {
+				prev := filepath.Base(b.dir)
+				b.dir, b.filter = parent, ""
+				b.load(prev)
+			}
+		case "/":
+			b.filtering = true
+		case "esc":
+			b.filter = ""
+			b.load(b.selected())
+		case "s":
+			b.opt.Sort = browseSorts[(slices.Index(browseSorts, b.opt.Sort)+1)%len(browseSorts)]
+			b.load(b.selected())
+		case "r":
+			b.opt.Reverse = !b.opt.Reverse
+			b.load(b.selected())
+		case "a":
+			b.opt.All = !b.opt.All
+			b.load(b.selected())
+		case "L":
+			b.opt.Long = (b.opt.Long + 1) % 3
+		case "?":
+			b.status = "q: quit and print directory · enter: select · ←/→: navigate · /: filter · s: sort · r: reverse · a: hidden · L: columns · Q: cancel"
+		}
+	}
+}
+
+// Load the current directory, and move the cursor to the entry named sel (if
+// any).
+func (b *browser) load(sel string) {
+	errs := &errGroup{MaxSize: 100}
+	toPrint := gather(slices.Values([]string{b.dir}), errs, b.opt)
+	order(toPrint, b.opt)
+	if errs.Len() > 0 {
+		b.status = errs.List()[0].Error()
+	}
+
+	b.p = printable{dir: b.dir, absdir: b.dir}
+	if len(toPrint) > 0 {
+		b.p = toPrint[0]
+	}
+	if b.filter != "" {
+		f := strings.ToLower(b.filter)
+		b.p.fi = slices.DeleteFunc(b.p.fi, func(fi fileInfo) bool {
+			return !strings.Contains(strings.ToLower(fi.Name()), f)
+		})
+	}
+
+	b.cursor, b.offset = 0, 0
+	for i, fi := range b.p.fi {
+		if fi.Name() == sel {
+			b.cursor = i
+			break
+		}
+	}
+}
+
+func (b *browser) selected() string {
+	if b.cursor < 0 || b.cursor >= len(b.p.fi) {
+		return ""
+	}
+	return b.p.fi[b.cursor].Name()
+}
+
+// Number of rows available for entries; one line for the header and one for
+// the status line.
+func (b *browser) rows() int {
+	_, h := b.size()
+	return max(1, h-2)
+}
+
+func (b *browser) draw() {
+	var (
+		width, _ = b.size()
+		rows     = b.rows()
+		buf      strings.Builder
+	)
+	b.cursor = max(0, min(b.cursor, len(b.p.fi)-1))
+	if b.cursor < b.offset {
+		b.offset = b.cursor
+	}
+	if b.cursor >= b.offset+rows {
+		b.offset = b.cursor - rows + 1
+	}
+
+	buf.WriteString("\x1b[H\x1b[2J")
+	head := b.dir + " [" + b.opt.Sort
+	if b.opt.Reverse {
+		head += ", reversed"
+	}
+	head += "]"
+	if b.filter != "" || b.filtering {
+		head += " /" + b.filter
+	}
+	buf.WriteString(b.line(head, width) + "\r\n")
+
+	fmtRows, _, _ := getCols(b.p, b.opt).format(0)
+	for i := b.offset; i < len(fmtRows) && i < b.offset+rows; i++ {
+		prefix := "  "
+		if i == b.cursor {
+			prefix = "> "
+		}
+		buf.WriteString(b.line(prefix+fmtRows[i], width) + "\r\n")
+	}
+	if len(fmtRows) == 0 {
+		buf.WriteString("  (empty)\r\n")
+	}
+
+	st := b.status
+	if st == "" {
+		st = fmt.Sprintf("%d/%d · ? for help", b.cursor+1, len(b.p.fi))
+		if len(b.p.fi) == 0 {
+			st = "0/0 · ? for help"
+		}
+	}
+	fmt.Fprintf(&buf, "\x1b[%d;1H%s", rows+2, b.line(st, width))
+	io.WriteString(b.out, buf.String())
+}
+
+// Trim a line to the terminal width.
+func (b *browser) line(s string, width int) string {
+	if textWidth(s) > width {
+		s, _ = trimWidth(s, width-1)
+		s += b.opt.Colors.reset + "…"
+	}
+	return s
+}
+
+// Read a key; escape sequences for the arrows and such are converted to a
+// name, as are some control characters.
+func (b *browser) key() (string, error) {
+	r, _, err := b.in.ReadRune()
+	if err != nil {
+		return "", err
+	}
+	switch r {
+	case '\r', '\n':
+		return "enter", nil
+	case 0x7f, 0x08:
+		return "backspace", nil
+	case 0x03:
+		return "ctrl-c", nil
+	case 0x1b:
+		if b.in.Buffered() == 0 {
+			return "esc", nil
+		}
+		if c, _ := b.in.Peek(1); c[0] != '[' && c[0] != 'O' {
+			return "esc", nil
+		}
+		b.in.ReadByte()
+		var seq []byte
+		for {
+			c, err := b.in.ReadByte()
+			if err != nil {
+				return "", err
+			}
+			seq = append(seq, c)
+			if c >= 0x40 && c <= 0x7e {
+				break
+			}
+		}
+		switch string(seq) {
+		case "A":
+			return "up", nil
+		case "B":
+			return "down", nil
+		case "C":
+			return "right", nil
+		case "D":
+			return "left", nil
+		case "H", "1~", "7~":
+			return "home", nil
+		case "F", "4~", "8~":
+			return "end", nil
+		case "5~":
+			return "pgup", nil
+		case "6~":
+			return "pgdown", nil
+		}
+		return "", nil
+	}
+	return string(r), nil
+}
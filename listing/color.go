@@ -0,0 +1,784 @@
+package listing
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"zgo.at/elles/os2"
+	"zgo.at/termtext"
+)
+
+// Colors is the colour table for a listing, as loaded by LoadColors. A nil
+// Colors doesn't colour anything.
+type Colors struct {
+	normal, file, dir, link, pipe, socket                 string
+	blockDev, charDev, orphan, exec                       string
+	door, suid, sgid, sticky, otherWrite, otherWriteStick string
+	hidden, missing, capability, multiHardlink            string
+	cmpLeft, cmpRight, cmpDiff                            string // -compare markers
+	linkAsTarget                                          bool   // ln=target
+	reset                                                 string
+	ext                                                   []extColor
+	rules                                                 []colorRule
+	sources                                               []string // For Print()
+}
+
+type extColor struct {
+	suffix, color string
+	matchCase     bool
+}
+
+// Filename rule from ELLES_COLORS, such as "Makefile", "README*", or
+// "ex&*.sh". Patterns with a "/" match the content type with -sniff, such as
+// "image/*".
+type colorRule struct {
+	pattern string   // Exact filename, or glob pattern for path.Match()
+	exact   bool     // pattern has no glob characters.
+	content bool     // pattern is for the content type.
+	types   []string // Must match all of these, e.g. "ex" or "di".
+	color   string
+}
+
+// LoadColors loads the colours from ELLES_COLORS, LS_COLORS, LSCOLORS, or a
+// dircolors database.
+//
+// The default theme depends on the terminal background, which is read from
+// COLORFGBG. If that's not set, background is called to get "light" or "dark"
+// (for example by asking the terminal), but only if none of the above are set
+// or if ELLES_COLORS has "default=..". It's never called if background is nil.
+//
+// Invalid entries are skipped and returned as a joined error (see errors.Join);
+// the returned Colors can still be used.
+func LoadColors(background func() string) (*Colors, error) {
+	var (
+		c    = &Colors{reset: "\x1b[0m"}
+		errs []error
+	)
+
+	// Use the first of ELLES_COLORS, LS_COLORS, LSCOLORS, or a dircolors
+	// database.
+	ellesColors := cmp.Or(os.Getenv("ELLES_COLORS"), os.Getenv("ELLES_COLOURS"))
+	ls := cmp.Or(os.Getenv("LS_COLORS"), os.Getenv("LS_COLOURS"))
+	bsd := cmp.Or(os.Getenv("LSCOLORS"), os.Getenv("LSCOLOURS"))
+	var dircolors string
+	if ellesColors == "" && ls == "" && bsd == "" {
+		dircolors = findDircolors()
+	}
+
+	// The last "default=.." in ELLES_COLORS sets the theme.
+	var (
+		def      string
+		explicit bool
+	)
+	for cc := range strings.SplitSeq(ellesColors, ":") {
+		if k, v, ok := strings.Cut(cc, "="); ok && k == "default" {
+			def, explicit = v, true
+		}
+	}
+	if !explicit && (ellesColors != "" || ls != "" || bsd != "" || dircolors != "") {
+		background = nil
+	}
+	var bsdDefault bool
+	switch runtime.GOOS {
+	case "freebsd", "openbsd", "netbsd", "dragonfly", "darwin":
+		bsdDefault = true
+	}
+	name, why := pickTheme(def, bsdDefault, background)
+	theme, ok := findTheme(name)
+	if !ok {
+		errs = append(errs, fmt.Errorf("unknown theme in ELLES_COLORS: %q", name))
+		name = map[bool]string{false: "gnu", true: "bsd"}[bsdDefault]
+		theme, _ = findTheme(name)
+	}
+	errs = append(errs, c.readGNU(theme, true)...)
+	if why != "" {
+		name += " (" + why + ")"
+	}
+	c.sources = []string{"theme " + name}
+
+	switch {
+	case ellesColors != "":
+		errs = append(errs, c.readGNU(ellesColors, true)...)
+		c.sources = append(c.sources, "ELLES_COLORS")
+	case ls != "":
+		errs = append(errs, c.readGNU(ls, false)...)
+		c.sources = append(c.sources, "LS_COLORS")
+	case bsd != "":
+		errs = append(errs, c.readBSD(bsd))
+		c.sources = append(c.sources, "LSCOLORS")
+	case dircolors != "":
+		fp, err := os.Open(dircolors)
+		if err != nil {
+			return c, errors.Join(append(errs, fmt.Errorf("reading dircolors database: %w", err))...)
+		}
+		defer fp.Close()
+		dc, err := readDircolors(fp, os.Getenv("TERM"), os.Getenv("COLORTERM"))
+		if err != nil {
+			return c, errors.Join(append(errs, fmt.Errorf("reading dircolors database %q: %w", dircolors, err))...)
+		}
+		errs = append(errs, c.readGNU(dc, false)...)
+		c.sources = append(c.sources, dircolors)
+	}
+	return c, errors.Join(errs...)
+}
+
+// Print writes the colour table, with samples.
+func (c *Colors) Print(w io.Writer) {
+	show := func(code string) string {
+		if code == "" {
+			return "-"
+		}
+		if strings.HasPrefix(code, "\x1b[") && strings.HasSuffix(code, "m") && strings.Count(code, "\x1b") == 1 {
+			return code[2 : len(code)-1]
+		}
+		return strings.ReplaceAll(code, "\x1b", `\e`)
+	}
+	sample := func(code, s string) string {
+		if code == "" {
+			return s
+		}
+		return code + s + c.reset
+	}
+
+	link := c.link
+	if c.linkAsTarget {
+		link = ""
+	}
+	types := []struct{ key, color, desc string }{
+		{"no", c.normal, "normal"},
+		{"fi", c.file, "regular file"},
+		{"di", c.dir, "directory"},
+		{"ln", link, "symbolic link"},
+		{"or", c.orphan, "orphaned symbolic link"},
+		{"mi", c.missing, "missing symbolic link target"},
+		{"pi", c.pipe, "FIFO"},
+		{"so", c.socket, "socket"},
+		{"do", c.door, "door"},
+		{"bd", c.blockDev, "block device"},
+		{"cd", c.charDev, "character device"},
+		{"ex", c.exec, "executable"},
+		{"su", c.suid, "setuid file"},
+		{"sg", c.sgid, "setgid file"},
+		{"ca", c.capability, "file with capability"},
+		{"mh", c.multiHardlink, "file with more than one link"},
+		{"st", c.sticky, "sticky directory"},
+		{"ow", c.otherWrite, "other-writable directory"},
+		{"tw", c.otherWriteStick, "sticky and other-writable directory"},
+		{"hidden", c.hidden, "hidden (added to other colours)"},
+		{"left", c.cmpLeft, "only in the left directory (-compare)"},
+		{"right", c.cmpRight, "only in the right directory (-compare)"},
+		{"diff", c.cmpDiff, "different in both directories (-compare)"},
+	}
+
+	// Only show the suffixes that can match, in order of precedence.
+	exts := make([]extColor, 0, len(c.ext))
+	for _, e := range c.ext {
+		if !slices.ContainsFunc(exts, func(e2 extColor) bool {
+			return e2.suffix == e.suffix || (!e2.matchCase && strings.EqualFold(e2.suffix, e.suffix))
+		}) {
+			exts = append(exts, e)
+		}
+	}
+
+	ruleKey := func(r colorRule) string { return strings.Join(append(slices.Clone(r.types), r.pattern), "&") }
+
+	var kw, cw int
+	for _, t := range types {
+		cw = max(cw, len(show(t.color)))
+	}
+	for _, r := range c.rules {
+		kw, cw = max(kw, textWidth(ruleKey(r))), max(cw, len(show(r.color)))
+	}
+	for _, e := range exts {
+		kw, cw = max(kw, textWidth(e.suffix)+1), max(cw, len(show(e.color)))
+	}
+	kw = max(kw, len("hidden"))
+
+	fmt.Fprintf(w, "Colours from: %s\n", strings.Join(c.sources, ", "))
+	fmt.Fprintln(w, "\nFile types:")
+	for _, t := range types {
+		code := show(t.color)
+		if t.key == "ln" && c.linkAsTarget {
+			code = "target"
+		}
+		fmt.Fprintf(w, "    %s  %s  %s\n",
+			termtext.AlignLeft(t.key, kw), termtext.AlignLeft(code, cw), sample(t.color, t.desc))
+	}
+	if len(c.rules) > 0 {
+		fmt.Fprintln(w, "\nFilename rules (in order of precedence):")
+		for _, typed := range []bool{true, false} {
+			for _, r := range c.rules {
+				if (len(r.types) > 0) == typed {
+					fmt.Fprintf(w, "    %s  %s  %s\n",
+						termtext.AlignLeft(ruleKey(r), kw), termtext.AlignLeft(show(r.color), cw),
+						sample(r.color, ruleKey(r)))
+				}
+			}
+		}
+	}
+	if len(exts) > 0 {
+		fmt.Fprintln(w, "\nSuffixes (in order of precedence):")
+		for _, e := range exts {
+			fmt.Fprintf(w, "    %s  %s  %s\n",
+				termtext.AlignLeft("*"+e.suffix, kw), termtext.AlignLeft(show(e.color), cw),
+				sample(e.color, "*"+e.suffix))
+		}
+	}
+
+	fmt.Fprintln(w, "\nThemes (set with default=.. in ELLES_COLORS):")
+	for _, t := range themes {
+		fmt.Fprintf(w, "    %s  %s\n", termtext.AlignLeft(t.name, 5), t.desc)
+	}
+}
+
+// Positional «fg»«bg» pairs, 11 in total (in order): directory, symlink,
+// socket, pipe, blockdev, chardev, executable with setuid, executable with
+// setgid, world-writable dir with sticky, world-writable dir without sticky
+//
+// Values:
+//
+//	a-h  standard 16 colours
+//	A-H  bold/underline versions
+//	x    default colour
+//	X    default colour with bold/underline
+func (c *Colors) readBSD(ls string) error {
+	var errs []error
+	for i := range len(ls) / 2 {
+		var set *string
+		switch i {
+		case 0:
+			set = &c.dir
+		case 1:
+			set = &c.link
+		case 2:
+			set = &c.socket
+		case 3:
+			set = &c.pipe
+		case 4:
+			set = &c.exec
+		case 5:
+			set = &c.blockDev
+		case 6:
+			set = &c.charDev
+		case 7:
+			set = &c.suid
+		case 8:
+			set = &c.sgid
+		case 9:
+			set = &c.otherWriteStick
+		case 10:
+			set = &c.otherWrite
+		default:
+			continue // TODO: warn?
+		}
+		code, err := bsdcolor(ls[i*2], ls[i*2+1])
+		errs = append(errs, err)
+		*set = code
+	}
+	return errors.Join(errs...)
+}
+
+// Get the escape code for a «fg»«bg» pair; an uppercase foreground is
+// underlined, and an uppercase background is bold.
+func bsdcolor(fg, bg byte) (string, error) {
+	var (
+		attrs, codes []string
+		err          error
+	)
+	for i, c := range []byte{fg, bg} {
+		attr := map[int]string{0: "4", 1: "1"}[i]
+		switch {
+		case c >= 'a' && c <= 'h':
+			codes = append(codes, strconv.Itoa(30+10*i+int(c-'a')))
+		case c >= 'A' && c <= 'H':
+			codes = append(codes, strconv.Itoa(30+10*i+int(c-'A')))
+			attrs = append(attrs, attr)
+		case c == 'X':
+			attrs = append(attrs, attr)
+		case c != 'x':
+			err = fmt.Errorf("unknown color code in LSCOLORS: %c", c)
+		}
+	}
+	if len(attrs)+len(codes) == 0 {
+		return "", err
+	}
+	slices.Sort(attrs) // Bold before underline.
+	return "\x1b[" + strings.Join(append(attrs, codes...), ";") + "m", err
+}
+
+// key/value pair as «name»=«colour code». The colour code is wrapped in the
+// "lc" and "rc" codes (\x1b[ and m by default), and names are followed by the
+// "ec" code, or lc+rs+rc if that's not set.
+//
+// Values can use the same escapes as dircolors: \e, \n, ^[, \033, \x1b, etc.
+func (c *Colors) readGNU(s string, extended bool) []error {
+	varname := "LS_COLORS"
+	if extended {
+		varname = "ELLES_COLORS"
+	}
+
+	if s == "" {
+		return nil
+	}
+	pairs := strings.Split(s, ":")
+
+	// These wrap all the other codes, so get them first as they can appear
+	// anywhere.
+	left, right, end, rs := "\x1b[", "m", "", "0"
+	truecolor := extended && hasTruecolor()
+	for _, cc := range pairs {
+		k, v, _ := strings.Cut(cc, "=")
+		switch k {
+		case "lc":
+			left = unescapeColor(v)
+		case "rc":
+			right = unescapeColor(v)
+		case "ec":
+			end = unescapeColor(v)
+		case "rs":
+			rs = unescapeColor(v)
+		}
+	}
+	if end == "" {
+		end = left + rs + right
+	}
+	c.reset = end
+
+	// "", "0", and "00" all mean "not coloured", which means we fall back to the
+	// next applicable colour (e.g. "ow=" will use "di" for other-writable
+	// directories).
+	code := func(v string) string {
+		v = unescapeColor(v)
+		if v == "" || v == "0" || v == "00" {
+			return ""
+		}
+		if extended {
+			v = expandHexColors(v, truecolor)
+		}
+		return left + v + right
+	}
+
+	var (
+		exts  []extColor
+		rules []colorRule
+		errs  []error
+	)
+	for _, cc := range pairs {
+		if cc == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(cc, "=")
+		if !ok {
+			errs = append(errs, fmt.Errorf("malformed %s: %q", varname, cc))
+			continue
+		}
+		if k != "" && k[0] == '*' && (!extended || !isRule(k[1:])) {
+			exts = append(exts, extColor{suffix: unescapeColor(k[1:]), color: code(v)})
+			continue
+		}
+		if extended && !isColorKey(k) {
+			r, err := parseColorRule(k, code(v))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", varname, err))
+				continue
+			}
+			rules = append(rules, r)
+			continue
+		}
+		switch k {
+		case "lc", "rc", "ec", "rs":
+		case "cl":
+			// Clear to end of line; only needed for ls -x with background
+			// colours, which we don't implement.
+		case "no":
+			c.normal = code(v)
+		case "fi":
+			c.file = code(v)
+		case "di":
+			c.dir = code(v)
+		case "ln":
+			if v == "target" {
+				c.linkAsTarget = true
+			} else {
+				c.link = code(v)
+			}
+		case "pi":
+			c.pipe = code(v)
+		case "so":
+			c.socket = code(v)
+		case "bd":
+			c.blockDev = code(v)
+		case "cd":
+			c.charDev = code(v)
+		case "or":
+			c.orphan = code(v)
+		case "mi":
+			c.missing = code(v)
+		case "ex":
+			c.exec = code(v)
+		case "do":
+			c.door = code(v)
+		case "su":
+			c.suid = code(v)
+		case "sg":
+			c.sgid = code(v)
+		case "ca":
+			c.capability = code(v)
+		case "mh":
+			c.multiHardlink = code(v)
+		case "st":
+			c.sticky = code(v)
+		case "ow":
+			c.otherWrite = code(v)
+		case "tw":
+			c.otherWriteStick = code(v)
+		case "hidden", "left", "right", "diff":
+			if !extended {
+				errs = append(errs, fmt.Errorf("unknown key in %s: %q", varname, k))
+			}
+			switch k {
+			case "hidden":
+				c.hidden = code(v)
+			case "left":
+				c.cmpLeft = code(v)
+			case "right":
+				c.cmpRight = code(v)
+			case "diff":
+				c.cmpDiff = code(v)
+			}
+		case "default":
+			// Handled in LoadColors().
+			if !extended {
+				errs = append(errs, fmt.Errorf("unknown key in %s: %q", varname, k))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("unknown key in %s: %q", varname, k))
+		}
+	}
+
+	// Suffixes are matched case-insensitive, unless there are several that
+	// differ only by case (e.g. *.z and *.Z). Later entries take precedence, so
+	// reverse the list as we use the first match.
+	for i := range exts {
+		for j := range exts {
+			if i != j && exts[i].suffix != exts[j].suffix && strings.EqualFold(exts[i].suffix, exts[j].suffix) {
+				exts[i].matchCase = true
+			}
+		}
+	}
+	slices.Reverse(exts)
+	c.ext = append(exts, c.ext...)
+
+	// Exact filenames before patterns, and later entries before earlier ones.
+	slices.Reverse(rules)
+	slices.SortStableFunc(rules, func(a, b colorRule) int {
+		switch {
+		case a.exact && !b.exact:
+			return -1
+		case !a.exact && b.exact:
+			return 1
+		}
+		return 0
+	})
+	c.rules = append(rules, c.rules...)
+	return errs
+}
+
+// Keys that set a colour, rather than a filename rule.
+func isColorKey(k string) bool {
+	switch k {
+	case "lc", "rc", "ec", "rs", "cl", "no", "fi", "di", "ln", "pi", "so", "bd",
+		"cd", "or", "mi", "ex", "do", "su", "sg", "ca", "mh", "st", "ow", "tw", "hidden", "left", "right", "diff", "default":
+		return true
+	}
+	return false
+}
+
+// Report if this ELLES_COLORS key is a rule rather than a plain "*.ext"
+// suffix.
+func isRule(k string) bool { return strings.ContainsAny(k, "*?[\\&") }
+
+// Types that can be used in rules.
+func isRuleType(t string) bool {
+	switch t {
+	case "fi", "di", "ln", "pi", "so", "bd", "cd", "do", "ex", "su", "sg", "ca", "mh", "st", "ow", "tw", "hidden":
+		return true
+	}
+	return false
+}
+
+// Parse a filename rule: a filename or glob pattern, optionally combined with
+// one or more types with "&" (e.g. "ex&*.sh"). Without a pattern it matches
+// everything of that type (e.g. "di&hidden").
+func parseColorRule(k, color string) (colorRule, error) {
+	r := colorRule{color: color}
+	var pat []string
+	for p := range strings.SplitSeq(k, "&") {
+		if isRuleType(p) {
+			r.types = append(r.types, p)
+		} else {
+			pat = append(pat, p)
+		}
+	}
+	switch len(pat) {
+	case 0:
+		r.pattern = "*"
+	case 1:
+		r.pattern = unescapeColor(pat[0])
+	default:
+		return r, fmt.Errorf("more than one pattern in %q", k)
+	}
+	if r.pattern == "" {
+		return r, fmt.Errorf("empty pattern in %q", k)
+	}
+	if _, err := path.Match(r.pattern, ""); err != nil {
+		return r, fmt.Errorf("invalid pattern %q: %w", r.pattern, err)
+	}
+	r.exact = !strings.ContainsAny(r.pattern, "*?[\\")
+	r.content = strings.Contains(r.pattern, "/")
+	return r, nil
+}
+
+// Get the colour from the first matching rule; typed selects rules with or
+// without a type. Rules for the content type are only used with -sniff.
+func ruleColor(absdir string, fi fs.FileInfo, opt Options, typed bool) (string, bool) {
+	var (
+		name  = fi.Name()
+		ct    string
+		check bool
+	)
+	for _, r := range opt.Colors.rules {
+		if (len(r.types) > 0) != typed {
+			continue
+		}
+		if r.content {
+			if !opt.Sniff {
+				continue
+			}
+			if !check {
+				ct, check = mediaType(opt.vfs.sniffType(absdir, fi)), true
+			}
+			if ok, _ := path.Match(r.pattern, ct); !ok || ct == "" {
+				continue
+			}
+		} else if r.exact {
+			if name != r.pattern {
+				continue
+			}
+		} else if ok, _ := path.Match(r.pattern, name); !ok {
+			continue
+		}
+		if !slices.ContainsFunc(r.types, func(t string) bool { return !hasType(absdir, fi, t) }) {
+			return r.color, true
+		}
+	}
+	return "", false
+}
+
+// Report if fi is of the type for the key t; this doesn't follow symlinks.
+func hasType(absdir string, fi fs.FileInfo, t string) bool {
+	m := fi.Mode()
+	switch t {
+	case "fi":
+		return m.IsRegular()
+	case "di":
+		return m.IsDir()
+	case "ln":
+		return m&fs.ModeSymlink != 0
+	case "pi":
+		return m&fs.ModeNamedPipe != 0
+	case "so":
+		return m&fs.ModeSocket != 0
+	case "bd":
+		return m&fs.ModeDevice != 0 && m&fs.ModeCharDevice == 0
+	case "cd":
+		return m&fs.ModeCharDevice != 0
+	case "do":
+		return os2.IsDoor(fi)
+	case "ex":
+		return m.IsRegular() && m&0o111 != 0
+	case "su":
+		return m&fs.ModeSetuid != 0
+	case "sg":
+		return m&fs.ModeSetgid != 0
+	case "ca":
+		return m.IsRegular() && os2.HasCapability(absdir, fi)
+	case "mh":
+		return !m.IsDir() && os2.Numlinks(absdir, fi) > 1
+	case "st":
+		return m&fs.ModeSticky != 0
+	case "ow":
+		return m&0o002 != 0
+	case "tw":
+		return m&0o002 != 0 && m&fs.ModeSticky != 0
+	case "hidden":
+		return len(fi.Name()) > 0 && fi.Name()[0] == '.'
+	}
+	return false
+}
+
+// Unescape dircolors-style escapes; as GNU's get_funky_string().
+func unescapeColor(s string) string {
+	if !strings.ContainsAny(s, `\^`) {
+		return s
+	}
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '^' && i+1 < len(s):
+			i++
+			if s[i] == '?' {
+				b = append(b, 0x7f)
+			} else {
+				b = append(b, s[i]&0x1f)
+			}
+		case s[i] == '\\' && i+1 < len(s):
+			i++
+			switch c := s[i]; c {
+			case 'a':
+				b = append(b, '\a')
+			case 'b':
+				b = append(b, '\b')
+			case 'e':
+				b = append(b, 0x1b)
+			case 'f':
+				b = append(b, '\f')
+			case 'n':
+				b = append(b, '\n')
+			case 'r':
+				b = append(b, '\r')
+			case 't':
+				b = append(b, '\t')
+			case 'v':
+				b = append(b, '\v')
+			case '?':
+				b = append(b, 0x7f)
+			case '_':
+				b = append(b, ' ')
+			case 'x', 'X':
+				var n byte
+				for j := 0; j < 2 && i+1 < len(s) && isxdigit(s[i+1]); j++ {
+					i++
+					n = n*16 + unhex(s[i])
+				}
+				b = append(b, n)
+			case '0', '1', '2', '3', '4', '5', '6', '7':
+				n := c - '0'
+				for j := 0; j < 2 && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '7'; j++ {
+					i++
+					n = n*8 + s[i] - '0'
+				}
+				b = append(b, n)
+			default:
+				b = append(b, c)
+			}
+		default:
+			b = append(b, s[i])
+		}
+	}
+	return string(b)
+}
+
+func isxdigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func unhex(c byte) byte {
+	switch {
+	case c >= 'a':
+		return c - 'a' + 10
+	case c >= 'A':
+		return c - 'A' + 10
+	}
+	return c - '0'
+}
+
+// Get the colour for a name from the *.ext suffix rules.
+func (c *Colors) suffix(name string) (string, bool) {
+	for _, e := range c.ext {
+		if len(name) < len(e.suffix) {
+			continue
+		}
+		tail := name[len(name)-len(e.suffix):]
+		if tail == e.suffix || (!e.matchCase && strings.EqualFold(tail, e.suffix)) {
+			return e.color, true
+		}
+	}
+	return "", false
+}
+
+// Get the colour for fi, using the same precedence as GNU ls. Symlinks only get
+// the symlink colour; use linkColor() to resolve them.
+//
+// Rules with a type (e.g. "ex&*.sh") take precedence over everything, and rules
+// without one are used for regular files before the suffixes. With -sniff,
+// files without a matching suffix get the colour for the suffix of their
+// content type.
+func fileColor(absdir string, fi fs.FileInfo, opt Options) string {
+	col := opt.Colors
+	if c, ok := ruleColor(absdir, fi, opt, true); ok {
+		return c
+	}
+	m := fi.Mode()
+	switch {
+	case m.IsRegular():
+		switch {
+		case m&fs.ModeSetuid != 0 && col.suid != "":
+			return col.suid
+		case m&fs.ModeSetgid != 0 && col.sgid != "":
+			return col.sgid
+		case col.capability != "" && os2.HasCapability(absdir, fi):
+			return col.capability
+		case m&0o111 != 0 && col.exec != "":
+			return col.exec
+		case col.multiHardlink != "" && os2.Numlinks(absdir, fi) > 1:
+			return col.multiHardlink
+		}
+		if c, ok := ruleColor(absdir, fi, opt, false); ok {
+			return c
+		}
+		if c, ok := col.suffix(fi.Name()); ok {
+			return c
+		}
+		if opt.Sniff { // Colour as a file with the suffix for the content type.
+			if ext := contentExts[mediaType(opt.vfs.sniffType(absdir, fi))]; ext != "" {
+				if c, ok := col.suffix(ext); ok {
+					return c
+				}
+			}
+		}
+		return col.file
+	case m.IsDir():
+		switch {
+		case m&0o002 != 0 && m&fs.ModeSticky != 0 && col.otherWriteStick != "":
+			return col.otherWriteStick
+		case m&0o002 != 0 && col.otherWrite != "":
+			return col.otherWrite
+		case m&fs.ModeSticky != 0 && col.sticky != "":
+			return col.sticky
+		}
+		return col.dir
+	case m&fs.ModeSymlink != 0:
+		return col.link
+	case m&fs.ModeNamedPipe != 0:
+		return col.pipe
+	case m&fs.ModeSocket != 0:
+		return col.socket
+	case m&fs.ModeCharDevice != 0: // ModeDevice is also set for char devices.
+		return col.charDev
+	case m&fs.ModeDevice != 0:
+		return col.blockDev
+	case os2.IsDoor(fi):
+		return col.door
+	}
+	return ""
+}
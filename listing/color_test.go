@@ -0,0 +1,196 @@
+package listing
+
+import (
+	"bytes"
+	"io/fs"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+func TestDircolors(t *testing.T) {
+	db := `
+# Comment
+NORMAL 00
+DIR 01;34   # Trailing comment
+LINK target
+.tar 01;31
+*README 33
+
+TERM xterm*
+TERM screen
+COLORTERM ?*
+EXEC 01;32
+
+TERM dumb
+NORM 07
+`
+	tests := []struct {
+		term, colorterm, want string
+	}{
+		{"", "", "no=00:di=01;34:ln=target:*.tar=01;31:*README=33"},
+		{"xterm-256color", "", "no=00:di=01;34:ln=target:*.tar=01;31:*README=33:ex=01;32"},
+		{"screen", "", "no=00:di=01;34:ln=target:*.tar=01;31:*README=33:ex=01;32"},
+		{"linux", "truecolor", "no=00:di=01;34:ln=target:*.tar=01;31:*README=33:ex=01;32"},
+		{"dumb", "", "no=00:di=01;34:ln=target:*.tar=01;31:*README=33:no=07"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.term+"/"+tt.colorterm, func(t *testing.T) {
+			have, err := readDircolors(strings.NewReader(db), tt.term, tt.colorterm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have != tt.want {
+				t.Errorf("\nhave: %s\nwant: %s", have, tt.want)
+			}
+		})
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		for _, db := range []string{"DIR", "NORMAL 00\nWHAT 01"} {
+			_, err := readDircolors(strings.NewReader(db), "", "")
+			if err == nil {
+				t.Errorf("no error for %q", db)
+			}
+		}
+	})
+}
+
+func TestTheme(t *testing.T) {
+	// Only ask the terminal if nothing sets the colours, or if ELLES_COLORS
+	// asks for it, and never if COLORFGBG is set.
+	t.Run("background", func(t *testing.T) {
+		tests := []struct {
+			env    []string
+			called bool
+			want   string
+		}{
+			{nil, true, "theme bsd (light background)"},
+			{[]string{"COLORFGBG", "15;0"}, false, "theme gnu (dark background)"},
+			{[]string{"ELLES_COLORS", "di=31"}, false, "theme gnu (unknown background)"},
+			{[]string{"ELLES_COLORS", "default=dark,light"}, true, "theme light (light background)"},
+			{[]string{"ELLES_COLORS", "default=dark"}, false, "theme dark"},
+			{[]string{"LS_COLORS", "di=31"}, false, "theme gnu (unknown background)"},
+			{[]string{"LSCOLORS", "ex"}, false, "theme gnu (unknown background)"},
+			{[]string{"ELLES_DIRCOLORS", "/dev/null"}, false, "theme gnu (unknown background)"},
+		}
+		for _, tt := range tests {
+			t.Run(strings.Join(tt.env, "="), func(t *testing.T) {
+				for _, k := range []string{"ELLES_COLORS", "LS_COLORS", "LSCOLORS", "COLORFGBG", "ELLES_DIRCOLORS", "HOME", "XDG_CONFIG_HOME"} {
+					t.Setenv(k, "")
+				}
+				if len(tt.env) > 0 {
+					t.Setenv(tt.env[0], tt.env[1])
+				}
+				var called bool
+				c, err := LoadColors(func() string { called = true; return "light" })
+				if err != nil {
+					t.Fatal(err)
+				}
+				if called != tt.called {
+					t.Errorf("called: %t", called)
+				}
+				if runtime.GOOS != "linux" {
+					return // Default theme differs on BSD.
+				}
+				if c.sources[0] != tt.want {
+					t.Errorf("\nhave: %q\nwant: %q", c.sources[0], tt.want)
+				}
+			})
+		}
+	})
+
+	t.Run("nearest256", func(t *testing.T) {
+		tests := []struct {
+			r, g, b uint8
+			want    uint8
+		}{
+			{0, 0, 0, 16},
+			{255, 255, 255, 231},
+			{255, 0, 0, 196},
+			{0x5f, 0xaf, 0xff, 75},
+			{0x80, 0x80, 0x80, 244},
+			{0x12, 0x12, 0x12, 233},
+		}
+		for _, tt := range tests {
+			if have := nearest256(tt.r, tt.g, tt.b); have != tt.want {
+				t.Errorf("#%02x%02x%02x: have %d; want %d", tt.r, tt.g, tt.b, have, tt.want)
+			}
+		}
+	})
+}
+
+func TestLoadColors(t *testing.T) {
+	t.Run("errors", func(t *testing.T) {
+		t.Setenv("ELLES_COLORS", "default=nope:di=31:*.x")
+		c, err := LoadColors(nil)
+		if err == nil {
+			t.Fatal("no error")
+		}
+		for _, want := range []string{`unknown theme in ELLES_COLORS: "nope"`, `malformed ELLES_COLORS: "*.x"`} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%q not in error:\n%s", want, err)
+			}
+		}
+		if c.dir != "\x1b[31m" {
+			t.Errorf("di: %q", c.dir)
+		}
+	})
+
+	t.Run("lscolors", func(t *testing.T) {
+		t.Setenv("ELLES_COLORS", "")
+		t.Setenv("LS_COLORS", "")
+		t.Setenv("LSCOLORS", "exEaaBXxxxxxxxxxxxxxxz")
+		c, err := LoadColors(nil)
+		if err == nil || !strings.Contains(err.Error(), "unknown color code in LSCOLORS: z") {
+			t.Errorf("wrong error: %v", err)
+		}
+		have := []string{c.dir, c.link, c.socket, c.pipe, c.exec, c.otherWrite}
+		want := []string{"\x1b[34m", "\x1b[4;34;40m", "\x1b[1;30;41m", "\x1b[4m", "", ""}
+		if strings.Join(have, " ") != strings.Join(want, " ") {
+			t.Errorf("\nhave: %q\nwant: %q", have, want)
+		}
+	})
+
+	// Every Lister uses its own colours, even when listing at the same time.
+	t.Run("per lister", func(t *testing.T) {
+		t.Setenv("ELLES_COLORS", "default=gnu:di=31")
+		red, err := LoadColors(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("ELLES_COLORS", "default=gnu:di=32")
+		green, err := LoadColors(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fsys := fstest.MapFS{"dir/sub": &fstest.MapFile{Mode: fs.ModeDir | 0o755}}
+		tests := []struct {
+			colors *Colors
+			want   string
+		}{
+			{red, "\x1b[31msub\x1b[0m\n"},
+			{green, "\x1b[32msub\x1b[0m\n"},
+			{nil, "sub\n"},
+		}
+		var wg sync.WaitGroup
+		for range 10 {
+			for _, tt := range tests {
+				wg.Go(func() {
+					var out bytes.Buffer
+					err := Lister{Options: Options{Colors: tt.colors}, FS: fsys, Out: &out}.List("dir")
+					if err != nil {
+						t.Error(err)
+					}
+					if have := out.String(); have != tt.want {
+						t.Errorf("\nhave: %q\nwant: %q", have, tt.want)
+					}
+				})
+			}
+		}
+		wg.Wait()
+	})
+}
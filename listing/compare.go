@@ -0,0 +1,219 @@
+package listing
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Markers for -compare, as in sdiff.
+const (
+	markSame  = " "
+	markLeft  = "<"
+	markRight = ">"
+	markDiff  = "|"
+)
+
+// Compare writes a merged listing of the directories left and right. Every
+// entry is marked as only in left ("<"), only in right (">"), different ("|"),
+// or identical (" "), and for different entries the differences are shown
+// after the name.
+//
+// The columns for entries in both directories are from right. With Recurse the
+// subdirectories in both directories are compared as well.
+//
+// Errors are returned as with List.
+func (l Lister) Compare(left, right string) error {
+	opt, err := l.prepare()
+	if err != nil {
+		return err
+	}
+	if opt.JSON {
+		return errors.New("can't use -json with -compare")
+	}
+	opt.Directory, opt.nostat, opt.GroupBy = false, false, ""
+
+	// Gather both directories, by the path relative to left or right.
+	var (
+		errs  = &errGroup{MaxSize: 100}
+		sides [2]map[string]printable
+	)
+	for i, root := range []string{left, right} {
+		ra, err := opt.vfs.abs(root)
+		if err != nil {
+			return err
+		}
+		sides[i] = make(map[string]printable)
+		for _, p := range gather(slices.Values([]string{root}), errs, opt) {
+			if p.isFiles {
+				return fmt.Errorf("-compare: not a directory: %q", root)
+			}
+			rel, err := filepath.Rel(ra, p.absdir)
+			if errs.Append(err) {
+				continue
+			}
+			sides[i][rel] = p
+		}
+	}
+
+	// Directories that are only in one side are shown as an entry in the
+	// parent, but not listed.
+	var dirs []string
+	for d := range sides[0] {
+		if _, ok := sides[1][d]; ok {
+			dirs = append(dirs, d)
+		}
+	}
+	slices.Sort(dirs)
+
+	w := bufio.NewWriter(l.Out)
+	for i, d := range dirs {
+		if len(dirs) > 1 {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintln(w, filepath.ToSlash(d)+":")
+		}
+		rows, _, _ := compareDir(sides[0][d], sides[1][d], opt, false).format(opt.MaxColWidth)
+		for _, r := range rows {
+			fmt.Fprintln(w, r)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return errors.Join(errs.List()...)
+}
+
+// Merge the entries of two directories, and get the columns with the marker and
+// differences. Identical entries are skipped if onlyChanged is set.
+func compareDir(left, right printable, opt Options, onlyChanged bool) cols {
+	var (
+		merged = printable{dir: right.dir, absdir: right.absdir, fi: make([]fileInfo, 0, len(right.fi))}
+		marks  = make(map[string]string)
+		diffs  = make(map[string]string)
+		byName = make(map[string]fileInfo, len(left.fi))
+	)
+	for _, fi := range left.fi {
+		byName[fi.Name()] = fi
+	}
+	for _, fi := range right.fi {
+		merged.fi = append(merged.fi, fileInfo{fi.FileInfo, right.dir, right.absdir})
+		l, ok := byName[fi.Name()]
+		if !ok {
+			marks[fi.Name()] = markRight
+			continue
+		}
+		delete(byName, fi.Name())
+		d := compareEntry(opt, left.absdir, l, right.absdir, fi)
+		if len(d) == 0 {
+			marks[fi.Name()] = markSame
+		} else {
+			marks[fi.Name()], diffs[fi.Name()] = markDiff, strings.Join(d, ", ")
+		}
+	}
+	for _, fi := range left.fi {
+		if _, ok := byName[fi.Name()]; !ok {
+			continue
+		}
+		merged.fi = append(merged.fi, fileInfo{fi.FileInfo, left.dir, left.absdir})
+		marks[fi.Name()] = markLeft
+	}
+	if onlyChanged {
+		merged.fi = slices.DeleteFunc(merged.fi, func(fi fileInfo) bool { return marks[fi.Name()] == markSame })
+	}
+	order([]printable{merged}, opt)
+
+	cc := getCols(merged, opt)
+	cc.longest = append([]int{1}, cc.longest...)
+	for i, fi := range merged.fi {
+		m := marks[fi.Name()]
+		if c := markColor(m, opt); c != "" {
+			m = c + m + opt.Colors.reset
+		}
+		row := cc.rows[i]
+		if d := diffs[fi.Name()]; d != "" {
+			row[len(row)-1].s += "  " + d
+			row[len(row)-1].w += 2 + textWidth(d)
+		}
+		cc.rows[i] = append([]col{{s: m, w: 1, prop: alignNone}}, row...)
+	}
+	return cc
+}
+
+// Get the colour for a marker, from the left, right, and diff keys in
+// ELLES_COLORS.
+func markColor(m string, opt Options) string {
+	switch m {
+	case markLeft:
+		return opt.Colors.cmpLeft
+	case markRight:
+		return opt.Colors.cmpRight
+	case markDiff:
+		return opt.Colors.cmpDiff
+	}
+	return ""
+}
+
+// Get a list of differences between the entries l and r, as "size 4 → 6".
+//
+// The type, permissions, and owner are always compared. Files are compared by size and
+// modification time (to the second), directories by size with -D, and
+// symlinks by their target.
+func compareEntry(opt Options, ldir string, l fs.FileInfo, rdir string, r fs.FileInfo) []string {
+	var (
+		d      []string
+		lm, rm = l.Mode(), r.Mode()
+	)
+	if lm.Type() != rm.Type() {
+		return []string{fmt.Sprintf("type %c → %c", fileType(l), fileType(r))}
+	}
+	if lm.Perm() != rm.Perm() || lm&(fs.ModeSetuid|fs.ModeSetgid|fs.ModeSticky) != rm&(fs.ModeSetuid|fs.ModeSetgid|fs.ModeSticky) {
+		d = append(d, fmt.Sprintf("mode %s → %s", strmode(lm), strmode(rm)))
+	}
+	// Compare by ID if both have one, so that it doesn't matter if a snapshot
+	// was taken with -n.
+	lu, lg := opt.vfs.owner(ldir, l, opt.NumericUID)
+	ru, rg := opt.vfs.owner(rdir, r, opt.NumericUID)
+	luid, lgid := ownerID(ldir, l)
+	ruid, rgid := ownerID(rdir, r)
+	changed := luid != ruid || lgid != rgid
+	if luid == "" || ruid == "" {
+		changed = lu != ru || lg != rg
+	}
+	if changed {
+		d = append(d, fmt.Sprintf("owner %s:%s → %s:%s", lu, lg, ru, rg))
+	}
+
+	size := func() {
+		if l.Size() != r.Size() {
+			ls, _ := listSize(l, ldir, opt.BlockSize, opt.Comma, true, false)
+			rs, _ := listSize(r, rdir, opt.BlockSize, opt.Comma, true, false)
+			d = append(d, fmt.Sprintf("size %s → %s", strings.TrimSpace(ls), strings.TrimSpace(rs)))
+		}
+	}
+	switch {
+	case lm.IsRegular():
+		size()
+		lt, rt := l.ModTime().Truncate(time.Second), r.ModTime().Truncate(time.Second)
+		if !lt.Equal(rt) {
+			d = append(d, fmt.Sprintf("time %s → %s", lt.Format("2006-01-02 15:04:05"), rt.Format("2006-01-02 15:04:05")))
+		}
+	case lm.IsDir():
+		if opt.DirSize {
+			size()
+		}
+	case lm&fs.ModeSymlink != 0:
+		lt, _ := opt.vfs.linkTarget(ldir, l)
+		rt, _ := opt.vfs.linkTarget(rdir, r)
+		if lt != rt {
+			d = append(d, fmt.Sprintf("target %s → %s", lt, rt))
+		}
+	}
+	return d
+}
@@ -0,0 +1,171 @@
+package listing
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Get the LS_COLORS key for a dircolors keyword; this includes the Slackware
+// aliases.
+func dircolorsKey(k string) (string, bool) {
+	switch strings.ToUpper(k) {
+	case "NORMAL", "NORM":
+		return "no", true
+	case "FILE":
+		return "fi", true
+	case "RESET":
+		return "rs", true
+	case "DIR":
+		return "di", true
+	case "LNK", "LINK", "SYMLINK":
+		return "ln", true
+	case "ORPHAN":
+		return "or", true
+	case "MISSING":
+		return "mi", true
+	case "FIFO", "PIPE":
+		return "pi", true
+	case "SOCK":
+		return "so", true
+	case "BLK", "BLOCK":
+		return "bd", true
+	case "CHR", "CHAR":
+		return "cd", true
+	case "DOOR":
+		return "do", true
+	case "EXEC":
+		return "ex", true
+	case "LEFT", "LEFTCODE":
+		return "lc", true
+	case "RIGHT", "RIGHTCODE":
+		return "rc", true
+	case "END", "ENDCODE":
+		return "ec", true
+	case "SUID", "SETUID":
+		return "su", true
+	case "SGID", "SETGID":
+		return "sg", true
+	case "STICKY":
+		return "st", true
+	case "OTHER_WRITABLE", "OWR":
+		return "ow", true
+	case "STICKY_OTHER_WRITABLE", "OWT":
+		return "tw", true
+	case "CAPABILITY":
+		return "ca", true
+	case "MULTIHARDLINK":
+		return "mh", true
+	case "CLRTOEOL":
+		return "cl", true
+	}
+	return "", false
+}
+
+// Find the dircolors database to use: $ELLES_DIRCOLORS, or the first one of
+// ~/.dircolors, ~/.dir_colors, or $XDG_CONFIG_HOME/dircolors that exists.
+//
+// Returns an empty string if there is none.
+func findDircolors() string {
+	if p := os.Getenv("ELLES_DIRCOLORS"); p != "" {
+		return p
+	}
+	var try []string
+	if h, err := os.UserHomeDir(); err == nil {
+		try = append(try, filepath.Join(h, ".dircolors"), filepath.Join(h, ".dir_colors"))
+	}
+	if c, err := os.UserConfigDir(); err == nil {
+		try = append(try, filepath.Join(c, "dircolors"))
+	}
+	for _, p := range try {
+		if st, err := os.Stat(p); err == nil && st.Mode().IsRegular() {
+			return p
+		}
+	}
+	return ""
+}
+
+// Read a dircolors database, as used by dircolors(1), and convert it to the
+// LS_COLORS format.
+//
+// TERM and COLORTERM lines restrict the lines that follow to terminals that
+// match the glob pattern; several TERM lines in a row match if any of them
+// match. Everything before the first TERM line always applies.
+func readDircolors(r io.Reader, term, colorterm string) (string, error) {
+	if term == "" {
+		term = "none"
+	}
+	const (
+		stGlobal = iota
+		stTermNo
+		stTermYes
+		stTermSure
+	)
+	var (
+		scan   = bufio.NewScanner(r)
+		state  = stGlobal
+		lineno int
+		out    = make([]string, 0, 128)
+	)
+	for scan.Scan() {
+		lineno++
+		line := strings.TrimSpace(scan.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		keyword, arg := line, ""
+		if i := strings.IndexAny(line, " \t"); i > -1 {
+			keyword, arg = line[:i], line[i+1:]
+		}
+		arg, _, _ = strings.Cut(arg, "#")
+		arg = strings.TrimSpace(arg)
+		if arg == "" {
+			return "", fmt.Errorf("line %d: missing argument for %q", lineno, keyword)
+		}
+
+		switch strings.ToUpper(keyword) {
+		case "TERM", "COLORTERM":
+			match := term
+			if strings.EqualFold(keyword, "COLORTERM") {
+				match = colorterm
+			}
+			if state != stTermSure {
+				if ok, _ := path.Match(arg, match); ok {
+					state = stTermSure
+				} else {
+					state = stTermNo
+				}
+			}
+			continue
+		}
+		if state == stTermSure {
+			state = stTermYes // Another TERM line can cancel.
+		}
+		if state == stTermNo {
+			continue
+		}
+
+		switch k := strings.ToUpper(keyword); {
+		case keyword[0] == '.':
+			out = append(out, "*"+keyword+"="+arg)
+		case keyword[0] == '*':
+			out = append(out, keyword+"="+arg)
+		case k == "OPTIONS", k == "COLOR", k == "EIGHTBIT":
+			// Slackware only; ignored by GNU dircolors too.
+		default:
+			key, ok := dircolorsKey(k)
+			if !ok {
+				return "", fmt.Errorf("line %d: unrecognized keyword %q", lineno, keyword)
+			}
+			out = append(out, key+"="+arg)
+		}
+	}
+	if err := scan.Err(); err != nil {
+		return "", err
+	}
+	return strings.Join(out, ":"), nil
+}
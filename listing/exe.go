@@ -0,0 +1,189 @@
+package listing
+
+import (
+	"bufio"
+	"debug/buildinfo"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// What an executable is, for -exe.
+type exeInfo struct {
+	Format      string   `json:"format"`                // ELF, PE, Mach-O, or script.
+	Arch        []string `json:"arch,omitempty"`        // More than one for universal Mach-O binaries.
+	Linkage     string   `json:"linkage,omitempty"`     // static or dynamic; not for PE.
+	Interpreter string   `json:"interpreter,omitempty"` // Dynamic loader for ELF, or the #! line for scripts.
+	Go          string   `json:"go,omitempty"`          // Go version from the build info.
+}
+
+// Format for the -exe column, e.g. "ELF amd64 dynamic go1.24.1" or
+// "#!/bin/sh".
+func (e exeInfo) String() string {
+	if e.Format == "script" {
+		return "#!" + e.Interpreter
+	}
+	s := []string{e.Format}
+	if len(e.Arch) > 0 {
+		s = append(s, strings.Join(e.Arch, "+"))
+	}
+	if e.Linkage != "" {
+		s = append(s, e.Linkage)
+	}
+	if e.Go != "" {
+		s = append(s, e.Go)
+	}
+	return strings.Join(s, " ")
+}
+
+// Report if fi is an executable that -exe can show details for.
+func (v *vfs) isExe(absdir string, fi fs.FileInfo) bool {
+	return fi.Mode()&0o111 != 0 && v.hasContents(absdir, fi)
+}
+
+// Get what the executable fi in absdir is. It returns nil if it's not a binary
+// or script.
+func (v *vfs) exe(absdir string, fi fs.FileInfo) (*exeInfo, error) {
+	k := cacheKey(absdir, fi)
+	if e, ok := v.exes.get(k); ok {
+		return e, nil
+	}
+
+	p := filepath.Join(absdir, fi.Name())
+	fp, err := v.open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	r, ok := fp.(io.ReaderAt)
+	if !ok {
+		return nil, fmt.Errorf("%s: can't read executable: no ReadAt", p)
+	}
+
+	var magic [4]byte
+	if _, err := r.ReadAt(magic[:], 0); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	var e *exeInfo
+	switch b := magic[:]; {
+	case string(b[:2]) == "#!":
+		line, _ := bufio.NewReader(io.NewSectionReader(r, 2, 1024)).ReadString('\n')
+		e = &exeInfo{Format: "script", Interpreter: strings.TrimSpace(line)}
+	case string(b) == "\x7fELF":
+		e, err = elfInfo(r)
+	case string(b[:2]) == "MZ":
+		e, err = peInfo(r)
+	case isMachO(append(b, 0, 0, 0, 0)):
+		e, err = machoInfo(r)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+	if e != nil && e.Format != "script" {
+		if bi, err := buildinfo.Read(r); err == nil {
+			e.Go = bi.GoVersion
+		}
+	}
+	v.exes.set(k, e)
+	return e, nil
+}
+
+// Architecture names as in GOARCH.
+var (
+	elfArch = map[elf.Machine]string{
+		elf.EM_386:       "386",
+		elf.EM_X86_64:    "amd64",
+		elf.EM_ARM:       "arm",
+		elf.EM_AARCH64:   "arm64",
+		elf.EM_RISCV:     "riscv64",
+		elf.EM_PPC:       "ppc",
+		elf.EM_PPC64:     "ppc64",
+		elf.EM_S390:      "s390x",
+		elf.EM_MIPS:      "mips",
+		elf.EM_LOONGARCH: "loong64",
+		elf.EM_SPARCV9:   "sparc64",
+	}
+	peArch = map[uint16]string{
+		pe.IMAGE_FILE_MACHINE_I386:  "386",
+		pe.IMAGE_FILE_MACHINE_AMD64: "amd64",
+		pe.IMAGE_FILE_MACHINE_ARMNT: "arm",
+		pe.IMAGE_FILE_MACHINE_ARM64: "arm64",
+	}
+	machoArch = map[macho.Cpu]string{
+		macho.Cpu386:   "386",
+		macho.CpuAmd64: "amd64",
+		macho.CpuArm:   "arm",
+		macho.CpuArm64: "arm64",
+		macho.CpuPpc:   "ppc",
+		macho.CpuPpc64: "ppc64",
+	}
+)
+
+func archName[T comparable](m map[T]string, k T) string {
+	if a, ok := m[k]; ok {
+		return a
+	}
+	return strings.ToLower(strings.TrimPrefix(fmt.Sprint(k), "EM_"))
+}
+
+func elfInfo(r io.ReaderAt) (*exeInfo, error) {
+	f, err := elf.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+	arch := archName(elfArch, f.Machine)
+	if f.Machine == elf.EM_PPC64 && f.ByteOrder.String() == "LittleEndian" {
+		arch += "le"
+	}
+	e := &exeInfo{Format: "ELF", Arch: []string{arch}, Linkage: "static"}
+	for _, p := range f.Progs {
+		if p.Type == elf.PT_INTERP {
+			b, err := io.ReadAll(p.Open())
+			if err != nil {
+				return nil, err
+			}
+			e.Linkage, e.Interpreter = "dynamic", strings.TrimRight(string(b), "\x00")
+			break
+		}
+	}
+	return e, nil
+}
+
+func peInfo(r io.ReaderAt) (*exeInfo, error) {
+	f, err := pe.NewFile(r)
+	if err != nil {
+		// DOS executables and other files starting with "MZ".
+		return nil, nil
+	}
+	return &exeInfo{Format: "PE", Arch: []string{archName(peArch, f.Machine)}}, nil
+}
+
+func machoInfo(r io.ReaderAt) (*exeInfo, error) {
+	var files []*macho.File
+	if fat, err := macho.NewFatFile(r); err == nil {
+		for _, a := range fat.Arches {
+			files = append(files, a.File)
+		}
+	} else {
+		f, err := macho.NewFile(r)
+		if err != nil {
+			return nil, err
+		}
+		files = []*macho.File{f}
+	}
+
+	e := &exeInfo{Format: "Mach-O", Linkage: "static"}
+	for _, f := range files {
+		e.Arch = append(e.Arch, archName(machoArch, f.Cpu))
+		if libs, _ := f.ImportedLibraries(); len(libs) > 0 {
+			e.Linkage = "dynamic"
+		}
+	}
+	return e, nil
+}
@@ -0,0 +1,247 @@
+package listing
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"zgo.at/elles/os2"
+)
+
+// Filter entries with find-like predicates; all predicates must match.
+type filter []func(absdir string, fi fs.FileInfo) bool
+
+func (f filter) match(absdir string, fi fs.FileInfo) bool {
+	for _, ff := range f {
+		if !ff(absdir, fi) {
+			return false
+		}
+	}
+	return true
+}
+
+// Create a new filter from the flag values; empty values are skipped.
+func newFilter(v *vfs, types, size, newer, perm, timeField string, empty, dirsOnly, filesOnly bool) (filter, error) {
+	if dirsOnly && filesOnly {
+		return nil, errors.New("can't use -dirs-only and -files-only together")
+	}
+	var f filter
+	if types != "" {
+		ff, err := filterType(types)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for -type: %w", err)
+		}
+		f = append(f, ff)
+	}
+	if size != "" {
+		ff, err := filterSize(size)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for -filesize: %w", err)
+		}
+		f = append(f, ff)
+	}
+	if newer != "" {
+		ff, err := filterNewer(newer, timeField, time.Now())
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for -newer: %w", err)
+		}
+		f = append(f, ff)
+	}
+	if perm != "" {
+		ff, err := filterPerm(perm)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for -perm: %w", err)
+		}
+		f = append(f, ff)
+	}
+	if empty {
+		f = append(f, v.filterEmpty)
+	}
+	if dirsOnly || filesOnly {
+		f = append(f, func(absdir string, fi fs.FileInfo) bool { return v.isDir(absdir, fi) == dirsOnly })
+	}
+	return f, nil
+}
+
+// Get the file type as a letter, as in find -type.
+func fileType(fi fs.FileInfo) byte {
+	switch m := fi.Mode(); {
+	case m.IsDir():
+		return 'd'
+	case m&fs.ModeSymlink != 0:
+		return 'l'
+	case m&fs.ModeNamedPipe != 0:
+		return 'p'
+	case m&fs.ModeSocket != 0:
+		return 's'
+	case m&fs.ModeCharDevice != 0:
+		return 'c'
+	case m&fs.ModeDevice != 0:
+		return 'b'
+	case os2.IsDoor(fi):
+		return 'D'
+	default:
+		return 'f'
+	}
+}
+
+// -type=f,l
+func filterType(v string) (func(string, fs.FileInfo) bool, error) {
+	var want []byte
+	for _, t := range strings.Split(v, ",") {
+		if len(t) != 1 || !strings.Contains("fdlpscbD", t) {
+			return nil, fmt.Errorf("unknown type %q; must be one of f, d, l, p, s, c, b, or D", t)
+		}
+		want = append(want, t[0])
+	}
+	return func(_ string, fi fs.FileInfo) bool {
+		t := fileType(fi)
+		for _, w := range want {
+			if w == t {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// -filesize=+100M, -filesize=-1k, -filesize=0
+func filterSize(v string) (func(string, fs.FileInfo) bool, error) {
+	n, cmp, err := parseSize(v)
+	if err != nil {
+		return nil, err
+	}
+	return func(_ string, fi fs.FileInfo) bool {
+		switch s := fi.Size(); cmp {
+		case '+':
+			return s > n
+		case '-':
+			return s < n
+		default:
+			return s == n
+		}
+	}, nil
+}
+
+// Parse a size with an optional +/- prefix and unit suffix (powers of 1024).
+func parseSize(v string) (int64, byte, error) {
+	var cmp byte
+	if strings.HasPrefix(v, "+") || strings.HasPrefix(v, "-") {
+		cmp, v = v[0], v[1:]
+	}
+	i := strings.IndexFunc(v, func(r rune) bool { return !unicode.IsDigit(r) && r != '.' })
+	if i == -1 {
+		i = len(v)
+	}
+	n, err := strconv.ParseFloat(v[:i], 64)
+	if err != nil || n < 0 {
+		return 0, 0, fmt.Errorf("not a size: %q", v)
+	}
+	mult := float64(1)
+	switch strings.ToUpper(v[i:]) {
+	case "", "C", "B":
+	case "K", "KB", "KIB":
+		mult = 1 << 10
+	case "M", "MB", "MIB":
+		mult = 1 << 20
+	case "G", "GB", "GIB":
+		mult = 1 << 30
+	case "T", "TB", "TIB":
+		mult = 1 << 40
+	default:
+		return 0, 0, fmt.Errorf("unknown unit %q in %q; must be K, M, G, or T", v[i:], v)
+	}
+	return int64(n * mult), cmp, nil
+}
+
+// -newer=2d, -newer=2006-01-02, -newer=file
+func filterNewer(v, timeField string, now time.Time) (func(string, fs.FileInfo) bool, error) {
+	t, err := parseNewer(v, timeField, now)
+	if err != nil {
+		return nil, err
+	}
+	return func(absdir string, fi fs.FileInfo) bool {
+		return getTime(absdir, fi, timeField).After(t)
+	}, nil
+}
+
+// Parse a duration ago (with d and w as days and weeks), a date, or the time
+// of a file.
+func parseNewer(v, timeField string, now time.Time) (time.Time, error) {
+	if n, unit := strings.TrimRight(v, "dw"), v[len(strings.TrimRight(v, "dw")):]; len(unit) == 1 {
+		if d, err := strconv.Atoi(n); err == nil {
+			if unit == "w" {
+				d *= 7
+			}
+			return now.AddDate(0, 0, -d), nil
+		}
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return now.Add(-d), nil
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04", "2006-01-02 15:04:05", "2006-01-02T15:04", "2006-01-02T15:04:05", time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, v, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	fi, err := os.Stat(v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("not a duration, date, or file: %q", v)
+	}
+	ad, err := filepath.Abs(filepath.Dir(v))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return getTime(ad, fi, timeField), nil
+}
+
+// -perm=644 (exact), -perm=-644 (all bits set), -perm=/111 (any bit set)
+func filterPerm(v string) (func(string, fs.FileInfo) bool, error) {
+	var cmp byte
+	if strings.HasPrefix(v, "-") || strings.HasPrefix(v, "/") {
+		cmp, v = v[0], v[1:]
+	}
+	n, err := strconv.ParseUint(v, 8, 32)
+	if err != nil || n > 0o7777 {
+		return nil, fmt.Errorf("not an octal mode: %q", v)
+	}
+	want := fs.FileMode(n)
+	return func(_ string, fi fs.FileInfo) bool {
+		switch p := unixPerm(fi.Mode()); cmp {
+		case '-':
+			return p&want == want
+		case '/':
+			return want == 0 || p&want != 0
+		default:
+			return p == want
+		}
+	}, nil
+}
+
+// -empty: empty regular files and directories.
+func (v *vfs) filterEmpty(absdir string, fi fs.FileInfo) bool {
+	switch {
+	case fi.Mode().IsRegular():
+		return fi.Size() == 0
+	case fi.IsDir():
+		if v.virtual(absdir) {
+			ls, err := v.readDir(filepath.Join(absdir, fi.Name()))
+			return err == nil && len(ls) == 0
+		}
+		fp, err := os.Open(filepath.Join(absdir, fi.Name()))
+		if err != nil {
+			return false
+		}
+		defer fp.Close()
+		_, err = fp.Readdirnames(1)
+		return err == io.EOF
+	}
+	return false
+}
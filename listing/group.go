@@ -0,0 +1,148 @@
+package listing
+
+import (
+	"cmp"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Split every printable in groups for -group; the order of the entries in the
+// groups is retained.
+func groupBy(toPrint []printable, opt Options, now time.Time) []printable {
+	var (
+		label func(p printable, fi fileInfo) string
+		order func(a, b string) int
+	)
+	switch opt.GroupBy {
+	case "type":
+		label = func(p printable, fi fileInfo) string { return typeGroup(opt.vfs, p.absdir, fi) }
+		order = listOrder(typeGroups)
+	case "ext", "extension":
+		label = func(p printable, fi fileInfo) string {
+			if opt.vfs.isDir(p.absdir, fi) {
+				return "Directories"
+			}
+			if ext := filepath.Ext(fi.Name()); ext != "" && ext != fi.Name() {
+				return strings.ToLower(ext)
+			}
+			return "No extension"
+		}
+		order = func(a, b string) int {
+			rank := func(l string) int {
+				switch l {
+				case "Directories":
+					return 0
+				case "No extension":
+					return 2
+				}
+				return 1
+			}
+			return cmp.Or(cmp.Compare(rank(a), rank(b)), cmp.Compare(a, b))
+		}
+	case "day", "date", "time":
+		label = func(p printable, fi fileInfo) string { return dayGroup(getTime(p.absdir, fi, opt.TimeField), now) }
+		order = listOrder(dayGroups)
+	case "owner", "user":
+		label = func(p printable, fi fileInfo) string {
+			u, _ := opt.vfs.owner(p.absdir, fi, opt.NumericUID)
+			return u
+		}
+		order = cmp.Compare[string]
+	default:
+		return toPrint
+	}
+
+	grouped := make([]printable, 0, len(toPrint))
+	for _, p := range toPrint {
+		if len(p.fi) == 0 { // Keep empty directories for -R.
+			grouped = append(grouped, p)
+			continue
+		}
+		var (
+			labels []string
+			groups = make(map[string][]fileInfo)
+		)
+		for _, fi := range p.fi {
+			l := label(p, fi)
+			if _, ok := groups[l]; !ok {
+				labels = append(labels, l)
+			}
+			groups[l] = append(groups[l], fi)
+		}
+		slices.SortFunc(labels, order)
+		for i, l := range labels {
+			g := p
+			g.group, g.fi = l, groups[l]
+			if i > 0 { // Count skipped entries only once for -total.
+				g.hidden, g.filtered = 0, 0
+			}
+			grouped = append(grouped, g)
+		}
+	}
+	return grouped
+}
+
+// Sort the labels in the order they appear in the list.
+func listOrder(list []string) func(a, b string) int {
+	return func(a, b string) int { return cmp.Compare(slices.Index(list, a), slices.Index(list, b)) }
+}
+
+var typeGroups = []string{"Directories", "Symlinks", "Executables", "Files",
+	"FIFOs", "Sockets", "Block devices", "Character devices", "Doors"}
+
+func typeGroup(v *vfs, absdir string, fi fs.FileInfo) string {
+	switch fileType(fi) {
+	case 'd':
+		return "Directories"
+	case 'l':
+		if v.isDir(absdir, fi) {
+			return "Directories"
+		}
+		return "Symlinks"
+	case 'p':
+		return "FIFOs"
+	case 's':
+		return "Sockets"
+	case 'b':
+		return "Block devices"
+	case 'c':
+		return "Character devices"
+	case 'D':
+		return "Doors"
+	}
+	if fi.Mode()&0o111 != 0 {
+		return "Executables"
+	}
+	return "Files"
+}
+
+var dayGroups = []string{"In the future", "Today", "Yesterday", "Past week",
+	"Past month", "Past year", "Older"}
+
+// Get the group for -group=day; everything except "Today" and "Yesterday" is
+// relative to the current date, rather than calendar weeks and months.
+func dayGroup(t, now time.Time) string {
+	var (
+		y, m, d = now.Date()
+		today   = time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	)
+	switch {
+	case t.After(now):
+		return "In the future"
+	case !t.Before(today):
+		return "Today"
+	case !t.Before(today.AddDate(0, 0, -1)):
+		return "Yesterday"
+	case !t.Before(today.AddDate(0, 0, -7)):
+		return "Past week"
+	case !t.Before(today.AddDate(0, -1, 0)):
+		return "Past month"
+	case !t.Before(today.AddDate(-1, 0, 0)):
+		return "Past year"
+	default:
+		return "Older"
+	}
+}
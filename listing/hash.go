@@ -0,0 +1,181 @@
+package listing
+
+import (
+	"bufio"
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+func newHash(alg string) hash.Hash {
+	if alg == "sha256" {
+		return sha256.New()
+	}
+	return xxhash.New()
+}
+
+// Report if fi has contents to hash or sniff; only regular files outside of
+// archives have contents to read.
+func (v *vfs) hasContents(absdir string, fi fs.FileInfo) bool {
+	return fi.Mode().IsRegular() && !v.inArchive(absdir)
+}
+
+// Get the hash of the contents of the file fi in absdir as hex, with the
+// algorithm alg (xxhash or sha256).
+func (v *vfs) hash(absdir string, fi fs.FileInfo, alg string) (string, error) {
+	k := alg + "\x00" + cacheKey(absdir, fi)
+	if h, ok := v.hashes.get(k); ok {
+		return h, nil
+	}
+
+	p := filepath.Join(absdir, fi.Name())
+	fp, err := v.open(p)
+	if err != nil {
+		return "", err
+	}
+	defer fp.Close()
+	hh := newHash(alg)
+	if _, err := io.Copy(hh, fp); err != nil {
+		return "", fmt.Errorf("hashing %s: %w", p, err)
+	}
+	h := hex.EncodeToString(hh.Sum(nil))
+	v.hashes.set(k, h)
+	return h, nil
+}
+
+// Read all files in toPrint in parallel with read, which should cache what it
+// reads so that getCols and printJSON can use it.
+func (v *vfs) readAll(toPrint []printable, errs *errGroup, read func(absdir string, fi fs.FileInfo) error) {
+	type job struct {
+		absdir string
+		fi     fs.FileInfo
+	}
+	var jobs []job
+	for _, p := range toPrint {
+		for _, fi := range p.fi {
+			if ad := cmp.Or(fi.filepathAbs, p.absdir); v.hasContents(ad, fi) {
+				jobs = append(jobs, job{ad, fi})
+			}
+		}
+	}
+
+	var (
+		wg sync.WaitGroup
+		ch = make(chan job)
+	)
+	for range min(runtime.GOMAXPROCS(0), len(jobs)) {
+		wg.Go(func() {
+			for j := range ch {
+				errs.Append(read(j.absdir, j.fi))
+			}
+		})
+	}
+	for _, j := range jobs {
+		ch <- j
+	}
+	close(ch)
+	wg.Wait()
+}
+
+// Dupes lists the files with identical contents in paths, grouped by their
+// contents. Only files with the same size are hashed; the hash is sha256 unless
+// Hash is set. Empty files aren't listed.
+//
+// All entries are listed with their path, and Recurse can be used to find
+// duplicates in subdirectories. Errors are returned as with List.
+func (l Lister) Dupes(paths ...string) error {
+	opt, err := l.prepare()
+	if err != nil {
+		return err
+	}
+	if opt.JSON {
+		return errors.New("can't use -json with -dupes")
+	}
+	opt.Directory, opt.nostat, opt.GroupBy = false, false, ""
+	alg := cmp.Or(opt.Hash, "sha256")
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	// Only files with the same size can have the same contents.
+	var (
+		errs   = &errGroup{MaxSize: 100}
+		bySize = make(map[int64][]fileInfo)
+	)
+	for _, p := range gather(slices.Values(paths), errs, opt) {
+		for _, fi := range p.fi {
+			if fi.filepathAbs == "" {
+				fi.filepath, fi.filepathAbs = p.dir, p.absdir
+			}
+			if fi.Size() > 0 && opt.vfs.hasContents(fi.filepathAbs, fi) {
+				bySize[fi.Size()] = append(bySize[fi.Size()], fi)
+			}
+		}
+	}
+	var candidates printable
+	for _, fis := range bySize {
+		if len(fis) > 1 {
+			candidates.fi = append(candidates.fi, fis...)
+		}
+	}
+	opt.vfs.readAll([]printable{candidates}, errs, func(absdir string, fi fs.FileInfo) error {
+		_, err := opt.vfs.hash(absdir, fi, alg)
+		return err
+	})
+
+	type key struct {
+		size int64
+		hash string
+	}
+	byHash := make(map[key][]fileInfo)
+	for _, fi := range candidates.fi {
+		h, err := opt.vfs.hash(fi.filepathAbs, fi, alg)
+		if err != nil { // Already reported by readAll().
+			continue
+		}
+		k := key{fi.Size(), h}
+		byHash[k] = append(byHash[k], fi)
+	}
+	keys := make([]key, 0, len(byHash))
+	for k, fis := range byHash {
+		if len(fis) > 1 {
+			keys = append(keys, k)
+		}
+	}
+	// Largest first, as that's where the most space is to be gained.
+	slices.SortFunc(keys, func(a, b key) int { return cmp.Or(cmp.Compare(b.size, a.size), cmp.Compare(a.hash, b.hash)) })
+
+	toPrint := make([]printable, 0, len(keys))
+	for _, k := range keys {
+		slices.SortFunc(byHash[k], func(a, b fileInfo) int {
+			return cmp.Compare(filepath.Join(a.filepath, a.Name()), filepath.Join(b.filepath, b.Name()))
+		})
+		s, _ := listSize(byHash[k][0], byHash[k][0].filepathAbs, opt.BlockSize, opt.Comma, false, false)
+		toPrint = append(toPrint, printable{
+			isFiles: true,
+			group:   fmt.Sprintf("%d × %s (%s %s)", len(byHash[k]), strings.TrimSpace(s), alg, k.hash[:12]),
+			fi:      byHash[k],
+		})
+	}
+	// Always show the full path; normally paths from -R aren't shown with the
+	// directory.
+	opt.Recurse = false
+	w := bufio.NewWriter(l.Out)
+	draw(w, toPrint, opt)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return errors.Join(errs.List()...)
+}
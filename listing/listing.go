@@ -0,0 +1,835 @@
+// Package listing lists directories, as elles does.
+//
+// The elles commandline tool is a wrapper around this, but a Lister can list
+// any fs.FS, such as an embed.FS or fstest.MapFS:
+//
+//	l := listing.Lister{FS: fsys, Out: os.Stdout}
+//	l.Long = 1
+//	err := l.List(".")
+package listing
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"iter"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"zgo.at/elles/os2"
+)
+
+// Options for a listing. Most fields correspond to a commandline flag; see
+// "elles -help" for details. The zero value lists the entries one per line,
+// sorted by name.
+type Options struct {
+	// What to list.
+	All       bool // Include hidden entries (-a).
+	Directory bool // List directories themselves rather than their contents (-d).
+	Recurse   bool // List subdirectories recursively (-R).
+	DerefArgs bool // Follow symlinks in the paths given to List (-H).
+	DerefAll  bool // Follow all symlinks (-L).
+	DirSize   bool // Get the total size of directories (-D).
+
+	// Only list entries matching all of these; see the -type, -filesize,
+	// -newer, -perm, -empty, -dirs-only, and -files-only flags.
+	Type, FileSize, Newer, Perm string
+	Empty, DirsOnly, FilesOnly  bool
+
+	// How to list it.
+	JSON        bool   // Write JSON instead (-j).
+	Long        int    // Long listing level (-l, -ll, -lll).
+	One         bool   // One entry per line (-1).
+	Cols        bool   // Use columns, even with One or List (-C).
+	Width       int    // Width to fill with columns, and to trim to with Trim.
+	MaxColWidth int    // Trim columns to this width (-width).
+	MinCols     int    // Trim columns to fit this many columns (-min).
+	Trim        bool   // Trim lines to Width (-trim).
+	Hyperlink   bool   // Link filenames with OSC 8 escapes (-hyperlink).
+	Classify    bool   // Append type indicators (-F).
+	DirSlash    bool   // Append / to directories (-p).
+	Inode       bool   // Show inode numbers (-i).
+	NumericUID  bool   // Show user and group IDs rather than names (-n).
+	Group       bool   // Show the group name (-g).
+	Octal       bool   // Show permissions in octal (-o).
+	NoExt       bool   // Don't show file extensions (-e).
+	Comma       bool   // Group digits with commas (-,).
+	Total       bool   // Show totals for every directory (-total).
+	Bar         bool   // Show each entry's share of the directory size (-bar).
+	Hash        string // Show a hash of the contents of files: "xxhash" or "sha256" (-hash).
+	Sniff       bool   // Show and colour by the content type of files (-sniff).
+	Exe         bool   // Show the format and architecture of executables (-exe).
+	Text        bool   // Show line counts, line endings, and encoding of files (-text).
+	Quote       int    // Quote level (-Q).
+	FullTime    int    // Time format level (-T).
+	BlockSize   string // Size format (-B); the default is "h".
+	TimeField   string // Time to show and sort by: "mtime" (default), "btime", or "atime".
+
+	// Colours to use; nil to not colour anything (-color). Use LoadColors to
+	// load them from the environment.
+	Colors *Colors
+
+	// Always pad the default "h" sizes to 5 columns, so the width doesn't
+	// depend on the file sizes; mostly useful for tests.
+	FixedSizeWidth bool
+
+	// How to order it.
+	Sort      string // name (default), size, time, version, ext, width, none.
+	Reverse   bool   // Reverse the sort order (-r).
+	DirsFirst bool   // Directories before files (-group-dirs).
+	GroupBy   string // Split in groups: type, ext, day, owner (-group).
+
+	// Set by Lister.prepare().
+	vfs      *vfs
+	filt     filter
+	nostat   bool
+	hostname string // For Hyperlink.
+
+	highlight map[string]bool // Paths to highlight, for Watch.
+}
+
+// Lister lists paths in FS to Out.
+type Lister struct {
+	Options
+	FS  fs.FS     // Filesystem to list; the OS filesystem is used if nil.
+	Out io.Writer // Write the listing here.
+}
+
+// List the paths; "." is listed if there are no paths.
+//
+// The listing is still written if some entries can't be read, and the errors
+// for those are returned as a joined error (see errors.Join). With JSON the
+// errors are in the output and nil is returned.
+func (l Lister) List(paths ...string) error {
+	opt, err := l.prepare()
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	errs := &errGroup{MaxSize: 100}
+	return l.write(gather(slices.Values(paths), errs, opt), errs, opt)
+}
+
+// ListFrom lists the paths read from r, separated by sep (usually a newline or
+// NUL byte). The paths are listed as files, as with Directory, and can contain
+// any byte other than sep.
+//
+// The paths are read as they're listed, so r doesn't need to fit in memory
+// (the listing does). Errors are returned as with List.
+func (l Lister) ListFrom(r io.Reader, sep byte) error {
+	opt, err := l.prepare()
+	if err != nil {
+		return err
+	}
+	opt.Directory = true
+
+	scan := bufio.NewScanner(r)
+	scan.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if i := bytes.IndexByte(data, sep); i >= 0 {
+			return i + 1, data[:i], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	})
+	paths := func(yield func(string) bool) {
+		for scan.Scan() {
+			if p := scan.Text(); p != "" && !yield(p) {
+				return
+			}
+		}
+	}
+
+	errs := &errGroup{MaxSize: 100}
+	toPrint := gather(paths, errs, opt)
+	if err := scan.Err(); err != nil {
+		return err
+	}
+	return l.write(toPrint, errs, opt)
+}
+
+func (l Lister) write(toPrint []printable, errs *errGroup, opt Options) error {
+	order(toPrint, opt)
+	toPrint = groupBy(toPrint, opt, time.Now())
+	if opt.Hash != "" || opt.Text {
+		opt.vfs.readAll(toPrint, errs, func(absdir string, fi fs.FileInfo) error {
+			if opt.Hash != "" {
+				if _, err := opt.vfs.hash(absdir, fi, opt.Hash); err != nil {
+					return err
+				}
+			}
+			if opt.Text {
+				if _, err := opt.vfs.textStats(absdir, fi); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	w := bufio.NewWriter(l.Out)
+	if opt.JSON {
+		if err := printJSON(w, toPrint, errs, opt); err != nil {
+			return err
+		}
+		return w.Flush()
+	}
+	draw(w, toPrint, opt)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return errors.Join(errs.List()...)
+}
+
+// Validate the options and set the defaults.
+func (l Lister) prepare() (Options, error) {
+	opt := l.Options
+	opt.vfs = &vfs{fsys: l.FS}
+	if opt.Colors == nil {
+		opt.Colors = &Colors{}
+	}
+	if opt.Hyperlink {
+		h, _ := os.Hostname()
+		opt.hostname = esc(h)
+	}
+	opt.Sort, opt.TimeField = cmp.Or(opt.Sort, "name"), cmp.Or(opt.TimeField, "mtime")
+	if opt.Bar {
+		opt.DirSize = true
+	}
+
+	switch opt.Sort {
+	case "name", "none", "none-all", "size", "time", "version", "ext", "extension", "width":
+	default:
+		return opt, fmt.Errorf("invalid value for -sort: %q", opt.Sort)
+	}
+	switch opt.Hash {
+	case "", "xxhash", "sha256":
+	default:
+		return opt, fmt.Errorf("invalid value for -hash: %q", opt.Hash)
+	}
+	switch opt.GroupBy {
+	case "", "type", "ext", "extension", "day", "date", "time", "owner", "user":
+	default:
+		return opt, fmt.Errorf("invalid value for -group: %q", opt.GroupBy)
+	}
+	switch opt.TimeField {
+	case "mtime", "btime", "atime":
+	default:
+		return opt, fmt.Errorf("invalid time field: %q", opt.TimeField)
+	}
+
+	var err error
+	opt.filt, err = newFilter(opt.vfs, opt.Type, opt.FileSize, opt.Newer, opt.Perm, opt.TimeField,
+		opt.Empty, opt.DirsOnly, opt.FilesOnly)
+	if err != nil {
+		return opt, err
+	}
+
+	// Don't need to stat if we only need the names. Colours depend on the
+	// permission bits and link count, so need to stat for that as well (reset
+	// is only set if colours are enabled).
+	opt.nostat = opt.Long == 0 && !opt.Classify && !opt.Inode && !opt.JSON && opt.Colors.reset == "" &&
+		opt.Sort != "size" && opt.Sort != "time" && opt.GroupBy == "" &&
+		len(opt.filt) == 0 && !opt.Total && !opt.Bar && opt.Hash == "" && !opt.Sniff && !opt.Exe && !opt.Text
+	return opt, nil
+}
+
+type (
+	printable struct {
+		dir     string // Belongs in dir; can be empty.
+		absdir  string
+		isFiles bool
+		group   string // Group label for -group; empty if not grouped.
+		fi      []fileInfo
+
+		hidden, filtered int // Number of entries skipped because they're hidden or filtered.
+	}
+	fileInfo struct {
+		fs.FileInfo
+		filepath, filepathAbs string
+	}
+)
+
+func draw(w io.Writer, toPrint []printable, opt Options) {
+	var (
+		sameDir         = func(a, b printable) bool { return a.dir == b.dir && a.isFiles == b.isFiles }
+		multi           bool
+		grand, dirTotal summary
+	)
+	for _, p := range toPrint {
+		multi = multi || !sameDir(p, toPrint[0])
+	}
+	for i, p := range toPrint {
+		// Print directory headers, and group headers for -group.
+		dirHeader := multi && p.dir != "" && (i == 0 || !sameDir(p, toPrint[i-1]))
+		if i > 0 && (dirHeader || p.group != "") {
+			fmt.Fprintln(w)
+		}
+		if dirHeader {
+			fmt.Fprintln(w, filepath.ToSlash(filepath.Clean(p.dir))+":")
+		}
+		if p.group != "" {
+			fmt.Fprintln(w, p.group+":")
+		}
+
+		// Format for output in memory first. This makes alignment much easier
+		// because we may or may not add things such as "/". Even with very
+		// large directories it shouldn't take more than a few hundred K.
+		cc := getCols(p, opt)
+
+	refmt:
+		fmtRows, widths, longest := cc.format(opt.MaxColWidth)
+
+	one:
+		if (opt.One && !opt.Cols) || (opt.Long > 0 && !opt.Cols) {
+			for i, f := range fmtRows {
+				if opt.Width > 0 && opt.Trim && widths[i] > opt.Width {
+					f, _ = trimWidth(f, opt.Width-1)
+					f += opt.Colors.reset + "…"
+				}
+				fmt.Fprintln(w, f)
+			}
+		} else {
+			var (
+				colwidths []int
+				rows      [][]string
+				pad       = 2
+			)
+			if opt.Long > 0 {
+				pad = 4
+			}
+			for i := range 200 {
+				if i == 0 {
+					continue
+				}
+				r, cw := recol(fmtRows, widths, i, pad)
+				if sum(cw) > opt.Width {
+					if i <= 1 {
+						rows, colwidths = r, cw
+					}
+					break
+				}
+				rows, colwidths = r, cw
+			}
+			if opt.MinCols > 0 && len(colwidths) < opt.MinCols {
+				if opt.MaxColWidth == 0 {
+					opt.MaxColWidth = longest - 1
+				} else {
+					opt.MaxColWidth--
+				}
+				goto refmt
+			}
+
+			// Only space for one column; restart as if -1 was set. Saves some
+			// special-fu here.
+			if len(colwidths) == 1 {
+				opt.One, opt.Cols = true, false
+				goto one
+			}
+
+			for i, r := range rows {
+				for j, c := range r {
+					x := i + len(rows)*j
+					if opt.Long > 0 && j != len(r)-1 {
+						fmt.Fprint(w, c, strings.Repeat(" ", colwidths[j]-widths[x]-2))
+						fmt.Fprint(w, "┃ ")
+					} else {
+						fmt.Fprint(w, c)
+						if j != len(r)-1 {
+							fmt.Fprint(w, strings.Repeat(" ", colwidths[j]-widths[x]))
+						}
+					}
+				}
+				fmt.Fprintln(w)
+			}
+		}
+
+		// ls prints the total at the top, but printing it at the bottom makes
+		// much more sense to me.
+		if opt.Total {
+			sum := summarize(p, opt.DirSize)
+			if p.group != "" {
+				sub := sum
+				sub.Hidden, sub.Filtered = 0, 0 // Only in the directory total.
+				fmt.Fprintln(w, "Subtotal:", sub.format(opt.BlockSize, opt.Comma))
+			}
+			dirTotal.add(sum)
+			if i == len(toPrint)-1 || !sameDir(p, toPrint[i+1]) {
+				fmt.Fprintln(w, "Total:", dirTotal.format(opt.BlockSize, opt.Comma))
+				grand.add(dirTotal)
+				dirTotal = summary{}
+			}
+		}
+	}
+	if opt.Total && multi {
+		fmt.Fprintln(w, "\nGrand total:", grand.format(opt.BlockSize, opt.Comma))
+	}
+}
+
+// Format all rows as a string, aligning the columns. Rows longer than
+// maxColWidth are trimmed.
+func (cc cols) format(maxColWidth int) ([]string, []int, int) {
+	var (
+		fmtRows = make([]string, 0, len(cc.rows))
+		widths  = make([]int, 0, len(cc.rows))
+		longest int
+		buf     strings.Builder
+		w       int
+	)
+	for _, r := range cc.rows {
+		buf.Reset()
+		w = 0
+		for i, c := range r {
+			if i > 0 {
+				buf.WriteString(" ")
+				w++
+			}
+
+			if c.prop&borderToLeft != 0 {
+				buf.WriteString("│ ")
+				w += 2
+			}
+			if c.prop&alignNone != 0 {
+				w += c.w
+				buf.WriteString(c.s)
+			} else if c.prop&alignLeft != 0 {
+				pad := cc.longest[i] - c.w
+				buf.WriteString(c.s)
+				buf.WriteString(strings.Repeat(" ", pad))
+				w += c.w + pad
+			} else {
+				pad := cc.longest[i] - c.w
+				buf.WriteString(strings.Repeat(" ", pad))
+				buf.WriteString(c.s)
+				w += c.w + pad
+			}
+		}
+
+		b := buf.String()
+		if maxColWidth > 0 && w > maxColWidth {
+			b, w = trimWidth(b, maxColWidth-1)
+			b += cc.reset + "…"
+			w++
+		}
+		fmtRows, widths = append(fmtRows, b), append(widths, w)
+		if w > longest {
+			longest = w
+		}
+	}
+	return fmtRows, widths, longest
+}
+
+type fakeFileinfo struct{ sz int64 }
+
+func (f fakeFileinfo) Name() string       { return "" }
+func (f fakeFileinfo) Size() int64        { return f.sz }
+func (f fakeFileinfo) Mode() fs.FileMode  { return 0 }
+func (f fakeFileinfo) ModTime() time.Time { return time.Time{} }
+func (f fakeFileinfo) IsDir() bool        { return false }
+func (f fakeFileinfo) Sys() any           { return nil }
+
+func recol(paths []string, pathWidths []int, ncols, pad int) ([][]string, []int) {
+	var (
+		rows   = make([][]string, 0, 8)
+		widths = make([]int, ncols)
+		height = int(math.Ceil(float64(len(paths)) / float64(ncols)))
+	)
+	for i := range height {
+		row := make([]string, 0, ncols)
+		for c := range ncols {
+			j := i + height*c
+			if j > len(paths)-1 {
+				break
+			}
+
+			l := pathWidths[j]
+			if c < ncols-1 {
+				l += pad
+			}
+			if l > widths[c] {
+				widths[c] = l
+			}
+			row = append(row, paths[j])
+		}
+		rows = append(rows, row)
+	}
+	if i := slices.Index(widths, 0); i > -1 {
+		widths = widths[:i]
+	}
+	return rows, widths
+}
+
+func sum(s []int) int {
+	var n int
+	for _, ss := range s {
+		n += ss
+	}
+	return n
+}
+
+// Gather list of everything we want to print.
+func gather(args iter.Seq[string], errs *errGroup, opt Options) []printable {
+	var (
+		toPrint    = make([]printable, 0, 16)
+		filesIndex = -1 // index in toPrint for individual files.
+		v          = opt.vfs
+		statArg    = v.lstat
+	)
+	if opt.DerefArgs {
+		statArg = v.stat
+	}
+	v.errs = errs
+	//cwd, err := os.Getwd()
+	//errs.Append(err)
+
+	// Archives are listed as a directory if they're the only path, as with
+	// "elles file.zip", and paths inside them are always read from the archive.
+	var addArg func(string, bool, bool)
+	addArg = func(a string, sub, only bool) {
+		if !sub && v.fsys == nil {
+			if errs.Append(v.openArchive(a, only && !opt.Directory)) {
+				return
+			}
+		}
+		fi, err := statArg(a)
+		if err != nil {
+			if a == "." && errors.Is(err, os.ErrNotExist) {
+				return
+			}
+			if errs.Append(err) {
+				return
+			}
+		}
+
+		if fi.IsDir() && !opt.Directory { /// Directory.
+			ls, err := v.readDir(a)
+			if err != nil {
+				if a == "." && errors.Is(err, os.ErrNotExist) {
+					return
+				}
+				errs.Append(err)
+				return
+			}
+
+			d := a
+			//if strings.TrimRight(d, "/") == "." {
+			//	d = cwd
+			//}
+			if !filepath.IsAbs(d) {
+				if d == "." || d == "./" {
+					d = "."
+				} else {
+					d = string(append([]byte{'.', filepath.Separator}, d...))
+				}
+			}
+			ad, err := v.abs(d)
+			errs.Append(err)
+			hidden := os2.Hidden
+			virt := v.virtual(ad)
+			if virt {
+				hidden = func(_ string, l fs.DirEntry) bool { return l.Name()[0] == '.' }
+			}
+			pr := printable{
+				dir:    d,
+				absdir: ad,
+				fi:     make([]fileInfo, 0, len(ls)),
+			}
+			var subdirs []string
+			for _, l := range ls {
+				if hidden(ad, l) && !opt.All {
+					pr.hidden++
+					continue
+				}
+
+				// Don't call stat if we don't need to.
+				var fi fs.FileInfo = fakeFileInfo{l}
+				if !opt.nostat {
+					var err error
+					if opt.DerefAll {
+						fi, err = v.stat(filepath.Join(ad, l.Name()))
+					} else {
+						fi, err = l.Info()
+					}
+					if errs.Append(err) {
+						// Don't skip the entire file, just don't add stat info.
+						fi = fakeFileInfo{l}
+					} else if fi.IsDir() && opt.DirSize && !v.inArchive(ad) {
+						fi = &rdir{fsys: v.fsys, errs: errs, path: filepath.Join(ad, l.Name()), fi: fi}
+					}
+				}
+				if opt.filt.match(ad, fi) {
+					pr.fi = append(pr.fi, fileInfo{fi, "", ""})
+				} else {
+					pr.filtered++
+				}
+
+				if opt.Recurse && l.IsDir() {
+					subdirs = append(subdirs, filepath.Join(d, l.Name()))
+				}
+			}
+			// Don't print subdirectories without any matches when filtering.
+			if !sub || len(opt.filt) == 0 || len(pr.fi) > 0 {
+				toPrint = append(toPrint, pr)
+			}
+			for _, s := range subdirs {
+				addArg(s, true, false)
+			}
+		} else { /// Single file (or directory with -d).
+			if opt.Directory {
+				a = strings.TrimRight(a, "/")
+			}
+			d := strings.TrimSuffix(a, fi.Name())
+			ad, err := v.abs(d)
+			errs.Append(err)
+			if fi.IsDir() && opt.DirSize && !v.inArchive(ad) {
+				fi = &rdir{fsys: v.fsys, errs: errs, path: filepath.Join(ad, fi.Name()), fi: fi}
+			}
+			if !opt.filt.match(ad, fi) {
+				return
+			}
+
+			if filesIndex == -1 {
+				toPrint = append(toPrint, printable{
+					dir:     d,
+					absdir:  ad,
+					isFiles: true,
+					fi:      []fileInfo{{fi, d, ad}},
+				})
+				filesIndex = len(toPrint) - 1
+			} else {
+				toPrint[filesIndex].fi = append(toPrint[filesIndex].fi, fileInfo{fi, d, ad})
+			}
+		}
+	}
+	// Add the previous path when we see the next one, so we know if it was the
+	// only one.
+	var (
+		prev string
+		n    int
+	)
+	for a := range args {
+		// Make sure "ls /" and "ls C:" work on Windows.
+		if runtime.GOOS == "windows" && v.fsys == nil {
+			if a == "/" {
+				wd, err := os.Getwd()
+				if err == nil {
+					a = filepath.VolumeName(wd) + `\`
+				}
+			} else if len(a) == 2 && a[1] == ':' {
+				a += `\`
+			}
+		}
+		if n++; n > 1 {
+			addArg(prev, false, false)
+		}
+		prev = a
+	}
+	if n > 0 {
+		addArg(prev, false, n == 1)
+	}
+	return toPrint
+}
+
+//func getEnv(name string) (string, bool) {
+//	l, ok := os.LookupEnv(name)
+//	if !ok {
+//		return "", false
+//	}
+//	l = strings.SplitN(l, ".", 2)[0] // Remove ".UTF-8" or ".ASCII" encoding
+//	if l == "" || l == "C" {         // We can't do anything with this.
+//		return "", false
+//	}
+//	return l, true
+//}
+
+// Sort files.
+func order(toPrint []printable, opt Options) {
+	var (
+		sorter func(a, b fileInfo) int
+		// TODO: Hack for Linux btime, until we rewrite some of the stdlib stuff.
+		sorter2 func(printable) func(a, b fileInfo) int
+
+		nameSort = func(a, b fileInfo) int { return cmp.Compare(a.Name(), b.Name()) }
+	)
+
+	// var (
+	// 	lang     language.Tag
+	// 	haveLang bool
+	// )
+	// for _, v := range []string{"LC_COLLATE", "LC_ALL", "LANG"} {
+	// 	if e, ok := getEnv(v); ok {
+	// 		langs, _, err := language.ParseAcceptLanguage(e)
+	// 		if err != nil || len(langs) == 0 {
+	// 			zli.Errorf("invalid %s: %s", v, err)
+	// 		}
+	// 		lang, haveLang = langs[0], true
+	// 		break
+	// 	}
+	// }
+	//if haveLang {
+	//	col := collate.New(lang, collate.WithCase)
+	//	nameSort = func(a, b fs.FileInfo) int { return col.CompareString(a.Name(), b.Name()) }
+	//}
+
+	switch opt.Sort {
+	case "size":
+		// Make sure we have consistent sorting for -S, and also sort "below" 0.
+		sorter = func(a, b fileInfo) int {
+			n1, n2 := a.Size(), b.Size()
+			if (!opt.DirSize && a.IsDir()) || a.Mode()&fs.ModeSymlink != 0 {
+				n1 = -1
+			}
+			if (!opt.DirSize && b.IsDir()) || b.Mode()&fs.ModeSymlink != 0 {
+				n2 = -1
+			}
+			return cmp.Compare(n2, n1)
+		}
+	case "time":
+		switch opt.TimeField {
+		case "btime":
+			sorter = nil
+			sorter2 = func(p printable) func(a, b fileInfo) int {
+				return func(a, b fileInfo) int {
+					return getTime(p.absdir, b, "btime").Compare(getTime(p.absdir, a, "btime"))
+				}
+			}
+		case "atime":
+			sorter = func(a, b fileInfo) int { return getTime("", b, "atime").Compare(getTime("", a, "atime")) }
+		default:
+			sorter = func(a, b fileInfo) int { return b.ModTime().Compare(a.ModTime()) }
+		}
+	case "ext", "extension":
+		sorter = func(a, b fileInfo) int { return cmp.Compare(filepath.Ext(a.Name()), filepath.Ext(b.Name())) }
+	case "version":
+		sorter = func(a, b fileInfo) int { return versCompare(a.Name(), b.Name()) }
+	case "width":
+		// TODO: maybe make it sort by display width (with quotes and all of
+		// that)? That's what GNU ls does.
+		sorter = func(a, b fileInfo) int { return cmp.Compare(len([]rune(a.Name())), len([]rune(b.Name()))) }
+	case "none", "none-all":
+		sorter, nameSort = nil, nil
+	default:
+		sorter, nameSort = nameSort, nil
+	}
+	if sorter != nil || sorter2 != nil {
+		for _, p := range toPrint {
+			if nameSort != nil {
+				slices.SortFunc(p.fi, nameSort)
+			}
+			if sorter2 != nil {
+				slices.SortStableFunc(p.fi, sorter2(p))
+			} else {
+				slices.SortStableFunc(p.fi, sorter)
+			}
+		}
+	}
+	if opt.Reverse {
+		for _, p := range toPrint {
+			slices.Reverse(p.fi)
+		}
+	}
+	if opt.DirsFirst {
+		for _, p := range toPrint {
+			sort.SliceStable(p.fi, func(i, j int) bool {
+				return opt.vfs.isDir(p.dir, p.fi[i]) && !opt.vfs.isDir(p.dir, p.fi[j])
+			})
+		}
+	}
+	slices.SortFunc(toPrint, func(a, b printable) int {
+		if a.isFiles {
+			return -1
+		}
+		return cmp.Compare(a.dir, b.dir)
+	})
+}
+
+// Report if fi is a directory or a symlink to a directory; symlinks to
+// directories are counted as a "directory" for -group-dirs and -dirs-only.
+func (v *vfs) isDir(dir string, fi fs.FileInfo) bool {
+	if fi.IsDir() {
+		return true
+	}
+	if fi.Mode()&fs.ModeSymlink == 0 {
+		return false
+	}
+	st, err := v.stat(filepath.Join(dir, fi.Name()))
+	return err == nil && st.IsDir()
+}
+
+// cmp(a, b) should return a negative number when a < b, a positive number when
+// a > b and zero when a == b.
+func versCompare(a, b string) int {
+	if a == b {
+		return 0
+	}
+	getNum := func(s string) (int, int, int) {
+		var nonzero bool
+		start, end, zeros := -1, -1, 0
+		for i, c := range s {
+			if start == -1 && isdigit(c) {
+				if c == '0' {
+					zeros++
+				} else {
+					nonzero = true
+				}
+				start = i
+				continue
+			}
+			if start > -1 && c >= '1' {
+				nonzero = true
+			}
+			if !nonzero {
+				zeros++
+			}
+			if start > -1 && !isdigit(c) {
+				end = i
+				break
+			}
+		}
+		if start > -1 && end == -1 {
+			end = len(s)
+		}
+		return start, end, zeros
+	}
+
+	startA, endA, zeroA := getNum(a)
+	if startA == -1 {
+		return cmp.Compare(a, b)
+	}
+	startB, endB, zeroB := getNum(b)
+	if startB == -1 {
+		return cmp.Compare(a, b)
+	}
+
+	if zeroA != zeroB {
+		return zeroB - zeroA
+	}
+
+	na, _ := strconv.ParseInt(a[startA:endA], 10, 64)
+	nb, _ := strconv.ParseInt(b[startB:endB], 10, 64)
+
+	return int(na - nb)
+}
+
+func isdigit(c rune) bool { return c >= '0' && c <= '9' }
+
+type fakeFileInfo struct{ fs.DirEntry }
+
+func (fakeFileInfo) ModTime() time.Time  { return time.Time{} }
+func (fakeFileInfo) Sys() any            { return nil }
+func (fakeFileInfo) Size() int64         { return -1 }
+func (f fakeFileInfo) Mode() fs.FileMode { return f.Type() }
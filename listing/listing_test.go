@@ -0,0 +1,1009 @@
+package listing
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+	"unicode/utf8"
+)
+
+func TestLister(t *testing.T) {
+	mtime := time.Date(2024, 3, 15, 14, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"dir":      {Mode: fs.ModeDir | 0o755, ModTime: mtime},
+		"dir/file": {Data: []byte("xx"), Mode: 0o644, ModTime: mtime},
+		"exec":     {Data: []byte("#!/bin/sh\n"), Mode: 0o755, ModTime: mtime},
+		"file.txt": {Data: []byte(strings.Repeat("x", 2000)), Mode: 0o644, ModTime: mtime},
+		"link":     {Data: []byte("file.txt"), Mode: fs.ModeSymlink | 0o777, ModTime: mtime},
+		".hidden":  {Mode: 0o644, ModTime: mtime},
+		"empty":    {Mode: fs.ModeDir | 0o755, ModTime: mtime},
+	}
+
+	tests := []struct {
+		opt   Options
+		paths []string
+		want  string
+	}{
+		{Options{}, nil, `
+			dir
+			empty
+			exec
+			file.txt
+			link`},
+		{Options{Width: 80}, nil, `
+			dir  empty  exec  file.txt  link`},
+		{Options{All: true, Classify: true, Sort: "size", Reverse: true}, nil, `
+			link@
+			empty/
+			dir/
+			.hidden
+			exec*
+			file.txt`},
+		{Options{Long: 1}, nil, `
+			    · │ 2024-03-15 │ dir
+			    · │ 2024-03-15 │ empty
+			   10 │ 2024-03-15 │ exec
+			 2.0K │ 2024-03-15 │ file.txt
+			    · │ 2024-03-15 │ link → file.txt`},
+		{Options{Recurse: true, DirsOnly: true}, []string{"dir", "."}, `
+			.:
+			dir
+			empty
+
+			dir:`},
+		{Options{DirSize: true, Long: 1, Directory: true}, []string{"dir", "empty"}, `
+			 2 │ 2024-03-15 │ dir
+			 0 │ 2024-03-15 │ empty`},
+	}
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			var out strings.Builder
+			err := Lister{Options: tt.opt, FS: fsys, Out: &out}.List(tt.paths...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			have := strings.TrimRight(out.String(), "\n")
+			want := strings.ReplaceAll(strings.TrimPrefix(tt.want, "\n"), "\t", "")
+			if have != want {
+				t.Errorf("\nhave:\n%s\nwant:\n%s", have, want)
+			}
+		})
+	}
+
+	t.Run("from", func(t *testing.T) {
+		var out strings.Builder
+		l := Lister{Options: Options{Classify: true, Sort: "none"}, FS: fsys, Out: &out}
+		err := l.ListFrom(strings.NewReader("file.txt\x00dir\x00\x00dir/file\x00a\nb\x00"), 0)
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("wrong error: %v", err)
+		}
+		if have, want := out.String(), "file.txt\ndir/\ndir/file\n"; have != want {
+			t.Errorf("\nhave: %q\nwant: %q", have, want)
+		}
+	})
+
+	// Sys() of an fs.FS can be anything, which shouldn't be passed to os2.
+	t.Run("sys", func(t *testing.T) {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		w, err := zw.Create("dir/file")
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("xx"))
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		mapfs := fstest.MapFS{
+			"dir":      {Mode: fs.ModeDir | 0o755, ModTime: mtime, Sys: "sys"},
+			"dir/file": {Data: []byte("xx"), Mode: 0o644, ModTime: mtime, Sys: &zip.FileHeader{}},
+		}
+
+		for _, fsys := range []fs.FS{zr, mapfs} {
+			for _, opt := range []Options{{Long: 2}, {Long: 3, Inode: true}, {JSON: true}} {
+				var out strings.Builder
+				err := Lister{Options: opt, FS: fsys, Out: &out}.List("dir")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !strings.Contains(out.String(), "file") {
+					t.Errorf("wrong output: %q", out.String())
+				}
+			}
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		var out strings.Builder
+		err := Lister{FS: fsys, Out: &out}.List("nonexistent", "dir")
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("wrong error: %v", err)
+		}
+		if have := out.String(); have != "file\n" {
+			t.Errorf("wrong output: %q", have)
+		}
+
+		err = Lister{Options: Options{Sort: "nope"}, FS: fsys, Out: &out}.List()
+		if err == nil || err.Error() != `invalid value for -sort: "nope"` {
+			t.Errorf("wrong error: %v", err)
+		}
+	})
+}
+
+func TestGroupDigits(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"1", "1"},
+		{"12", "12"},
+		{"123", "123"},
+		{"1234", "1,234"},
+		{"123456", "123,456"},
+		{"12345678", "12,345,678"},
+
+		{"123.0", "123.0"},
+		{"123.10", "123.10"},
+		{"1234.0", "1,234.0"},
+		{"1234.10", "1,234.10"},
+		{"123456.0", "123,456.0"},
+		{"123456.10", "123,456.10"},
+		{"12345678.0", "12,345,678.0"},
+		{"12345678.10", "12,345,678.10"},
+
+		{"102G", "102G"},
+		{"1024G", "1,024G"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			have := groupDigits(tt.in)
+			if have != tt.want {
+				t.Errorf("\nhave: %q\nwant: %q", have, tt.want)
+			}
+		})
+	}
+}
+
+func BenchmarkGroupDigits(b *testing.B) {
+	var g any
+	b.Run("no suffix", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			g = groupDigits("12345678.10")
+		}
+	})
+	b.Run("with suffix", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			g = groupDigits("12345678K")
+		}
+	})
+	_ = g
+}
+
+func TestUsageBar(t *testing.T) {
+	tests := []struct {
+		sz, total int64
+		want      string
+	}{
+		{0, 0, "  0.0% "},
+		{1, 1, "100.0% ██████████"},
+		{1, 3, " 33.3% ███▍"},
+		{1, 100, "  1.0% ▏"},
+		{1, 10000, "  0.0% "},
+	}
+	for _, tt := range tests {
+		have, w := usageBar(tt.sz, tt.total)
+		if have != tt.want || w != utf8.RuneCountInString(tt.want) {
+			t.Errorf("usageBar(%d, %d): %q (%d); want %q", tt.sz, tt.total, have, w, tt.want)
+		}
+	}
+}
+
+func TestSummaryFormat(t *testing.T) {
+	tests := []struct {
+		in   summary
+		want string
+	}{
+		{summary{}, "0 files; 0 (0 allocated)"},
+		{summary{Files: 1, Other: 2, Size: 2048, Allocated: 4096, Filtered: 3},
+			"1 file, 2 other; 2.0K (4.0K allocated); 3 filtered"},
+		{summary{Dirs: 2, Symlinks: 1, Hidden: 1}, "2 directories, 1 symlink; 0 (0 allocated); 1 hidden"},
+	}
+	for _, tt := range tests {
+		if have := tt.in.format("", false); have != tt.want {
+			t.Errorf("\nhave: %s\nwant: %s", have, tt.want)
+		}
+	}
+}
+
+func TestDayGroup(t *testing.T) {
+	now := time.Date(2024, 3, 15, 14, 0, 0, 0, time.UTC)
+	tests := []struct {
+		t    time.Time
+		want string
+	}{
+		{now.Add(time.Hour), "In the future"},
+		{now, "Today"},
+		{time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC), "Today"},
+		{time.Date(2024, 3, 14, 23, 59, 0, 0, time.UTC), "Yesterday"},
+		{time.Date(2024, 3, 14, 0, 0, 0, 0, time.UTC), "Yesterday"},
+		{time.Date(2024, 3, 13, 23, 59, 0, 0, time.UTC), "Past week"},
+		{time.Date(2024, 3, 8, 0, 0, 0, 0, time.UTC), "Past week"},
+		{time.Date(2024, 3, 7, 0, 0, 0, 0, time.UTC), "Past month"},
+		{time.Date(2024, 2, 15, 0, 0, 0, 0, time.UTC), "Past month"},
+		{time.Date(2024, 2, 14, 0, 0, 0, 0, time.UTC), "Past year"},
+		{time.Date(2023, 3, 15, 0, 0, 0, 0, time.UTC), "Past year"},
+		{time.Date(2023, 3, 14, 0, 0, 0, 0, time.UTC), "Older"},
+	}
+	for _, tt := range tests {
+		if have := dayGroup(tt.t, now); have != tt.want {
+			t.Errorf("%s: have %q; want %q", tt.t, have, tt.want)
+		}
+	}
+}
+
+func TestBrowse(t *testing.T) {
+	now := time.Now()
+	browser := func(keys string, out io.Writer, opt Options) *browser {
+		opt.DirsFirst = true
+		opt, err := Lister{Options: opt, FS: fstest.MapFS{
+			"dir":      {Mode: fs.ModeDir | 0o755, ModTime: now},
+			"dir/sub":  {Mode: fs.ModeDir | 0o755, ModTime: now},
+			"dir/file": {ModTime: now},
+			"foo":      {Data: []byte("foo\n"), ModTime: now},
+			"zbig":     {Data: []byte(strings.Repeat("x", 100)), ModTime: now},
+			".hidden":  {ModTime: now},
+		}}.prepare()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return newBrowser(strings.NewReader(keys), out, ".", opt)
+	}
+
+	tests := []struct {
+		keys string
+		want string
+	}{
+		{"", ""},
+		{"Q", ""},
+		{"\x03", ""},
+		{"q", "."},
+		{"lq", "dir"},
+		{"lj\r", "dir/file"},
+		{"l\r", ""}, // Enters dir/sub
+		{"\x1b[C\x1b[B\r", "dir/file"},
+		{"lhq", "."},
+		{"j\r", "foo"},
+		{"G\r", "zbig"},
+		{"jjjjjjk\r", "foo"},
+		{"/BIG\r\r", "zbig"},
+		{"/xxx\x7f\x7f\x7fo\r\r", "foo"},
+		{"/foo\x1bq", "."},
+		{"/.hid\r\r", ""}, // No matches, so do nothing.
+		{"a/.hid\r\r", ".hidden"},
+		{"sj\r", "zbig"},
+		{"ssssj\r", "foo"},
+		{"rj\r", "zbig"},
+		{"L?lj\r", "dir/file"},
+	}
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			var out strings.Builder
+			b := browser(tt.keys, &out, Options{})
+			have, err := b.run()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have != tt.want {
+				t.Errorf("\nhave: %q\nwant: %q\nscreen:\n%s", have, tt.want, out.String())
+			}
+		})
+	}
+
+	t.Run("filter", func(t *testing.T) {
+		for _, tt := range []struct {
+			keys string
+			opt  Options
+			want string
+		}{
+			{"j\r", Options{FileSize: "+10"}, "zbig"},
+			{"G\rq", Options{Type: "d"}, "dir"},            // Only dir.
+			{"lj\rq", Options{FileSize: "+10"}, "dir/sub"}, // dir/file is filtered.
+			{"lj\r", Options{FileSize: "-10"}, "dir/file"},
+		} {
+			t.Run("", func(t *testing.T) {
+				var out strings.Builder
+				have, err := browser(tt.keys, &out, tt.opt).run()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if have != tt.want {
+					t.Errorf("\nhave: %q\nwant: %q\nscreen:\n%s", have, tt.want, out.String())
+				}
+			})
+		}
+	})
+
+	t.Run("draw", func(t *testing.T) {
+		var out strings.Builder
+		b := browser("jrs", &out, Options{Long: 1})
+		b.size = func() (int, int) { return 200, 4 }
+		b.run()
+
+		screens := strings.Split(out.String(), "\x1b[H\x1b[2J")[1:]
+		if len(screens) != 4 {
+			t.Fatalf("%d screens:\n%q", len(screens), out.String())
+		}
+		have := make([]string, 0, len(screens))
+		for _, s := range screens {
+			s = regexp.MustCompile(`\d\d:\d\d`).ReplaceAllString(s, "hh:mm")
+			have = append(have, strings.ReplaceAll(s, "\r\n", "\n"))
+		}
+		want := []string{
+			". [name]\n>    · │ hh:mm │ dir\n     4 │ hh:mm │ foo\n\x1b[4;1H1/3 · ? for help",
+			". [name]\n     · │ hh:mm │ dir\n>    4 │ hh:mm │ foo\n\x1b[4;1H2/3 · ? for help",
+			". [name, reversed]\n   100 │ hh:mm │ zbig\n>    4 │ hh:mm │ foo\n\x1b[4;1H3/3 · ? for help",
+			". [size, reversed]\n     · │ hh:mm │ dir\n>    4 │ hh:mm │ foo\n\x1b[4;1H2/3 · ? for help",
+		}
+		if !reflect.DeepEqual(have, want) {
+			t.Errorf("\nhave:\n%s\n\nwant:\n%s", strings.Join(have, "\n\n"), strings.Join(want, "\n\n"))
+		}
+	})
+}
+
+func TestCompare(t *testing.T) {
+	mtime := time.Date(2024, 3, 15, 14, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"l/same":     {Data: []byte("x"), Mode: 0o644, ModTime: mtime},
+		"l/size":     {Data: []byte("xx"), Mode: 0o644, ModTime: mtime},
+		"l/mode":     {Mode: 0o644, ModTime: mtime},
+		"l/time":     {Mode: 0o644, ModTime: mtime.Add(500 * time.Millisecond)},
+		"l/type":     {Mode: 0o644, ModTime: mtime},
+		"l/link":     {Data: []byte("same"), Mode: fs.ModeSymlink | 0o777, ModTime: mtime},
+		"l/left":     {Mode: 0o644, ModTime: mtime},
+		"l/sub/a":    {Mode: 0o644, ModTime: mtime},
+		"l/onlyl/a":  {Mode: 0o644, ModTime: mtime},
+		"r/same":     {Data: []byte("x"), Mode: 0o644, ModTime: mtime},
+		"r/size":     {Data: []byte("xxxx"), Mode: 0o644, ModTime: mtime.Add(time.Hour)},
+		"r/mode":     {Mode: 0o755, ModTime: mtime},
+		"r/time":     {Mode: 0o644, ModTime: mtime},
+		"r/type/x":   {Mode: 0o644, ModTime: mtime},
+		"r/link":     {Data: []byte("size"), Mode: fs.ModeSymlink | 0o777, ModTime: mtime},
+		"r/right":    {Mode: 0o644, ModTime: mtime},
+		"r/sub/a":    {Data: []byte("x"), Mode: 0o644, ModTime: mtime},
+		"r/onlyr/xx": {Mode: 0o644, ModTime: mtime},
+	}
+
+	tests := []struct {
+		opt  Options
+		want string
+	}{
+		{Options{}, `
+			< left
+			| link  target same → size
+			| mode  mode -rw-r--r-- → -rwxr-xr-x
+			< onlyl
+			> onlyr
+			> right
+			  same
+			| size  size 2 → 4, time 2024-03-15 14:00:00 → 2024-03-15 15:00:00
+			  sub
+			  time
+			| type  type f → d`},
+		{Options{Recurse: true, Classify: true}, `
+			.:
+			< left
+			| link@  target same → size
+			| mode*  mode -rw-r--r-- → -rwxr-xr-x
+			< onlyl/
+			> onlyr/
+			> right
+			  same
+			| size  size 2 → 4, time 2024-03-15 14:00:00 → 2024-03-15 15:00:00
+			  sub/
+			  time
+			| type/  type f → d
+
+			sub:
+			| a  size 0 → 1`},
+	}
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			var out strings.Builder
+			err := Lister{Options: tt.opt, FS: fsys, Out: &out}.Compare("l", "r")
+			if err != nil {
+				t.Fatal(err)
+			}
+			have := strings.TrimRight(out.String(), "\n")
+			want := strings.ReplaceAll(strings.TrimPrefix(tt.want, "\n"), "\t", "")
+			if have != want {
+				t.Errorf("\nhave:\n%s\nwant:\n%s", have, want)
+			}
+		})
+	}
+
+	t.Run("colors", func(t *testing.T) {
+		t.Setenv("ELLES_COLORS", "default=gnu:lc=[:rc=]:ec={}:left=L:right=R:diff=D")
+		c, err := LoadColors(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out strings.Builder
+		err = Lister{Options: Options{Colors: c}, FS: fsys, Out: &out}.Compare("l", "r")
+		if err != nil {
+			t.Fatal(err)
+		}
+		have := out.String()
+		for _, w := range []string{"[L]<{} left\n", "\n[R]>{} right\n", "\n[D]|{} size  ", "\n  same\n"} {
+			if !strings.Contains(have, w) {
+				t.Errorf("%q not in output:\n%s", w, have)
+			}
+		}
+	})
+}
+
+func TestSnapshot(t *testing.T) {
+	mtime := time.Date(2024, 3, 15, 14, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"opt":          {Mode: fs.ModeDir | 0o755, ModTime: mtime},
+		"opt/same":     {Data: []byte("x"), Mode: 0o644, ModTime: mtime},
+		"opt/size":     {Data: []byte("xx"), Mode: 0o644, ModTime: mtime},
+		"opt/mode":     {Mode: fs.ModeSetuid | 0o755, ModTime: mtime},
+		"opt/link":     {Data: []byte("same"), Mode: fs.ModeSymlink | 0o777, ModTime: mtime},
+		"opt/removed":  {Mode: 0o644, ModTime: mtime},
+		"opt/gone":     {Mode: fs.ModeDir | 0o755, ModTime: mtime},
+		"opt/gone/a":   {Mode: 0o644, ModTime: mtime},
+		"opt/sub":      {Mode: fs.ModeDir | 0o755, ModTime: mtime},
+		"opt/sub/a":    {Mode: 0o644, ModTime: mtime},
+		"opt/sub/same": {Mode: 0o644, ModTime: mtime},
+	}
+
+	var snap strings.Builder
+	err := Lister{Options: Options{Recurse: true}, FS: fsys}.Snapshot(&snap, "opt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := (Lister{FS: fsys}).Snapshot(io.Discard, "opt/same"); err == nil {
+		t.Error("no error for a file")
+	}
+
+	fsys["opt/size"] = &fstest.MapFile{Data: []byte("xxxx"), Mode: 0o644, ModTime: mtime.Add(time.Hour)}
+	fsys["opt/mode"] = &fstest.MapFile{Mode: 0o755, ModTime: mtime}
+	fsys["opt/link"] = &fstest.MapFile{Data: []byte("size"), Mode: fs.ModeSymlink | 0o777, ModTime: mtime}
+	fsys["opt/added"] = &fstest.MapFile{Mode: 0o644, ModTime: mtime}
+	fsys["opt/sub/a"] = &fstest.MapFile{Mode: 0o600, ModTime: mtime}
+	delete(fsys, "opt/removed")
+	delete(fsys, "opt/gone")
+	delete(fsys, "opt/gone/a")
+
+	tests := []struct {
+		opt  Options
+		want string
+	}{
+		{Options{}, `
+			opt:
+			> added
+			< gone
+			| link  target same → size
+			| mode  mode -rwsr-xr-x → -rwxr-xr-x
+			< removed
+			| size  size 2 → 4, time 2024-03-15 14:00:00 → 2024-03-15 15:00:00
+
+			opt/sub:
+			| a  mode -rw-r--r-- → -rw-------`},
+		{Options{Long: 1}, `
+			opt:
+			>  0 │ 2024-03-15 │ added
+			<  · │ 2024-03-15 │ gone
+			|  · │ 2024-03-15 │ link → size  target same → size
+			|  0 │ 2024-03-15 │ mode  mode -rwsr-xr-x → -rwxr-xr-x
+			<  0 │ 2024-03-15 │ removed
+			|  4 │ 2024-03-15 │ size  size 2 → 4, time 2024-03-15 14:00:00 → 2024-03-15 15:00:00
+
+			opt/sub:
+			|  0 │ 2024-03-15 │ a  mode -rw-r--r-- → -rw-------`},
+	}
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			var out strings.Builder
+			err := Lister{Options: tt.opt, FS: fsys, Out: &out}.Changes(strings.NewReader(snap.String()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			have := strings.TrimRight(out.String(), "\n")
+			want := strings.ReplaceAll(strings.TrimPrefix(tt.want, "\n"), "\t", "")
+			if have != want {
+				t.Errorf("\nhave:\n%s\nwant:\n%s", have, want)
+			}
+		})
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		err := Lister{FS: fsys, Out: io.Discard}.Changes(strings.NewReader("nope"))
+		if err == nil || !strings.Contains(err.Error(), "reading snapshot") {
+			t.Errorf("wrong error: %v", err)
+		}
+		err = Lister{Options: Options{JSON: true}, FS: fsys, Out: io.Discard}.Changes(strings.NewReader(snap.String()))
+		if err == nil {
+			t.Error("no error for -json")
+		}
+	})
+}
+
+type syncBuffer struct {
+	mu sync.Mutex
+	b  strings.Builder
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Write(p)
+}
+
+func (s *syncBuffer) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.String()
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "old"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		out         = new(syncBuffer)
+		ctx, cancel = context.WithCancel(context.Background())
+		done        = make(chan error)
+	)
+	defer cancel()
+	go func() { done <- Lister{Out: out}.Watch(ctx, dir) }()
+
+	wait := func(s string) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+			if strings.Contains(out.String(), s) {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("no %q in output:\n%q", s, out.String())
+	}
+	wait("old")
+	if err := os.WriteFile(filepath.Join(dir, "new"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	wait("\x1b[7mnew\x1b[27m")
+	if strings.Contains(out.String(), "\x1b[7mold") {
+		t.Errorf("old is highlighted:\n%q", out.String())
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(out.String(), "\x1b[?25h\x1b[?1049l") {
+		t.Errorf("terminal not restored:\n%q", out.String())
+	}
+}
+
+func TestFileCachePrune(t *testing.T) {
+	var c fileCache[string]
+	c.set("a", "1")
+	c.set("b", "2")
+	c.prune() // Both used by the first listing.
+	c.get("a")
+	c.set("c", "3")
+	c.prune() // b wasn't used.
+	if want := map[string]string{"a": "1", "c": "3"}; !reflect.DeepEqual(c.m, want) {
+		t.Errorf("\nhave: %v\nwant: %v", c.m, want)
+	}
+
+	c.prune() // Nothing used.
+	if len(c.m) != 0 {
+		t.Errorf("not empty: %v", c.m)
+	}
+}
+
+func TestArchiveFS(t *testing.T) {
+	tmp := t.TempDir()
+	files := []struct {
+		name, data string
+		mode       fs.FileMode
+	}{
+		{"dir/", "", fs.ModeDir | 0o755},
+		{"dir/file", "hello", 0o644},
+		{"dir/link", "file", fs.ModeSymlink | 0o777},
+		{"implicit/sub/x", "x", 0o600},
+	}
+
+	var tarBuf bytes.Buffer
+	gz := gzip.NewWriter(&tarBuf)
+	tw := tar.NewWriter(gz)
+	for _, f := range files {
+		h := &tar.Header{Name: f.name, Mode: int64(f.mode.Perm()), Size: int64(len(f.data)), Typeflag: tar.TypeReg}
+		switch {
+		case f.mode.IsDir():
+			h.Typeflag = tar.TypeDir
+		case f.mode&fs.ModeSymlink != 0:
+			h.Typeflag, h.Linkname, h.Size = tar.TypeSymlink, f.data, 0
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if h.Typeflag == tar.TypeReg {
+			tw.Write([]byte(f.data))
+		}
+	}
+	if err := errors.Join(tw.Close(), gz.Close()); err != nil {
+		t.Fatal(err)
+	}
+
+	var zipBuf bytes.Buffer
+	zw := zip.NewWriter(&zipBuf)
+	for _, f := range files {
+		h := &zip.FileHeader{Name: f.name}
+		h.SetMode(f.mode)
+		w, err := zw.CreateHeader(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(f.data))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string][]byte{"a.tar.gz": tarBuf.Bytes(), "a.zip": zipBuf.Bytes()} {
+		t.Run(name, func(t *testing.T) {
+			p := filepath.Join(tmp, name)
+			if err := os.WriteFile(p, data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			st, err := os.Stat(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			a, err := readArchive(p, st)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := fstest.TestFS(a, "dir/file", "dir/link", "implicit/sub/x"); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	// Archives are only read if they're the only path, or if a path inside them
+	// is given.
+	t.Run("mount", func(t *testing.T) {
+		tests := []struct {
+			paths []string
+			want  []string
+		}{
+			{[]string{"a.zip"}, []string{"a.zip"}},
+			{[]string{"a.zip", "a.tar.gz"}, nil},
+			{[]string{"a.zip/", "a.tar.gz"}, []string{"a.zip"}},
+			{[]string{"a.zip/dir", "a.tar.gz/dir/file"}, []string{"a.tar.gz", "a.zip"}},
+			{[]string{"a.zip/nonexistent"}, []string{"a.zip"}},
+			{[]string{"nonexistent.zip/dir"}, nil},
+		}
+		for _, tt := range tests {
+			t.Run(strings.Join(tt.paths, " "), func(t *testing.T) {
+				opt, err := Lister{}.prepare()
+				if err != nil {
+					t.Fatal(err)
+				}
+				var paths []string
+				for _, p := range tt.paths {
+					paths = append(paths, tmp+string(filepath.Separator)+p)
+				}
+				gather(slices.Values(paths), &errGroup{}, opt)
+
+				var have []string
+				for p := range opt.vfs.archives {
+					have = append(have, filepath.Base(p))
+				}
+				slices.Sort(have)
+				if !reflect.DeepEqual(have, tt.want) {
+					t.Errorf("\nhave: %q\nwant: %q", have, tt.want)
+				}
+			})
+		}
+	})
+}
+
+func TestHash(t *testing.T) {
+	mtime := time.Date(2024, 3, 15, 14, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"dir":       {Mode: fs.ModeDir | 0o755, ModTime: mtime},
+		"dir/a":     {Data: []byte("hello\n"), Mode: 0o644, ModTime: mtime},
+		"dir/b":     {Data: []byte("hello\n"), Mode: 0o644, ModTime: mtime},
+		"dir/c":     {Data: []byte("world\n"), Mode: 0o644, ModTime: mtime},
+		"dir/empty": {Mode: 0o644, ModTime: mtime},
+		"dir/link":  {Data: []byte("a"), Mode: fs.ModeSymlink | 0o777, ModTime: mtime},
+		"dir/sub":   {Mode: fs.ModeDir | 0o755, ModTime: mtime},
+		"dir/sub/d": {Data: []byte("hello\n"), Mode: 0o644, ModTime: mtime},
+		"dir/sub/e": {Data: []byte("bye\n"), Mode: 0o644, ModTime: mtime},
+		"dir/sub/f": {Data: []byte("bye\n"), Mode: 0o644, ModTime: mtime},
+		"dir/sub/g": {Mode: 0o644, ModTime: mtime},
+	}
+
+	tests := []struct {
+		dupes bool
+		opt   Options
+		want  string
+	}{
+		{false, Options{Hash: "xxhash"}, `
+			e4c191d091bd8853 a
+			e4c191d091bd8853 b
+			71d2dfb69f566eaa c
+			ef46db3751d8e999 empty
+			-                link
+			-                sub`},
+		{false, Options{Hash: "sha256", Long: 1}, `
+			 6 │ 2024-03-15 │ 5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03 │ a
+			 6 │ 2024-03-15 │ 5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03 │ b
+			 6 │ 2024-03-15 │ e258d248fda94c63753607f7c4494ee0fcbe92f1a76bfdac795c9d84101eb317 │ c
+			 0 │ 2024-03-15 │ e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855 │ empty
+			 · │ 2024-03-15 │ -                                                                │ link → a
+			 · │ 2024-03-15 │ -                                                                │ sub`},
+		{true, Options{}, `
+			2 × 6 (sha256 5891b5b522d5):
+			dir/a
+			dir/b`},
+		{true, Options{Recurse: true}, `
+			3 × 6 (sha256 5891b5b522d5):
+			dir/a
+			dir/b
+			dir/sub/d
+
+			2 × 4 (sha256 abc6fd595fc0):
+			dir/sub/e
+			dir/sub/f`},
+		{true, Options{Recurse: true, Hash: "xxhash", Long: 1}, `
+			3 × 6 (xxhash e4c191d091bd):
+			 6 │ 2024-03-15 │ e4c191d091bd8853 │ dir/a
+			 6 │ 2024-03-15 │ e4c191d091bd8853 │ dir/b
+			 6 │ 2024-03-15 │ e4c191d091bd8853 │ dir/sub/d
+
+			2 × 4 (xxhash 85d4cb11d72b):
+			 4 │ 2024-03-15 │ 85d4cb11d72b0d02 │ dir/sub/e
+			 4 │ 2024-03-15 │ 85d4cb11d72b0d02 │ dir/sub/f`},
+	}
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			var (
+				out strings.Builder
+				l   = Lister{Options: tt.opt, FS: fsys, Out: &out}
+				err error
+			)
+			if tt.dupes {
+				err = l.Dupes("dir")
+			} else {
+				err = l.List("dir")
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			have := strings.TrimRight(out.String(), "\n")
+			want := strings.ReplaceAll(strings.TrimPrefix(tt.want, "\n"), "\t", "")
+			if have != want {
+				t.Errorf("\nhave:\n%s\nwant:\n%s", have, want)
+			}
+		})
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		err := Lister{Options: Options{Hash: "md5"}, FS: fsys, Out: io.Discard}.List("dir")
+		if err == nil || err.Error() != `invalid value for -hash: "md5"` {
+			t.Errorf("wrong error: %v", err)
+		}
+		err = Lister{Options: Options{JSON: true}, FS: fsys, Out: io.Discard}.Dupes("dir")
+		if err == nil {
+			t.Error("no error for -json")
+		}
+	})
+}
+
+func TestSniff(t *testing.T) {
+	pe := make([]byte, 0x84)
+	copy(pe, "MZ")
+	pe[0x3c] = 0x80
+	copy(pe[0x80:], "PE\x00\x00")
+	tar := make([]byte, 512)
+	copy(tar[257:], "ustar")
+
+	tests := []struct {
+		in, want string
+	}{
+		{"", "inode/x-empty"},
+		{"\x7fELF\x02\x01\x01", "application/x-elf"},
+		{string(pe), "application/vnd.microsoft.portable-executable"},
+		{"MZ" + strings.Repeat("\x00", 100), "application/octet-stream"},
+		{"\xcf\xfa\xed\xfe\x07\x00\x00\x01", "application/x-mach-binary"},
+		{"\xca\xfe\xba\xbe\x00\x00\x00\x02", "application/x-mach-binary"},
+		{"\xca\xfe\xba\xbe\x00\x00\x00\x41", "application/octet-stream"}, // Java class
+		{"#!/bin/sh\necho", "text/x-script.sh"},
+		{"#! /usr/bin/python3.12\n", "text/x-script.python"},
+		{"#!/usr/bin/env python3\n", "text/x-script.python"},
+		{"#!/usr/bin/env -S perl -w\n", "text/x-script.perl"},
+		{"#!\n", "text/plain; charset=utf-8"},
+		{string(tar), "application/x-tar"},
+		{"BZh91AY", "application/x-bzip2"},
+		{"\xfd7zXZ\x00\x00", "application/x-xz"},
+		{"\x89PNG\r\n\x1a\n", "image/png"},
+		{"\x1f\x8b\x08", "application/x-gzip"},
+		{"hello\n", "text/plain; charset=utf-8"},
+		{"\xff\xfeh\x00", "text/plain; charset=utf-16le"},
+	}
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			have := sniff([]byte(tt.in))
+			if have != tt.want {
+				t.Errorf("\nhave: %q\nwant: %q", have, tt.want)
+			}
+		})
+	}
+
+	t.Run("list", func(t *testing.T) {
+		mtime := time.Date(2024, 3, 15, 14, 0, 0, 0, time.UTC)
+		fsys := fstest.MapFS{
+			"dir":        {Mode: fs.ModeDir | 0o755, ModTime: mtime},
+			"dir/bin":    {Data: []byte("\x7fELF\x02\x01\x01"), Mode: 0o755, ModTime: mtime},
+			"dir/script": {Data: []byte("#!/bin/sh\n"), Mode: 0o755, ModTime: mtime},
+			"dir/sub":    {Mode: fs.ModeDir | 0o755, ModTime: mtime},
+		}
+		var out strings.Builder
+		err := Lister{Options: Options{Sniff: true, Long: 1}, FS: fsys, Out: &out}.List("dir")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "" +
+			"  7 │ 2024-03-15 │ application/x-elf │ bin\n" +
+			" 10 │ 2024-03-15 │ text/x-script.sh  │ script\n" +
+			"  · │ 2024-03-15 │ -                 │ sub\n"
+		if have := out.String(); have != want {
+			t.Errorf("\nhave:\n%s\nwant:\n%s", have, want)
+		}
+	})
+}
+
+func TestExe(t *testing.T) {
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bin, err := os.ReadFile(self)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mtime := time.Date(2024, 3, 15, 14, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"dir":         {Mode: fs.ModeDir | 0o755, ModTime: mtime},
+		"dir/self":    {Data: bin, Mode: 0o755, ModTime: mtime},
+		"dir/script":  {Data: []byte("#!/usr/bin/env python3\nprint()\n"), Mode: 0o755, ModTime: mtime},
+		"dir/noexec":  {Data: []byte("#!/bin/sh\n"), Mode: 0o644, ModTime: mtime},
+		"dir/text":    {Data: []byte("hello\n"), Mode: 0o755, ModTime: mtime},
+		"dir/bad-elf": {Data: []byte("\x7fELF\x02\x01\x01"), Mode: 0o755, ModTime: mtime},
+		"dir/sub":     {Mode: fs.ModeDir | 0o755, ModTime: mtime},
+	}
+
+	t.Run("self", func(t *testing.T) {
+		fi, err := fs.Stat(fsys, "dir/self")
+		if err != nil {
+			t.Fatal(err)
+		}
+		have, err := (&vfs{fsys: fsys}).exe("dir", fi)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]string{"windows": "PE", "darwin": "Mach-O", "ios": "Mach-O"}[runtime.GOOS]
+		if want == "" {
+			want = "ELF"
+		}
+		if have == nil || have.Format != want || !reflect.DeepEqual(have.Arch, []string{runtime.GOARCH}) || have.Go != runtime.Version() {
+			t.Errorf("\nhave: %#v\nwant: %s %s %s", have, want, runtime.GOARCH, runtime.Version())
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		delete(fsys, "dir/self")
+		var out strings.Builder
+		err := Lister{Options: Options{Exe: true, Long: 1}, FS: fsys, Out: &out}.List("dir")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "" +
+			"  7 │ 2024-03-15 │ ?                      │ bad-elf\n" +
+			" 10 │ 2024-03-15 │ -                      │ noexec\n" +
+			" 31 │ 2024-03-15 │ #!/usr/bin/env python3 │ script\n" +
+			"  · │ 2024-03-15 │ -                      │ sub\n" +
+			"  6 │ 2024-03-15 │ -                      │ text\n"
+		if have := out.String(); have != want {
+			t.Errorf("\nhave:\n%s\nwant:\n%s", have, want)
+		}
+	})
+}
+
+func TestText(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", "0 ascii"},
+		{"hello", "1 ascii"},
+		{"a\nb\n", "2 LF ascii"},
+		{"a\nb", "2 LF ascii"},
+		{"a\r\nb\r\n", "2 CRLF ascii"},
+		{"a\rb\r", "2 CR ascii"},
+		{"a\r\nb\nc", "3 mixed ascii"},
+		{"\n\n\n", "3 LF ascii"},
+		{"héllo\n", "1 LF utf-8"},
+		{"\xef\xbb\xbfhi\r\n", "1 CRLF utf-8-bom"},
+		{"\xff\xfeh\x00\r\x00\n\x00i\x00\n\x00", "2 mixed utf-16le"},
+		{"\xfe\xff\x00h\x00\n", "1 LF utf-16be"},
+		{"caf\xe9\n", "1 LF non-utf-8"},
+		{"\x7fELF\x02\x00\x00", "binary"},
+		{strings.Repeat("a", 32*1024-1) + "é\n", "1 LF utf-8"}, // Rune over the buffer boundary.
+		{strings.Repeat("a\n", 5000) + "\x00", "5001 LF ascii"},
+	}
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			have, err := readTextStats(strings.NewReader(tt.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h := have.format(false); h != tt.want {
+				t.Errorf("\nhave: %q\nwant: %q", h, tt.want)
+			}
+		})
+	}
+
+	t.Run("list", func(t *testing.T) {
+		mtime := time.Date(2024, 3, 15, 14, 0, 0, 0, time.UTC)
+		fsys := fstest.MapFS{
+			"dir":      {Mode: fs.ModeDir | 0o755, ModTime: mtime},
+			"dir/bin":  {Data: []byte("\x7fELF\x02\x00"), ModTime: mtime},
+			"dir/crlf": {Data: []byte(strings.Repeat("line\r\n", 1500)), ModTime: mtime},
+			"dir/lf":   {Data: []byte("€\n"), ModTime: mtime},
+			"dir/sub":  {Mode: fs.ModeDir | 0o755, ModTime: mtime},
+		}
+		var out strings.Builder
+		err := Lister{Options: Options{Text: true, Long: 1, Comma: true}, FS: fsys, Out: &out}.List("dir")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "" +
+			"    6 │ 2024-03-15 │ binary           │ bin\n" +
+			" 8.8K │ 2024-03-15 │ 1,500 CRLF ascii │ crlf\n" +
+			"    4 │ 2024-03-15 │ 1 LF utf-8       │ lf\n" +
+			"    · │ 2024-03-15 │ -                │ sub\n"
+		if have := out.String(); have != want {
+			t.Errorf("\nhave:\n%s\nwant:\n%s", have, want)
+		}
+	})
+}
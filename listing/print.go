@@ -0,0 +1,901 @@
+package listing
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"zgo.at/elles/os2"
+)
+
+const (
+	_                  = 0
+	borderToLeft uint8 = 1 << (iota - 1)
+	alignNone
+	alignLeft
+)
+
+type (
+	col struct {
+		s    string
+		w    int
+		prop uint8
+	}
+	cols struct {
+		longest []int
+		rows    [][]col
+		reset   string // To end trimmed rows.
+	}
+)
+
+func getCols(p printable, opt Options) cols {
+	ncols := 1
+	if opt.Long == 1 {
+		ncols = 3
+	} else if opt.Long >= 2 {
+		ncols = 6
+	}
+	if opt.Inode {
+		ncols++
+	}
+	if opt.Hash != "" {
+		ncols++
+	}
+	if opt.Sniff {
+		ncols++
+	}
+	if opt.Exe {
+		ncols++
+	}
+	if opt.Text {
+		ncols++
+	}
+	var dirTotal int64
+	if opt.Bar {
+		ncols++
+		for _, fi := range p.fi {
+			dirTotal += barSize(fi)
+		}
+	}
+	cc := cols{
+		longest: make([]int, ncols),
+		rows:    make([][]col, 0, len(p.fi)),
+		reset:   opt.Colors.reset,
+	}
+
+	for _, fi := range p.fi {
+		fp, afp := p.dir, p.absdir
+		if fi.filepathAbs != "" { // Files from the commandline, or -compare.
+			fp, afp = fi.filepath, fi.filepathAbs
+		}
+		cur := make([]col, 0, ncols)
+		if opt.Long == 0 {
+			if opt.Inode {
+				n := strconv.FormatUint(os2.Serial(afp, fi), 10)
+				cur = append(cur, col{s: n, w: len(n)})
+			}
+			if opt.Bar {
+				b, w := usageBar(barSize(fi), dirTotal)
+				cur = append(cur, col{s: b, w: w, prop: alignLeft})
+			}
+
+			cur = contentCols(cur, afp, fi, opt, 0)
+			n, w := decoratePath(fp, afp, fi, opt, false, !p.isFiles)
+			cur = append(cur, col{s: n, w: w, prop: alignNone})
+		} else if opt.Long == 1 {
+			s, w := listSize(fi, afp, opt.BlockSize, opt.Comma, opt.DirSize, opt.FixedSizeWidth)
+
+			if opt.Inode {
+				n := strconv.FormatUint(os2.Serial(afp, fi), 10)
+				cur = append(cur, col{s: n, w: len(n)})
+				cur = append(cur, col{s: s, w: w, prop: borderToLeft})
+			} else {
+				w++
+				cur = append(cur, col{s: " " + s, w: w})
+			}
+			if opt.Bar {
+				b, w := usageBar(barSize(fi), dirTotal)
+				cur = append(cur, col{s: b, w: w, prop: borderToLeft | alignLeft})
+			}
+
+			var (
+				t  string
+				tt = getTime(afp, fi, opt.TimeField)
+			)
+			switch {
+			case tt.IsZero():
+				t = "????-??-??"
+			case opt.FullTime == 0:
+				t = shortTime(p.absdir, tt)
+			case opt.FullTime == 1:
+				t = tt.Format("2006-01-02 15:04:05")
+			default:
+				t = tt.Format("2006-01-02 15:04:05.000000000 -07:00")
+			}
+			cur = append(cur, col{s: t, w: len(t), prop: borderToLeft})
+			cur = contentCols(cur, afp, fi, opt, borderToLeft)
+
+			n, w := decoratePath(fp, afp, fi, opt, true, !p.isFiles)
+			cur = append(cur, col{s: n, w: w, prop: borderToLeft | alignNone})
+		} else {
+			if opt.Inode {
+				n := strconv.FormatUint(os2.Serial(afp, fi), 10)
+				cur = append(cur, col{s: n, w: len(n)})
+			}
+			var perm string
+			if opt.Octal {
+				perm = fmt.Sprintf("%4o", unixPerm(fi.Mode()))
+			} else {
+				perm = strmode(fi.Mode())
+			}
+			cur = append(cur, col{s: perm, w: len(perm)})
+
+			user, group := opt.vfs.owner(afp, fi, opt.NumericUID)
+			cur = append(cur, col{s: user, w: textWidth(user), prop: alignLeft})
+			if opt.Group {
+				cur = append(cur, col{s: group, w: textWidth(group), prop: alignLeft})
+			} else if user != group {
+				cur = append(cur, col{s: ":" + group, w: textWidth(group) + 1, prop: alignLeft})
+			} else {
+				cur = append(cur, col{})
+			}
+
+			s, w := listSize(fi, afp, opt.BlockSize, opt.Comma, opt.DirSize, opt.FixedSizeWidth)
+
+			cur = append(cur, col{s: s, w: w})
+			if opt.Bar {
+				b, w := usageBar(barSize(fi), dirTotal)
+				cur = append(cur, col{s: b, w: w, prop: alignLeft})
+			}
+
+			var (
+				t  string
+				tt = getTime(afp, fi, opt.TimeField)
+			)
+			switch {
+			case tt.IsZero():
+				t = "????-??-??"
+			case opt.FullTime == 0:
+				t = tt.Format("Jan _2 15:04")
+			case opt.FullTime == 1:
+				t = tt.Format("2006-01-02 15:04:05")
+			default:
+				t = tt.Format("2006-01-02 15:04:05.000000000 -07:00")
+			}
+			cur = append(cur, col{s: t, w: len(t)})
+			cur = contentCols(cur, afp, fi, opt, 0)
+
+			n, w := decoratePath(fp, afp, fi, opt, true, !p.isFiles)
+			cur = append(cur, col{s: n, w: w, prop: borderToLeft | alignNone})
+		}
+
+		if opt.highlight[filepath.Join(afp, fi.Name())] {
+			cur[len(cur)-1].s = highlight(cur[len(cur)-1].s, opt.Colors.reset)
+		}
+		cc.rows = append(cc.rows, cur)
+		var w int
+		for i := range ncols {
+			if cur[i].w > cc.longest[i] {
+				cc.longest[i] = cur[i].w
+			}
+			w += cur[i].w
+		}
+	}
+	return cc
+}
+
+// Add the columns for -hash, -sniff, -exe, and -text; "-" if there are no contents
+// (or it's not an executable), or "?" if reading the file failed.
+func contentCols(cur []col, absdir string, fi fs.FileInfo, opt Options, prop uint8) []col {
+	if opt.Hash != "" {
+		h := "-"
+		if opt.vfs.hasContents(absdir, fi) {
+			var err error
+			if h, err = opt.vfs.hash(absdir, fi, opt.Hash); err != nil {
+				h = "?"
+			}
+		}
+		cur = append(cur, col{s: h, w: len(h), prop: prop | alignLeft})
+	}
+	if opt.Sniff {
+		ct := "-"
+		if opt.vfs.hasContents(absdir, fi) {
+			var err error
+			if ct, err = opt.vfs.contentType(absdir, fi); err != nil {
+				ct = "?"
+			}
+		}
+		cur = append(cur, col{s: ct, w: len(ct), prop: prop | alignLeft})
+	}
+	if opt.Exe {
+		x := "-"
+		if opt.vfs.isExe(absdir, fi) {
+			if e, err := opt.vfs.exe(absdir, fi); err != nil {
+				x = "?"
+			} else if e != nil {
+				x = e.String()
+			}
+		}
+		cur = append(cur, col{s: x, w: textWidth(x), prop: prop | alignLeft})
+	}
+	if opt.Text {
+		x := "-"
+		if opt.vfs.hasContents(absdir, fi) {
+			if t, err := opt.vfs.textStats(absdir, fi); err != nil {
+				x = "?"
+			} else {
+				x = t.format(opt.Comma)
+			}
+		}
+		cur = append(cur, col{s: x, w: len(x), prop: prop | alignLeft})
+	}
+	return cur
+}
+
+// Size to use for -bar; symlinks are always 0 as they're not followed.
+func barSize(fi fs.FileInfo) int64 {
+	if fi.Mode()&fs.ModeSymlink != 0 || fi.Size() < 0 {
+		return 0
+	}
+	return fi.Size()
+}
+
+// Percentage of the total as "12.5% █▎", with the bar in eighths of a block
+// like ncdu.
+func usageBar(sz, total int64) (string, int) {
+	const width = 10
+	var frac float64
+	if total > 0 {
+		frac = float64(sz) / float64(total)
+	}
+	eighths := int(math.Round(frac * width * 8))
+	bar := strings.Repeat("█", eighths/8)
+	if r := eighths % 8; r > 0 {
+		bar += string([]rune("▏▎▍▌▋▊▉")[r-1])
+	}
+	s := fmt.Sprintf("%5.1f%% %s", frac*100, bar)
+	return s, 7 + utf8.RuneCountInString(bar)
+}
+
+func decoratePath(dir, absdir string, fi fs.FileInfo, opt Options, linkDest, listingDir bool) (string, int) {
+	n := fi.Name()
+	hidden := n[0] == '.'
+	if dir != "" && !opt.Recurse && !listingDir {
+		n = filepath.Join(dir, n)
+	}
+	n = doQuote(n, opt.Quote)
+
+	width := textWidth(n)
+
+	var didColor bool
+	ifset := func(c string, class ...string) {
+		if c != "" {
+			didColor = true
+			if hidden {
+				c += opt.Colors.hidden
+			}
+			n = c + n + opt.Colors.reset
+		}
+		if len(class) > 0 && class[0] != "" && (opt.Classify || (class[0] == "/" && opt.DirSlash)) {
+			n += class[0]
+			width += len(class[0])
+		}
+	}
+	if (fi.Mode().IsRegular() || fi.Mode()&fs.ModeSymlink != 0) && opt.NoExt {
+		if ext := filepath.Ext(n); ext != "" {
+			n = n[:len(n)-len(ext)]
+			width -= textWidth(ext)
+		}
+	}
+
+	var target string // " → target" for symlinks with linkDest.
+	switch {
+	case fi.Mode()&fs.ModeSymlink == 0:
+		ifset(fileColor(absdir, fi, opt), fileClass(fi))
+	case opt.DerefAll:
+		// -L and unresolvable symlinks: since resolving it fails earlier on
+		// it's still a link here, but we don't really want to display it as
+		// such.
+	case !linkDest:
+		c, _, _ := linkColor(dir, fi, opt, false)
+		ifset(c, "@")
+	default:
+		var (
+			c  string
+			tw int
+		)
+		c, target, tw = linkColor(dir, fi, opt, true)
+		ifset(c)
+		width += tw
+	}
+	if !didColor {
+		ifset(opt.Colors.normal)
+	}
+	if hidden {
+		ifset(opt.Colors.hidden)
+	}
+	n += target
+
+	if opt.Hyperlink && !virtual(fi) {
+		p := esc(filepath.Join(absdir, n))
+		n = fmt.Sprintf("\x1b]8;;file://%s%s\a%s\x1b]8;;\a", opt.hostname, p, n)
+	}
+
+	return filepath.ToSlash(n), width
+}
+
+// Get the colour for the symlink fi, and the " → target" text to display after
+// the name if linkDest is set.
+func linkColor(dir string, fi fs.FileInfo, opt Options, linkDest bool) (string, string, int) {
+	col := opt.Colors
+	// Rules such as "ln&*.so" always take precedence.
+	ln, lnRule := ruleColor(dir, fi, opt, true)
+	if !lnRule {
+		ln = col.link
+	}
+
+	// Don't need to resolve anything.
+	if !linkDest && (lnRule || !col.linkAsTarget && col.orphan == "") {
+		return ln, "", 0
+	}
+
+	l, err := opt.vfs.linkTarget(dir, fi)
+	// If the Readlink failed the stat almost certainly also failed; don't need
+	// to issue a separate error for this.
+	if err != nil {
+		if !linkDest {
+			return ln, "", 0
+		}
+		return ln, " → ???", 6
+	}
+	fl := l
+	if !filepath.IsAbs(fl) {
+		fl = filepath.Join(dir, fl)
+	}
+	st, err := opt.vfs.stat(fl)
+
+	var (
+		c                = ln
+		targetC, targetR string
+		class            string
+	)
+	if err != nil {
+		// As GNU ls: link is always "or" with "ln=target" even if "or" is not
+		// set, and the target is "mi", falling back to "or".
+		if col.orphan != "" || col.linkAsTarget {
+			c = col.orphan
+		}
+		targetC = cmp.Or(col.missing, col.orphan)
+		if linkDest && !errors.Is(err, os.ErrNotExist) && !os2.IsELOOP(err) {
+			opt.vfs.errs.Append(err)
+		}
+	} else {
+		targetC = fileColor(filepath.Dir(fl), st, opt)
+		if col.linkAsTarget {
+			c = targetC
+		}
+		if opt.Classify || (opt.DirSlash && st.IsDir()) {
+			class = fileClass(st)
+		}
+	}
+	if lnRule {
+		c = ln
+	}
+	if !linkDest {
+		return c, "", 0
+	}
+	if targetC != "" {
+		targetR = col.reset
+	}
+
+	l = doQuote(l, opt.Quote)
+	return c, " → " + targetC + l + targetR + class, 3 + textWidth(l) + len(class)
+}
+
+// Get the -F indicator for fi.
+func fileClass(fi fs.FileInfo) string {
+	switch m := fi.Mode(); {
+	case m.IsDir():
+		return "/"
+	case m&fs.ModeSymlink != 0:
+		return "@"
+	case m&fs.ModeNamedPipe != 0:
+		return "|"
+	case m&fs.ModeSocket != 0:
+		return "="
+	case os2.IsDoor(fi):
+		return ">"
+	case m.IsRegular() && m&0o111 != 0:
+		return "*"
+	}
+	return ""
+}
+
+// We don't want to escape slashes, but do want to replace everything else.
+//
+// TODO: do this properly; what we want is call that url.escape() function with
+// encodePath (rather than encodePathSegment). That can only be done by
+// constructing url.URL, setting Path, and calling EscapedPath(). Meh.
+func esc(s string) string {
+	return strings.ReplaceAll(url.PathEscape(s), "%2F", "/")
+}
+
+func isVariationSelector(r rune) bool {
+	return (r >= 0x180b && r <= 0x180f) || (r >= 0xfe00 && r <= 0xfe0f) || (r >= 0xe0100 && r <= 0xe01ef)
+}
+
+func doQuote(in string, level int) string {
+	var (
+		buf      = new(strings.Builder)
+		dblQuote = level == 2
+		n        = []rune(in)
+	)
+	buf.Grow(len(n))
+	for i, r := range n {
+		//if !unicode.IsPrint(r) || unicode.Is(unicode.Mn, r) {
+		if !unicode.IsPrint(r) || isVariationSelector(r) {
+			// Only display the brief escapes for \e, \n, \r, and \t as these
+			// are fairly well-known. Who even knows what \v is?
+			if level == 0 {
+				buf.WriteString("$'")
+			} else if level == 1 {
+				dblQuote = true
+			}
+			switch r {
+			case 0x1b:
+				buf.WriteString(`\e`)
+			case '\n':
+				buf.WriteString(`\n`)
+			case '\r':
+				buf.WriteString(`\r`)
+			case '\t':
+				buf.WriteString(`\t`)
+			default:
+				if r < 0xff {
+					fmt.Fprintf(buf, "\\x%02x", r)
+				} else if r < 0xffff {
+					fmt.Fprintf(buf, "\\u%04x", r)
+				} else {
+					fmt.Fprintf(buf, "\\U%08x", r)
+				}
+			}
+			if level == 0 {
+				buf.WriteString("'")
+			}
+		} else {
+			// Always quote paths with leading and trailing spaces; hugely
+			// confusing otherwise.
+			if r == ' ' && (i == 0 || i == len(n)-1) {
+				dblQuote = true
+			}
+			if level == 1 && needQuote(r) {
+				dblQuote = true
+			}
+			if level >= 1 && (r == '"' || r == '`') {
+				buf.WriteRune('\\')
+			}
+			buf.WriteRune(r)
+		}
+	}
+	if dblQuote {
+		buf.WriteByte('"')
+		return `"` + buf.String()
+	}
+	return buf.String()
+}
+
+func needQuote(r rune) bool {
+	switch r {
+	case '|', '&', ';', '<', '>', '(', ')', '$', '\\', '"', '\'', ' ', // '
+		'*', '?', '[', ']', '#', '~', '=', '%', '!', '`', '{', '}':
+		return true
+	}
+	return false
+}
+
+// Get the permission bits as in chmod, including the setuid, setgid, and sticky
+// bits.
+func unixPerm(m fs.FileMode) fs.FileMode {
+	p := m & 0o777
+	if m&fs.ModeSticky != 0 {
+		p |= 0o1000
+	}
+	if m&fs.ModeSetgid != 0 {
+		p |= 0o2000
+	}
+	if m&fs.ModeSetuid != 0 {
+		p |= 0o4000
+	}
+	return p
+}
+
+func getTime(absdir string, fi fs.FileInfo, timeField string) time.Time {
+	if a := archiveEntry(fi); a != nil && timeField == "atime" {
+		return a.atime
+	}
+	switch timeField {
+	case "btime":
+		if virtual(fi) {
+			return time.Time{}
+		}
+		return os2.Btime(absdir, fi)
+	case "atime":
+		return os2.Atime(fi)
+	default:
+		return fi.ModTime()
+	}
+}
+
+func shortSize(n float64, u string) string {
+	if n > 10 {
+		return fmt.Sprintf("%.0f"+u, n)
+	}
+	return fmt.Sprintf("%.1f"+u, n)
+}
+
+func groupDigits(s string) string {
+	i, frac, hasFrac := strings.Cut(s, ".")
+	if hasFrac {
+		frac = "." + frac
+	}
+	if strings.HasSuffix(s, "K") || strings.HasSuffix(s, "M") || strings.HasSuffix(s, "G") || strings.HasSuffix(s, "T") {
+		frac += i[len(i)-1:]
+		hasFrac = true
+		i = i[:len(i)-1]
+	}
+	if len(i) <= 3 {
+		return s
+	}
+
+	var (
+		l = len(i) / 3
+		r = len(i) % 3
+		// +1 for dot, in case of frac. Not a big deal to over-alloc 1 byte.
+		n = make([]byte, 0, len(i)+l+len(frac)+1)
+	)
+	if r != 0 {
+		n = append(n, i[:r]...)
+		n = append(n, ',')
+	}
+	for j := range l {
+		j++
+		if j > 1 {
+			n = append(n, ',')
+		}
+		n = append(n, i[(j-1)*3+r:j*3+r]...)
+	}
+	if hasFrac {
+		//n = append(n, '.')
+		n = append(n, frac...)
+	}
+	return string(n)
+}
+
+func listSize(fi fs.FileInfo, absdir, blockSize string, comma, dirSize, fixedWidth bool) (string, int) {
+	if fi.Mode()&fs.ModeSymlink != 0 || (fi.IsDir() && !dirSize) {
+		return "·", 1
+	}
+	if fi.Size() == -1 {
+		return "???", 3
+	}
+	switch blockSize {
+	case "s":
+		s := strconv.FormatInt(os2.Blocks(fi), 10)
+		if comma {
+			s = groupDigits(s)
+		}
+		return s, len(s)
+	case "S":
+		bs := 512
+		if !virtual(fi) {
+			bs = os2.Blocksize(filepath.Join(absdir, fi.Name()))
+		}
+		s := strconv.FormatFloat(math.Ceil(float64(fi.Size())/float64(bs)), 'f', 0, 64)
+		if comma {
+			s = groupDigits(s)
+		}
+		return s, len(s)
+	case "b", "B", "1":
+		s := strconv.FormatInt(fi.Size(), 10)
+		if comma {
+			s = groupDigits(s)
+		}
+		return s, len(s)
+	case "k", "K":
+		s := shortSize(float64(fi.Size())/1024, "K")
+		if comma {
+			s = groupDigits(s)
+		}
+		return s, len(s)
+	case "m", "M":
+		s := shortSize(float64(fi.Size())/1024/1024, "M")
+		if comma {
+			s = groupDigits(s)
+		}
+		return s, len(s)
+	case "g":
+		s := shortSize(float64(fi.Size())/1024/1024/1024, "G")
+		if comma {
+			s = groupDigits(s)
+		}
+		return s, len(s)
+	default:
+		var s string
+		if fi.Size() < 1024 {
+			s = strconv.FormatInt(fi.Size(), 10)
+		} else if fi.Size() < 1024*1024 {
+			s = shortSize(float64(fi.Size())/1024, "K")
+		} else if fi.Size() < 1024*1024*1024 {
+			s = shortSize(float64(fi.Size())/1024/1024, "M")
+		} else {
+			s = shortSize(float64(fi.Size())/1024/1024/1024, "G")
+		}
+		if comma {
+			s = groupDigits(s)
+		}
+		if fixedWidth {
+			return fmt.Sprintf("%5s", s), 5
+		}
+		return s, len(s)
+	}
+}
+
+// FileMode.String() doesn't align nicely with sticky bit and setuid. This ports
+// strmode().
+func strmode(m fs.FileMode) string {
+	buf := make([]byte, 10)
+	buf[0] = ftypelet(m)
+
+	w := 1
+	const rwx = "rwxrwxrwx"
+	for i, c := range rwx {
+		if m&(1<<uint(9-1-i)) != 0 {
+			buf[w] = byte(c)
+		} else {
+			buf[w] = '-'
+		}
+		w++
+	}
+	if m&fs.ModeSetuid != 0 {
+		buf[3] = 's'
+		if m&0o100 == 0 {
+			buf[3] = 'S'
+		}
+	}
+	if m&fs.ModeSetgid != 0 {
+		buf[6] = 's'
+		if m&0o010 == 0 {
+			buf[6] = 'S'
+		}
+	}
+	if m&fs.ModeSticky != 0 {
+		buf[9] = 't'
+		if m&0o001 == 0 {
+			buf[9] = 'T'
+		}
+	}
+	return string(buf)
+}
+
+func ftypelet(m fs.FileMode) byte {
+	const str = "d   lbps  c ?"
+	for i, c := range str {
+		if c != ' ' && m&(1<<uint(32-1-i)) != 0 {
+			return byte(c)
+		}
+	}
+	return '-'
+	// Nonstandard file types.
+	// if (S_ISCTG (m))
+	//   return 'C';
+	// if (S_ISDOOR (m))
+	//   return 'D';
+	// if (S_ISMPB (m) || S_ISMPC (m) || S_ISMPX (m))
+	//   return 'm';
+	// if (S_ISNWK (m))
+	//   return 'n';
+	// if (S_ISPORT (m))
+	//   return 'P';
+	// if (S_ISWHT (m))
+	//   return 'w';
+}
+
+// Dislays as follows: just the time for today, "yst" and the time for
+// yesterday, and "dby" and the time for the day before yesterday. Everything
+// else displays as the date only "2006-01-02".
+func shortTime(absdir string, tt time.Time) string {
+	var (
+		t   string
+		now = time.Now()
+	)
+	if tt.Year() == now.Year() && tt.Month() == now.Month() && tt.Day() == now.Day() {
+		t = tt.Format("15:04")
+	} else if tt.Year() == now.Year() && tt.Month() == now.Month() && tt.Day() == now.Day()-1 {
+		t = tt.Format("yst 15:04")
+	} else if tt.Year() == now.Year() && tt.Month() == now.Month() && tt.Day() == now.Day()-2 {
+		t = tt.Format("dby 15:04")
+	} else {
+		t = tt.Format("2006-01-02")
+	}
+	return t
+}
+
+// Get the user and group IDs, or empty strings if they're not known.
+func ownerID(absdir string, fi fs.FileInfo) (string, string) {
+	if a := archiveEntry(fi); a != nil {
+		return a.uid, a.gid
+	}
+	return os2.OwnerID(absdir, fi)
+}
+
+// Get the user and group names, or the IDs if asID is set. The names are
+// cached in v, as lookups are relatively expensive.
+func (v *vfs) owner(absdir string, fi fs.FileInfo, asID bool) (string, string) {
+	if a := archiveEntry(fi); a != nil {
+		return a.owner(asID)
+	}
+	uid, gid := os2.OwnerID(absdir, fi)
+	if uid == "" && virtual(fi) {
+		return "-", "-"
+	}
+	if asID {
+		return uid, gid
+	}
+
+	v.ownerMu.Lock()
+	defer v.ownerMu.Unlock()
+	if v.users == nil {
+		v.users, v.groups = make(map[string]string), make(map[string]string)
+	}
+
+	uname, ok := v.users[uid]
+	if !ok {
+		u, err := user.LookupId(uid)
+		if err != nil {
+			u = &user.User{Username: uid}
+			if uid == "" {
+				u.Name = "[failed]"
+			}
+		}
+		// On Windows "well-known sids" aren't mapped by user.LookupId. So copy
+		// what "dir /Q" does.
+		// https://learn.microsoft.com/en-us/windows/win32/secauthz/well-known-sids
+		if runtime.GOOS == "windows" {
+			switch uid {
+			case "S-1-5-32-544":
+				u.Username = `BUILTIN\Administrators`
+
+			}
+		}
+		v.users[uid] = u.Username
+		uname = u.Username
+	}
+
+	gname, ok := v.groups[gid]
+	if !ok {
+		g, err := user.LookupGroupId(gid)
+		if err != nil {
+			g = &user.Group{Name: gid}
+			if gid == "" {
+				g.Name = "[failed]"
+			}
+		}
+		v.groups[gid] = g.Name
+		gname = g.Name
+	}
+
+	return uname, gname
+}
+
+// Directories and entries in the -json output, which is also the format for
+// snapshots.
+type (
+	jsonEntry struct {
+		Name        string      `json:"name"`
+		ModTime     time.Time   `json:"mod_time"`
+		BirthTime   time.Time   `json:"birth_time"`
+		AccessTime  time.Time   `json:"access_time"`
+		Type        fs.FileMode `json:"type"`
+		Permission  fs.FileMode `json:"permission"`        // As in chmod.
+		Special     fs.FileMode `json:"special,omitempty"` // setuid, setgid, and sticky bits as in chmod (4000, 2000, 1000).
+		Size        int64       `json:"size"`
+		Owner       string      `json:"owner"`
+		Group       string      `json:"group"`
+		UID         string      `json:"uid,omitempty"`
+		GID         string      `json:"gid,omitempty"`
+		Link        string      `json:"link,omitempty"` // Symlink target.
+		XXHash      string      `json:"xxhash,omitempty"`
+		SHA256      string      `json:"sha256,omitempty"`
+		ContentType string      `json:"content_type,omitempty"`
+		Exe         *exeInfo    `json:"exe,omitempty"`
+		Text        *textStats  `json:"text,omitempty"`
+	}
+	jsonDir struct {
+		Dir     string      `json:"dir,omitempty"`
+		Group   string      `json:"group,omitempty"`
+		Error   string      `json:"error,omitempty"`
+		AbsDir  string      `json:"abs_dir,omitempty"`
+		Entries []jsonEntry `json:"entries,omitempty"`
+		Total   *summary    `json:"total,omitempty"`
+	}
+)
+
+func printJSON(w io.Writer, toPrint []printable, errs *errGroup, opt Options) error {
+	var (
+		all   []jsonDir
+		grand summary
+	)
+	for _, e := range errs.List() {
+		all = append(all, jsonDir{Error: e.Error()})
+	}
+	for _, p := range toPrint {
+		cur := jsonDir{Dir: p.dir, Group: p.group, AbsDir: p.absdir, Entries: make([]jsonEntry, 0, len(p.fi))}
+		for _, fi := range p.fi {
+			afp := cmp.Or(fi.filepathAbs, p.absdir)
+			e := jsonEntry{
+				Name:       fi.Name(),
+				ModTime:    fi.ModTime(),
+				BirthTime:  getTime(afp, fi, "btime"),
+				AccessTime: getTime(afp, fi, "atime"),
+				Type:       fi.Mode().Type(),
+				Permission: fi.Mode().Perm(),
+				Special:    unixPerm(fi.Mode()) &^ 0o777,
+				Size:       fi.Size(),
+			}
+			e.Owner, e.Group = opt.vfs.owner(afp, fi, opt.NumericUID)
+			e.UID, e.GID = ownerID(afp, fi)
+			if fi.Mode()&fs.ModeSymlink != 0 {
+				e.Link, _ = opt.vfs.linkTarget(afp, fi)
+			}
+			if opt.Hash != "" && opt.vfs.hasContents(afp, fi) {
+				h, _ := opt.vfs.hash(afp, fi, opt.Hash)
+				if opt.Hash == "sha256" {
+					e.SHA256 = h
+				} else {
+					e.XXHash = h
+				}
+			}
+			if opt.Sniff && opt.vfs.hasContents(afp, fi) {
+				e.ContentType, _ = opt.vfs.contentType(afp, fi)
+			}
+			if opt.Exe && opt.vfs.isExe(afp, fi) {
+				e.Exe, _ = opt.vfs.exe(afp, fi)
+			}
+			if opt.Text && opt.vfs.hasContents(afp, fi) {
+				e.Text, _ = opt.vfs.textStats(afp, fi)
+			}
+			cur.Entries = append(cur.Entries, e)
+		}
+		if opt.Total {
+			sum := summarize(p, opt.DirSize)
+			cur.Total = &sum
+			grand.add(sum)
+		}
+		all = append(all, cur)
+	}
+	if opt.Total { // Grand total as the last element, without a dir.
+		all = append(all, jsonDir{Total: &grand})
+	}
+
+	out, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(out))
+	// err = jfmt.NewFormatter(min(columns, 80), "  ").Format(w, bytes.NewReader(out))
+	return err
+}
@@ -1,4 +1,4 @@
-package main
+package listing
 
 import (
 	"fmt"
@@ -11,6 +11,8 @@ import (
 
 // Wrap FileInfo so that Size() is recursive.
 type rdir struct {
+	fsys   fs.FS // Walk path in fsys rather than the OS filesystem if set.
+	errs   *errGroup
 	fi     fs.FileInfo
 	path   string
 	sz     int64
@@ -24,7 +26,11 @@ func (r rdir) IsDir() bool        { return r.fi.IsDir() }
 func (r rdir) Sys() any           { return r.fi.Sys() }
 func (r *rdir) Size() int64 {
 	r.szOnce.Do(func() {
-		err := filepath.WalkDir(r.path, func(path string, d fs.DirEntry, err error) error {
+		walk := func(p string, fn fs.WalkDirFunc) error { return filepath.WalkDir(p, fn) }
+		if r.fsys != nil {
+			walk = func(p string, fn fs.WalkDirFunc) error { return fs.WalkDir(r.fsys, fsPath(p), fn) }
+		}
+		err := walk(r.path, func(path string, d fs.DirEntry, err error) error {
 			if err != nil {
 				return err
 			}
@@ -36,7 +42,7 @@ func (r *rdir) Size() int64 {
 			return nil
 		})
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "elles: dirsize for %q: %s\n", r.fi.Name(), err)
+			r.errs.Append(fmt.Errorf("dirsize for %q: %w", r.fi.Name(), err))
 		}
 	})
 	return r.sz
@@ -0,0 +1,147 @@
+package listing
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"slices"
+)
+
+// Snapshot writes a snapshot of the directories in paths to w, to compare
+// against later with Changes. Only the directories that are listed are
+// recorded, so use Recurse to include subdirectories.
+//
+// The snapshot is the same as the JSON output. Errors are returned as with
+// List, rather than written to the snapshot.
+func (l Lister) Snapshot(w io.Writer, paths ...string) error {
+	opt, err := l.prepare()
+	if err != nil {
+		return err
+	}
+	opt.JSON, opt.Directory, opt.Total, opt.GroupBy, opt.nostat = true, false, false, "", false
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	errs := &errGroup{MaxSize: 100}
+	toPrint := gather(slices.Values(paths), errs, opt)
+	for _, p := range toPrint {
+		if p.isFiles {
+			return fmt.Errorf("-snapshot: not a directory: %q", p.fi[0].Name())
+		}
+	}
+	order(toPrint, opt)
+	if err := printJSON(w, toPrint, &errGroup{}, opt); err != nil {
+		return err
+	}
+	return errors.Join(errs.List()...)
+}
+
+// Changes writes the entries that were added, removed, or changed since the
+// snapshot in r was written. The entries are marked as with Compare, with the
+// snapshot as the left directory: "<" for removed, ">" for added, and "|" for
+// changed entries. Directories without changes aren't shown.
+//
+// All directories in the snapshot are compared, and only those. The snapshot
+// should be taken with the same filters, or all entries that are filtered
+// differently will show up as changes.
+//
+// Errors are returned as with List.
+func (l Lister) Changes(r io.Reader) error {
+	opt, err := l.prepare()
+	if err != nil {
+		return err
+	}
+	if opt.JSON {
+		return errors.New("can't use -json with -changes")
+	}
+	opt.Directory, opt.Recurse, opt.nostat, opt.GroupBy = false, false, false, ""
+
+	var snap []jsonDir
+	if err := json.NewDecoder(r).Decode(&snap); err != nil {
+		return fmt.Errorf("reading snapshot: %w", err)
+	}
+	snap = slices.DeleteFunc(snap, func(d jsonDir) bool { return d.AbsDir == "" }) // Errors and totals.
+	inSnap := make(map[string]bool, len(snap))
+	for _, d := range snap {
+		inSnap[d.AbsDir] = true
+	}
+
+	var (
+		errs  = &errGroup{MaxSize: 100}
+		w     = bufio.NewWriter(l.Out)
+		shown int
+	)
+	for _, d := range snap {
+		then := printable{dir: d.Dir, absdir: d.AbsDir, fi: make([]fileInfo, 0, len(d.Entries))}
+		for _, e := range d.Entries {
+			then.fi = append(then.fi, fileInfo{FileInfo: e.info()})
+		}
+
+		dirErrs := &errGroup{MaxSize: 100}
+		ls := gather(slices.Values([]string{d.AbsDir}), dirErrs, opt)
+		for _, err := range dirErrs.List() {
+			// Directories that were removed are already shown in the parent.
+			if errors.Is(err, fs.ErrNotExist) && inSnap[filepath.Dir(d.AbsDir)] {
+				continue
+			}
+			errs.Append(err)
+		}
+		if len(ls) == 0 || ls[0].isFiles {
+			continue
+		}
+		now := ls[0]
+		now.dir = d.Dir
+
+		cc := compareDir(then, now, opt, true)
+		if len(cc.rows) == 0 {
+			continue
+		}
+		if len(snap) > 1 {
+			if shown > 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintln(w, filepath.ToSlash(filepath.Clean(d.Dir))+":")
+		}
+		shown++
+		rows, _, _ := cc.format(opt.MaxColWidth)
+		for _, r := range rows {
+			fmt.Fprintln(w, r)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return errors.Join(errs.List()...)
+}
+
+// Get the snapshot entry as an fs.FileInfo; archiveInfo already has everything
+// that's stored.
+func (e jsonEntry) info() *archiveInfo {
+	mode := e.Type | e.Permission&0o777
+	if e.Special&0o1000 != 0 {
+		mode |= fs.ModeSticky
+	}
+	if e.Special&0o2000 != 0 {
+		mode |= fs.ModeSetgid
+	}
+	if e.Special&0o4000 != 0 {
+		mode |= fs.ModeSetuid
+	}
+	return &archiveInfo{
+		name:  e.Name,
+		size:  e.Size,
+		mode:  mode,
+		mtime: e.ModTime,
+		atime: e.AccessTime,
+		uid:   e.UID,
+		gid:   e.GID,
+		uname: e.Owner,
+		gname: e.Group,
+		link:  e.Link,
+	}
+}
@@ -0,0 +1,174 @@
+package listing
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Sniff the content type from the start of a file, as a MIME type.
+//
+// This adds executables, scripts, and some archive formats to what
+// http.DetectContentType recognizes; the names are the same as file(1) uses
+// where possible.
+func sniff(b []byte) string {
+	switch {
+	case len(b) == 0:
+		return "inode/x-empty"
+	case bytes.HasPrefix(b, []byte("\x7fELF")):
+		return "application/x-elf"
+	case isPE(b):
+		return "application/vnd.microsoft.portable-executable"
+	case isMachO(b):
+		return "application/x-mach-binary"
+	case bytes.HasPrefix(b, []byte("#!")):
+		if i := scriptInterp(b); i != "" {
+			return "text/x-script." + i
+		}
+	case len(b) >= 262 && bytes.Equal(b[257:262], []byte("ustar")):
+		return "application/x-tar"
+	case bytes.HasPrefix(b, []byte("BZh")):
+		return "application/x-bzip2"
+	case bytes.HasPrefix(b, []byte("\xfd7zXZ\x00")):
+		return "application/x-xz"
+	case bytes.HasPrefix(b, []byte("\x28\xb5\x2f\xfd")):
+		return "application/zstd"
+	case bytes.HasPrefix(b, []byte("7z\xbc\xaf\x27\x1c")):
+		return "application/x-7z-compressed"
+	}
+	return http.DetectContentType(b)
+}
+
+// PE files start with a DOS header, which has the offset to the "PE\0\0"
+// signature at 0x3c.
+func isPE(b []byte) bool {
+	if len(b) < 0x40 || !bytes.HasPrefix(b, []byte("MZ")) {
+		return false
+	}
+	off := int(binary.LittleEndian.Uint32(b[0x3c:]))
+	return off+4 <= len(b) && bytes.Equal(b[off:off+4], []byte("PE\x00\x00"))
+}
+
+func isMachO(b []byte) bool {
+	if len(b) < 8 {
+		return false
+	}
+	switch binary.BigEndian.Uint32(b) {
+	case 0xfeedface, 0xfeedfacf, 0xcefaedfe, 0xcffaedfe:
+		return true
+	case 0xcafebabe:
+		// Universal binaries; Java class files have the same magic, but
+		// follow it with the version (45 or higher) rather than the number of
+		// architectures.
+		return binary.BigEndian.Uint32(b[4:]) < 45
+	}
+	return false
+}
+
+// Get the interpreter from a "#!" line, without the path or version:
+// "#!/usr/bin/env python3" is "python".
+func scriptInterp(b []byte) string {
+	line, _, _ := bytes.Cut(b[2:], []byte("\n"))
+	f := strings.Fields(string(line))
+	if len(f) == 0 {
+		return ""
+	}
+	i := path.Base(f[0])
+	if i == "env" {
+		f = f[1:]
+		for len(f) > 0 && strings.HasPrefix(f[0], "-") { // env -S
+			f = f[1:]
+		}
+		if len(f) == 0 {
+			return ""
+		}
+		i = path.Base(f[0])
+	}
+	return strings.TrimRight(i, "0123456789.")
+}
+
+// Suffixes for content types, to colour files without a known suffix like
+// files with one.
+var contentExts = map[string]string{
+	"image/png":                    ".png",
+	"image/jpeg":                   ".jpg",
+	"image/gif":                    ".gif",
+	"image/webp":                   ".webp",
+	"image/bmp":                    ".bmp",
+	"image/x-icon":                 ".ico",
+	"application/pdf":              ".pdf",
+	"application/postscript":       ".ps",
+	"application/zip":              ".zip",
+	"application/x-gzip":           ".gz",
+	"application/x-rar-compressed": ".rar",
+	"application/x-tar":            ".tar",
+	"application/x-bzip2":          ".bz2",
+	"application/x-xz":             ".xz",
+	"application/zstd":             ".zst",
+	"application/x-7z-compressed":  ".7z",
+	"application/wasm":             ".wasm",
+	"application/ogg":              ".ogg",
+	"audio/mpeg":                   ".mp3",
+	"audio/wave":                   ".wav",
+	"video/mp4":                    ".mp4",
+	"video/webm":                   ".webm",
+	"video/avi":                    ".avi",
+	"font/ttf":                     ".ttf",
+	"font/otf":                     ".otf",
+	"font/woff":                    ".woff",
+	"font/woff2":                   ".woff2",
+	"text/html":                    ".html",
+	"text/xml":                     ".xml",
+	"text/x-script.sh":             ".sh",
+	"text/x-script.bash":           ".sh",
+	"text/x-script.zsh":            ".sh",
+	"text/x-script.dash":           ".sh",
+	"text/x-script.ksh":            ".sh",
+	"text/x-script.python":         ".py",
+	"text/x-script.perl":           ".pl",
+	"text/x-script.ruby":           ".rb",
+	"text/x-script.node":           ".js",
+}
+
+// Get the content type without parameters such as "; charset=utf-8".
+func mediaType(ct string) string {
+	t, _, _ := strings.Cut(ct, ";")
+	return strings.TrimSpace(t)
+}
+
+// Get the content type of the file fi in absdir.
+func (v *vfs) contentType(absdir string, fi fs.FileInfo) (string, error) {
+	k := cacheKey(absdir, fi)
+	if ct, ok := v.sniffed.get(k); ok {
+		return ct, nil
+	}
+
+	fp, err := v.open(filepath.Join(absdir, fi.Name()))
+	if err != nil {
+		return "", err
+	}
+	defer fp.Close()
+	b := make([]byte, 512) // http.DetectContentType never looks further.
+	n, err := io.ReadFull(fp, b)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	ct := sniff(b[:n])
+	v.sniffed.set(k, ct)
+	return ct, nil
+}
+
+// Get the content type for the column and colours; "" if the file has no
+// contents or can't be read.
+func (v *vfs) sniffType(absdir string, fi fs.FileInfo) string {
+	if !v.hasContents(absdir, fi) {
+		return ""
+	}
+	ct, _ := v.contentType(absdir, fi)
+	return ct
+}
@@ -0,0 +1,188 @@
+package listing
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Line count, line endings, and encoding of a file, for -text.
+type textStats struct {
+	Lines    int    `json:"lines"`
+	Endings  string `json:"line_endings,omitempty"` // LF, CRLF, CR, or mixed; empty if there are no line breaks.
+	Encoding string `json:"encoding"`               // ascii, utf-8, utf-8-bom, utf-16le, utf-16be, non-utf-8, or binary.
+}
+
+// Format for the -text column, e.g. "120 LF utf-8" or "binary".
+func (t textStats) format(comma bool) string {
+	if t.Encoding == "binary" {
+		return t.Encoding
+	}
+	n := strconv.Itoa(t.Lines)
+	if comma {
+		n = groupDigits(n)
+	}
+	if t.Endings == "" {
+		return n + " " + t.Encoding
+	}
+	return n + " " + t.Endings + " " + t.Encoding
+}
+
+// Files with a NUL byte in the first binaryCheck bytes are binary; this is the
+// same check git uses.
+const binaryCheck = 8000
+
+// Counts line endings for textStats; this works on UTF-16 code units so it can
+// be used for both UTF-8 and UTF-16.
+type lineCounter struct {
+	lf, crlf, cr int
+	prevCR       bool
+	last         uint16
+	n            int64
+}
+
+func (c *lineCounter) add(u uint16) {
+	switch {
+	case u == '\n' && c.prevCR:
+		c.crlf++
+	case u == '\n':
+		c.lf++
+	case c.prevCR:
+		c.cr++
+	}
+	c.prevCR, c.last = u == '\r', u
+	c.n++
+}
+
+func (c *lineCounter) stats() textStats {
+	if c.prevCR {
+		c.cr++
+		c.prevCR = false
+	}
+	t := textStats{Lines: c.lf + c.crlf + c.cr}
+	if c.n > 0 && c.last != '\n' && c.last != '\r' { // Last line without newline.
+		t.Lines++
+	}
+	switch {
+	case c.lf > 0 && c.crlf == 0 && c.cr == 0:
+		t.Endings = "LF"
+	case c.crlf > 0 && c.lf == 0 && c.cr == 0:
+		t.Endings = "CRLF"
+	case c.cr > 0 && c.lf == 0 && c.crlf == 0:
+		t.Endings = "CR"
+	case c.lf+c.crlf+c.cr > 0:
+		t.Endings = "mixed"
+	}
+	return t
+}
+
+// Get the line count, line endings, and encoding of the file fi in absdir. The
+// file is read only up to binaryCheck bytes if it's binary.
+func (v *vfs) textStats(absdir string, fi fs.FileInfo) (*textStats, error) {
+	k := cacheKey(absdir, fi)
+	if t, ok := v.texts.get(k); ok {
+		return t, nil
+	}
+
+	p := filepath.Join(absdir, fi.Name())
+	fp, err := v.open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	t, err := readTextStats(fp)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", p, err)
+	}
+	v.texts.set(k, t)
+	return t, nil
+}
+
+func readTextStats(r io.Reader) (*textStats, error) {
+	var (
+		buf      = make([]byte, 32*1024)
+		carry    int // Bytes of an incomplete rune or UTF-16 code unit at the end of buf.
+		off      int64
+		lc       lineCounter
+		enc      string
+		invalid  bool
+		nonASCII bool
+	)
+	for {
+		n, err := io.ReadFull(r, buf[carry:])
+		eof := errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+		if err != nil && !eof {
+			return nil, err
+		}
+		b := buf[:carry+n]
+
+		if off == 0 {
+			switch {
+			case strings.HasPrefix(string(b), "\xef\xbb\xbf"):
+				enc, b = "utf-8-bom", b[3:]
+			case strings.HasPrefix(string(b), "\xff\xfe"):
+				enc, b = "utf-16le", b[2:]
+			case strings.HasPrefix(string(b), "\xfe\xff"):
+				enc, b = "utf-16be", b[2:]
+			}
+		}
+
+		i := 0
+		switch enc {
+		case "utf-16le", "utf-16be":
+			for ; i+1 < len(b); i += 2 {
+				if enc == "utf-16le" {
+					lc.add(uint16(b[i]) | uint16(b[i+1])<<8)
+				} else {
+					lc.add(uint16(b[i])<<8 | uint16(b[i+1]))
+				}
+			}
+		default:
+			for i < len(b) {
+				c := b[i]
+				if c < utf8.RuneSelf {
+					if c == 0 && off+int64(i) < binaryCheck {
+						return &textStats{Encoding: "binary"}, nil
+					}
+					lc.add(uint16(c))
+					i++
+					continue
+				}
+				if !eof && !utf8.FullRune(b[i:]) {
+					break
+				}
+				r, sz := utf8.DecodeRune(b[i:])
+				if r == utf8.RuneError && sz == 1 {
+					invalid = true
+				}
+				nonASCII = true
+				lc.add(0xffff) // Not a line ending; only the count matters.
+				i += sz
+			}
+		}
+
+		if eof {
+			break
+		}
+		carry = copy(buf, b[i:])
+		off += int64(n)
+	}
+
+	t := lc.stats()
+	switch {
+	case enc != "":
+		t.Encoding = enc
+	case invalid:
+		t.Encoding = "non-utf-8"
+	case nonASCII:
+		t.Encoding = "utf-8"
+	default:
+		t.Encoding = "ascii"
+	}
+	return &t, nil
+}
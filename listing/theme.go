@@ -0,0 +1,170 @@
+package listing
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Colour themes, in the LS_COLORS format. "#rrggbb" is a foreground colour and
+// "bg#rrggbb" a background colour; these are sent as 24-bit colours if the
+// terminal supports it, or the nearest 256-colour otherwise.
+var themes = []struct {
+	name, desc, colors string
+}{
+	{"gnu", "GNU ls defaults; works best on dark backgrounds",
+		"di=01;34:ln=01;36:pi=33:so=01;35:bd=01;33:cd=01;33:ex=01;32:do=01;35:" +
+			"su=37;41:sg=30;43:st=37;44:ow=34;42:tw=30;42:left=31:right=32:diff=33"},
+	{"bsd", "FreeBSD ls defaults; works best on light backgrounds",
+		"di=34:ln=35:so=32:pi=33:ex=31:bd=34;46:cd=34;43:su=30;41:sg=30;46:" +
+			"tw=30;42:ow=30;44:left=31:right=32:diff=33"},
+	{"dark", "256-colour or 24-bit theme for dark backgrounds",
+		"di=1;#5fafff:ln=#5fd7d7:or=#ff5f5f:pi=#d7af5f:so=#d787d7:bd=1;#d7af00:" +
+			"cd=1;#d7af00:do=#d787d7:ex=1;#87d75f:su=#ffffff;bg#af0000:" +
+			"sg=#000000;bg#d7af00:st=#ffffff;bg#005f87:ow=#5fafff;bg#005f00:" +
+			"tw=#000000;bg#5faf5f:left=#ff5f5f:right=#87d75f:diff=#d7af5f:" +
+			"*.tar=#ff875f:*.tgz=#ff875f:*.gz=#ff875f:*.bz2=#ff875f:*.xz=#ff875f:" +
+			"*.zst=#ff875f:*.zip=#ff875f:*.7z=#ff875f:*.rar=#ff875f:" +
+			"*.jpg=#d787ff:*.jpeg=#d787ff:*.png=#d787ff:*.gif=#d787ff:" +
+			"*.webp=#d787ff:*.svg=#d787ff:" +
+			"*.mp3=#00afaf:*.flac=#00afaf:*.ogg=#00afaf:*.opus=#00afaf:" +
+			"*.mp4=#af87ff:*.mkv=#af87ff:*.webm=#af87ff"},
+	{"light", "256-colour or 24-bit theme for light backgrounds",
+		"di=1;#005fd7:ln=#008787:or=#d70000:pi=#875f00:so=#870087:bd=1;#875f00:" +
+			"cd=1;#875f00:do=#870087:ex=1;#008700:su=#ffffff;bg#d70000:" +
+			"sg=#000000;bg#ffd75f:st=#000000;bg#87d7ff:ow=#005fd7;bg#d7ffd7:" +
+			"tw=#000000;bg#87d787:left=#d70000:right=#008700:diff=#875f00:" +
+			"*.tar=#af0000:*.tgz=#af0000:*.gz=#af0000:*.bz2=#af0000:*.xz=#af0000:" +
+			"*.zst=#af0000:*.zip=#af0000:*.7z=#af0000:*.rar=#af0000:" +
+			"*.jpg=#8700af:*.jpeg=#8700af:*.png=#8700af:*.gif=#8700af:" +
+			"*.webp=#8700af:*.svg=#8700af:" +
+			"*.mp3=#005f87:*.flac=#005f87:*.ogg=#005f87:*.opus=#005f87:" +
+			"*.mp4=#5f00af:*.mkv=#5f00af:*.webm=#5f00af"},
+}
+
+func findTheme(name string) (string, bool) {
+	for _, t := range themes {
+		if t.name == name {
+			return t.colors, true
+		}
+	}
+	return "", false
+}
+
+// Get the theme from "default=..", which is either a single theme or two
+// themes separated by a comma for dark and light backgrounds. "auto" is the
+// same as "gnu,bsd".
+//
+// The background is read from COLORFGBG, or from background if that's not set
+// and background isn't nil. If the background can't be detected the first
+// theme is used, except on BSD systems and macOS where it's the second (as
+// their ls uses BSD colours).
+func pickTheme(def string, bsdDefault bool, background func() string) (name, why string) {
+	if def == "" || def == "auto" {
+		def = "gnu,bsd"
+	}
+	dark, light, ok := strings.Cut(def, ",")
+	if !ok || dark == light {
+		return dark, ""
+	}
+	bg := colorfgbg()
+	if bg == "" && background != nil {
+		bg = background()
+	}
+	switch bg {
+	case "dark":
+		return dark, "dark background"
+	case "light":
+		return light, "light background"
+	}
+	if bsdDefault {
+		return light, "unknown background"
+	}
+	return dark, "unknown background"
+}
+
+// Get "light" or "dark" from COLORFGBG, which is set by rxvt, Konsole, and some
+// others, or "" if it's not set.
+func colorfgbg() string {
+	c := os.Getenv("COLORFGBG")
+	if c == "" {
+		return ""
+	}
+	// "fg;bg" or "fg;default;bg"; colours 0-6 and 8 are dark.
+	bg, err := strconv.Atoi(c[strings.LastIndexByte(c, ';')+1:])
+	if err != nil {
+		return ""
+	}
+	if bg < 7 || bg == 8 {
+		return "dark"
+	}
+	return "light"
+}
+
+// Replace "#rrggbb" and "bg#rrggbb" in the colour codes with the escape codes
+// for 24-bit or 256 colours.
+func expandHexColors(v string, truecolor bool) string {
+	if !strings.Contains(v, "#") {
+		return v
+	}
+	codes := strings.Split(v, ";")
+	for i, c := range codes {
+		fg, bg := "38", "48"
+		c, isBg := strings.CutPrefix(c, "bg")
+		if !strings.HasPrefix(c, "#") || len(c) != 7 {
+			continue
+		}
+		n, err := strconv.ParseUint(c[1:], 16, 32)
+		if err != nil {
+			continue
+		}
+		if isBg {
+			fg = bg
+		}
+		r, g, b := uint8(n>>16), uint8(n>>8), uint8(n)
+		if truecolor {
+			codes[i] = fmt.Sprintf("%s;2;%d;%d;%d", fg, r, g, b)
+		} else {
+			codes[i] = fmt.Sprintf("%s;5;%d", fg, nearest256(r, g, b))
+		}
+	}
+	return strings.Join(codes, ";")
+}
+
+// Report if the terminal supports 24-bit colour.
+func hasTruecolor() bool {
+	c := os.Getenv("COLORTERM")
+	return c == "truecolor" || c == "24bit"
+}
+
+// Get the nearest colour in the xterm 256-colour palette: either the 6×6×6
+// colour cube (16-231) or the greyscale ramp (232-255).
+func nearest256(r, g, b uint8) uint8 {
+	levels := [6]int{0, 95, 135, 175, 215, 255}
+	cube := func(v uint8) int {
+		switch {
+		case v < 48:
+			return 0
+		case v < 115:
+			return 1
+		}
+		return (int(v) - 35) / 40
+	}
+	dist := func(r2, g2, b2 int) int {
+		dr, dg, db := int(r)-r2, int(g)-g2, int(b)-b2
+		return dr*dr + dg*dg + db*db
+	}
+
+	cr, cg, cb := cube(r), cube(g), cube(b)
+	cubeIdx := 16 + 36*cr + 6*cg + cb
+	cubeDist := dist(levels[cr], levels[cg], levels[cb])
+
+	avg := (int(r) + int(g) + int(b)) / 3
+	grey := min(max((avg-3)/10, 0), 23)
+	gv := 8 + 10*grey
+	if dist(gv, gv, gv) < cubeDist {
+		return uint8(232 + grey)
+	}
+	return uint8(cubeIdx)
+}
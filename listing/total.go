@@ -0,0 +1,96 @@
+package listing
+
+import (
+	"fmt"
+	"strings"
+
+	"zgo.at/elles/os2"
+)
+
+// Summary of a directory (or all directories) for -total.
+type summary struct {
+	Files     int   `json:"files"`
+	Dirs      int   `json:"dirs"`
+	Symlinks  int   `json:"symlinks"`
+	Other     int   `json:"other"`
+	Size      int64 `json:"size"`      // Apparent size of files, and directories with -D.
+	Allocated int64 `json:"allocated"` // Allocated size of all entries, in bytes.
+	Hidden    int   `json:"hidden"`    // Hidden entries not shown because -a wasn't used.
+	Filtered  int   `json:"filtered"`  // Entries not shown because of a filter.
+}
+
+func summarize(p printable, dirSize bool) summary {
+	s := summary{Hidden: p.hidden, Filtered: p.filtered}
+	for _, fi := range p.fi {
+		switch fileType(fi) {
+		case 'f':
+			s.Files++
+			s.Size += fi.Size()
+		case 'd':
+			s.Dirs++
+			if dirSize {
+				s.Size += fi.Size()
+			}
+		case 'l':
+			s.Symlinks++
+		default:
+			s.Other++
+		}
+		if b := os2.Blocks(fi); b > 0 {
+			s.Allocated += b * 512
+		}
+	}
+	return s
+}
+
+func (s *summary) add(o summary) {
+	s.Files, s.Dirs, s.Symlinks, s.Other = s.Files+o.Files, s.Dirs+o.Dirs, s.Symlinks+o.Symlinks, s.Other+o.Other
+	s.Size, s.Allocated = s.Size+o.Size, s.Allocated+o.Allocated
+	s.Hidden, s.Filtered = s.Hidden+o.Hidden, s.Filtered+o.Filtered
+}
+
+// Format as "3 files, 1 directory; 12K (16K allocated); 2 hidden"; counts that
+// are zero are left out.
+func (s summary) format(blockSize string, comma bool) string {
+	plural := func(n int, one, many string) string {
+		if n == 1 {
+			return "1 " + one
+		}
+		return fmt.Sprintf("%d %s", n, many)
+	}
+	size := func(n int64) string {
+		if blockSize == "s" || blockSize == "S" { // Blocks make no sense here.
+			blockSize = ""
+		}
+		sz, _ := listSize(fakeFileinfo{n}, "", blockSize, comma, false, false)
+		return strings.TrimSpace(sz)
+	}
+
+	var counts []string
+	if s.Files > 0 || s.Dirs+s.Symlinks+s.Other == 0 {
+		counts = append(counts, plural(s.Files, "file", "files"))
+	}
+	if s.Dirs > 0 {
+		counts = append(counts, plural(s.Dirs, "directory", "directories"))
+	}
+	if s.Symlinks > 0 {
+		counts = append(counts, plural(s.Symlinks, "symlink", "symlinks"))
+	}
+	if s.Other > 0 {
+		counts = append(counts, plural(s.Other, "other", "other"))
+	}
+	parts := []string{strings.Join(counts, ", "),
+		fmt.Sprintf("%s (%s allocated)", size(s.Size), size(s.Allocated))}
+
+	var skipped []string
+	if s.Hidden > 0 {
+		skipped = append(skipped, fmt.Sprintf("%d hidden", s.Hidden))
+	}
+	if s.Filtered > 0 {
+		skipped = append(skipped, fmt.Sprintf("%d filtered", s.Filtered))
+	}
+	if len(skipped) > 0 {
+		parts = append(parts, strings.Join(skipped, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,249 @@
+package listing
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"zgo.at/elles/os2"
+)
+
+// Filesystem to list: an fs.FS if fsys is set, or the OS filesystem otherwise.
+// Archives mounted with openArchive() are read as an fs.FS too; see fsFor().
+type vfs struct {
+	fsys     fs.FS
+	archives map[string]fs.FS // By absolute path.
+	hashes   fileCache[string]
+	sniffed  fileCache[string]
+	exes     fileCache[*exeInfo]
+	texts    fileCache[*textStats]
+
+	ownerMu sync.Mutex
+	users   map[string]string // Username by UID; see owner().
+	groups  map[string]string // Group name by GID.
+
+	// Errors for things that are read while writing the listing, such as the
+	// size of directories for -D; set by gather().
+	errs *errGroup
+}
+
+// Cache for information read from the contents of files, such as hashes; see
+// cacheKey().
+type fileCache[T any] struct {
+	mu   sync.Mutex
+	m    map[string]T
+	used map[string]bool // Keys used since the last prune().
+}
+
+func (c *fileCache[T]) get(k string) (T, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.m[k]
+	if ok {
+		c.use(k)
+	}
+	return v, ok
+}
+
+func (c *fileCache[T]) set(k string, v T) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.m == nil {
+		c.m = make(map[string]T)
+	}
+	c.m[k] = v
+	c.use(k)
+}
+
+func (c *fileCache[T]) use(k string) {
+	if c.used == nil {
+		c.used = make(map[string]bool)
+	}
+	c.used[k] = true
+}
+
+// Remove everything that wasn't used since the last prune().
+func (c *fileCache[T]) prune() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k := range c.m {
+		if !c.used[k] {
+			delete(c.m, k)
+		}
+	}
+	c.used = nil
+}
+
+// Remove everything from the file caches that wasn't used since the last
+// prune(), so that listing the same paths over and over again doesn't keep
+// entries for files that were changed or removed.
+func (v *vfs) prune() {
+	v.hashes.prune()
+	v.sniffed.prune()
+	v.exes.prune()
+	v.texts.prune()
+}
+
+// Key for fileCache; includes the size and mtime so that files that changed
+// are read again.
+func cacheKey(absdir string, fi fs.FileInfo) string {
+	return fmt.Sprintf("%s\x00%d\x00%d", filepath.Join(absdir, fi.Name()), fi.Size(), fi.ModTime().UnixNano())
+}
+
+// Entries read from an fs.FS. Their paths don't exist on the OS filesystem, so
+// anything that needs a path (birth times, block sizes, hyperlinks) isn't
+// available.
+type (
+	fsInfo  struct{ fs.FileInfo }
+	fsEntry struct{ fs.DirEntry }
+)
+
+// Sys() always returns nil, as the functions in os2 expect a *syscall.Stat_t or
+// similar, and an fs.FS can return anything (such as a *zip.FileHeader).
+func (fsInfo) Sys() any { return nil }
+
+func (e fsEntry) Info() (fs.FileInfo, error) {
+	fi, err := e.DirEntry.Info()
+	if err != nil {
+		return nil, err
+	}
+	return fsInfo{fi}, nil
+}
+
+// Get the path inside the fs.FS; fs.FS only accepts unrooted paths with
+// forward slashes.
+func fsPath(p string) string {
+	return path.Clean(filepath.ToSlash(p))
+}
+
+// Get the absolute path; for an fs.FS this is the path from the root of the
+// fs.FS.
+func (v *vfs) abs(p string) (string, error) {
+	if v.fsys != nil {
+		return fsPath(p), nil
+	}
+	return filepath.Abs(p)
+}
+
+// Report if the directory isn't on the OS filesystem (i.e. it's in an archive or
+// fs.FS).
+func (v *vfs) virtual(absdir string) bool {
+	return v.fsys != nil || v.inArchive(absdir)
+}
+
+// Get the fs.FS to read p from, and the path inside it; this is either
+// Lister.FS or a mounted archive. Returns false for paths on the OS filesystem.
+func (v *vfs) fsFor(p string) (fs.FS, string, bool) {
+	if v.fsys != nil {
+		return v.fsys, fsPath(p), true
+	}
+	return v.archive(p)
+}
+
+func (v *vfs) lstat(p string) (fs.FileInfo, error) {
+	if fsys, name, ok := v.fsFor(p); ok {
+		fi, err := fs.Lstat(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		return fsInfo{fi}, nil
+	}
+	return os.Lstat(p)
+}
+
+func (v *vfs) stat(p string) (fs.FileInfo, error) {
+	if fsys, name, ok := v.fsFor(p); ok {
+		fi, err := fs.Stat(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		return fsInfo{fi}, nil
+	}
+	return os.Stat(p)
+}
+
+func (v *vfs) readDir(p string) ([]fs.DirEntry, error) {
+	if fsys, name, ok := v.fsFor(p); ok {
+		ls, err := fs.ReadDir(fsys, name)
+		for i := range ls {
+			ls[i] = fsEntry{ls[i]}
+		}
+		return ls, err
+	}
+	return os2.ReadDir(p)
+}
+
+func (v *vfs) open(p string) (fs.File, error) {
+	if fsys, name, ok := v.fsFor(p); ok {
+		return fsys.Open(name)
+	}
+	return os.Open(p)
+}
+
+func (v *vfs) readLink(p string) (string, error) {
+	if fsys, name, ok := v.fsFor(p); ok {
+		return fs.ReadLink(fsys, name)
+	}
+	return os.Readlink(p)
+}
+
+// Get the symlink target for the entry fi in dir; entries from archives and
+// snapshots have the target stored.
+func (v *vfs) linkTarget(dir string, fi fs.FileInfo) (string, error) {
+	if a := archiveEntry(fi); a != nil {
+		return a.link, nil
+	}
+	return v.readLink(filepath.Join(dir, fi.Name()))
+}
+
+func (v *vfs) inArchive(p string) bool {
+	_, _, ok := v.archive(p)
+	return ok
+}
+
+// Get the archive p is in, and the path inside the archive.
+func (v *vfs) archive(p string) (fs.FS, string, bool) {
+	if len(v.archives) == 0 {
+		return nil, "", false
+	}
+	ap, err := filepath.Abs(p)
+	if err != nil {
+		return nil, "", false
+	}
+	for root, a := range v.archives {
+		if ap == root {
+			return a, ".", true
+		}
+		if rel, ok := strings.CutPrefix(ap, root+string(filepath.Separator)); ok {
+			return a, filepath.ToSlash(rel), true
+		}
+	}
+	return nil, "", false
+}
+
+// Report if fi was read from an fs.FS or archive, rather than the OS
+// filesystem.
+func virtual(fi fs.FileInfo) bool {
+	for {
+		switch f := fi.(type) {
+		case *archiveInfo, fsInfo:
+			return true
+		case fileInfo:
+			fi = f.FileInfo
+		case *rdir:
+			fi = f.fi
+		case fakeFileInfo:
+			switch f.DirEntry.(type) {
+			case *archiveInfo, fsEntry:
+				return true
+			}
+			return false
+		default:
+			return false
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package listing
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"zgo.at/elles/os2"
+)
+
+// How long to highlight added and modified entries in Watch.
+const highlightFor = 3 * time.Second
+
+// Watch lists paths on Out, and lists them again every time something changes
+// until ctx is cancelled. Entries that were added or modified are highlighted
+// for a few seconds.
+//
+// This uses the alternate screen of the terminal, so Out should be a terminal.
+// Changes in archives or an fs.FS aren't noticed. Errors are shown below the
+// listing rather than returned, and it always returns nil when ctx is
+// cancelled.
+func (l Lister) Watch(ctx context.Context, paths ...string) error {
+	opt, err := l.prepare()
+	if err != nil {
+		return err
+	}
+	if opt.JSON {
+		return errors.New("can't use -json with -watch")
+	}
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	w, err := os2.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("-watch: %w", err)
+	}
+	defer w.Close()
+
+	fmt.Fprint(l.Out, "\x1b[?1049h\x1b[?25l") // Alternate screen, hide cursor.
+	defer fmt.Fprint(l.Out, "\x1b[?25h\x1b[?1049l")
+
+	type state struct {
+		size  int64
+		mtime time.Time
+		mode  fs.FileMode
+	}
+	var (
+		seen  map[string]state             // Entries in the last listing; nil for the first one.
+		until = make(map[string]time.Time) // Highlight these entries until this time.
+		timer = time.NewTimer(highlightFor)
+	)
+	timer.Stop()
+	for {
+		errs := &errGroup{MaxSize: 100}
+		toPrint := gather(slices.Values(paths), errs, opt)
+
+		now, cur := time.Now(), make(map[string]state)
+		for _, p := range toPrint {
+			if !p.isFiles && !opt.vfs.virtual(p.absdir) {
+				errs.Append(w.Add(p.absdir))
+			}
+			for _, fi := range p.fi {
+				if fi.filepathAbs != "" && !opt.vfs.virtual(fi.filepathAbs) {
+					errs.Append(w.Add(fi.filepathAbs))
+				}
+				k := filepath.Join(cmp.Or(fi.filepathAbs, p.absdir), fi.Name())
+				cur[k] = state{fi.Size(), fi.ModTime(), fi.Mode()}
+				if old, ok := seen[k]; seen != nil && (!ok || old != cur[k]) {
+					until[k] = now.Add(highlightFor)
+				}
+			}
+		}
+		seen = cur
+
+		// Highlight until the first one expires, and list again then.
+		opt.highlight = make(map[string]bool)
+		var next time.Time
+		for k, t := range until {
+			if _, ok := cur[k]; !ok || !t.After(now) {
+				delete(until, k)
+				continue
+			}
+			opt.highlight[k] = true
+			if next.IsZero() || t.Before(next) {
+				next = t
+			}
+		}
+		if !next.IsZero() {
+			timer.Reset(next.Sub(now))
+		}
+
+		// Write the entire screen at once and clear every line after writing
+		// it, rather than clearing the screen first, to prevent flickering.
+		var buf bytes.Buffer
+		err := Lister{Options: l.Options, FS: l.FS, Out: &buf}.write(toPrint, errs, opt)
+		if err != nil {
+			fmt.Fprintln(&buf, err)
+		}
+		screen := "\x1b[H" + strings.ReplaceAll(buf.String(), "\n", "\x1b[K\n") + "\x1b[J"
+		if _, err := fmt.Fprint(l.Out, screen); err != nil {
+			return err
+		}
+		opt.vfs.prune()
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-w.C:
+			// Files that are being written to send a lot of events; limit how
+			// often it's listed.
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil
+			case <-time.After(100 * time.Millisecond):
+			}
+		case <-timer.C:
+		}
+	}
+}
+
+// Highlight s with reverse video, re-applying it after every reset in s.
+func highlight(s, reset string) string {
+	if reset != "" {
+		s = strings.ReplaceAll(s, reset, reset+"\x1b[7m")
+	}
+	return "\x1b[7m" + s + "\x1b[27m"
+}
@@ -0,0 +1,94 @@
+package listing
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rivo/uniseg"
+)
+
+// textWidth gets the number of terminal cells s occupies.
+//
+// Most paths are plain ASCII, so check for that first as it's much faster than
+// segmenting everything in to grapheme clusters. s should not contain any
+// escape sequences.
+func textWidth(s string) int {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c >= utf8.RuneSelf || c < 0x20 || c == 0x7f {
+			return uniseg.StringWidth(s)
+		}
+	}
+	return len(s)
+}
+
+// trimWidth trims s to at most w terminal cells, returning the trimmed string
+// and its width.
+//
+// This will never cut through a grapheme cluster: a double-width character that
+// doesn't fit is dropped entirely, and combining characters stay with their
+// base character. Escape sequences (CSI colours and OSC hyperlinks) don't count
+// towards the width, and any that appear after the cut-off are still copied so
+// that colours get reset and links closed.
+func trimWidth(s string, w int) (string, int) {
+	var (
+		b     strings.Builder
+		have  int
+		full  bool
+		state = -1
+	)
+	b.Grow(len(s))
+	for len(s) > 0 {
+		if s[0] == 0x1b {
+			n := escLen(s)
+			b.WriteString(s[:n])
+			s = s[n:]
+			continue
+		}
+
+		var (
+			cluster string
+			cw      int
+		)
+		if s[0] < utf8.RuneSelf && (len(s) == 1 || s[1] < utf8.RuneSelf) {
+			// Fast path for ASCII not followed by something like a combining
+			// character (\r\n is also a cluster, but doQuote escapes that).
+			cluster, s, cw, state = s[:1], s[1:], 1, -1
+		} else {
+			cluster, s, cw, state = uniseg.FirstGraphemeClusterInString(s, state)
+		}
+		if full || have+cw > w {
+			full = true
+			continue
+		}
+		b.WriteString(cluster)
+		have += cw
+	}
+	return b.String(), have
+}
+
+// escLen gets the length of the escape sequence at the start of s.
+func escLen(s string) int {
+	if len(s) < 2 {
+		return len(s)
+	}
+	switch s[1] {
+	case '[': // CSI: ends with a byte in the 0x40–0x7e range.
+		for i := 2; i < len(s); i++ {
+			if s[i] >= 0x40 && s[i] <= 0x7e {
+				return i + 1
+			}
+		}
+	case ']': // OSC: ends with BEL or ST (ESC \).
+		for i := 2; i < len(s); i++ {
+			if s[i] == '\a' {
+				return i + 1
+			}
+			if s[i] == 0x1b && i+1 < len(s) && s[i+1] == '\\' {
+				return i + 2
+			}
+		}
+	default:
+		return 2
+	}
+	return len(s)
+}
@@ -1,22 +1,19 @@
 package main
 
 import (
-	"cmp"
+	"context"
 	"errors"
 	"fmt"
-	"io/fs"
-	"math"
+	"io"
 	"os"
-	"path/filepath"
-	"runtime"
-	"slices"
-	"sort"
+	"os/signal"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
+	"zgo.at/elles/listing"
 	"zgo.at/elles/os2"
-	"zgo.at/termtext"
 	"zgo.at/zli"
 )
 
@@ -24,10 +21,9 @@ var (
 	isTerm  = func() bool { return zli.IsTerminal(os.Stdout.Fd()) }()
 	columns = func() int {
 		if c := os.Getenv("COLUMNS"); c != "" {
-			if n, err := strconv.Atoi(c); err != nil && n > 0 {
+			if n, err := strconv.Atoi(c); err == nil && n > 0 {
 				return n
 			}
-
 		}
 
 		// On "| less", "| head", etc. we can get the width from stdin, but that
@@ -41,25 +37,15 @@ var (
 		}
 		return n
 	}()
-)
 
-type (
-	printable struct {
-		dir     string // Belongs in dir; can be empty.
-		absdir  string
-		isFiles bool
-		fi      []fileInfo
-	}
-	fileInfo struct {
-		fs.FileInfo
-		filepath, filepathAbs string
-	}
+	// Only used for the default "-h" sizes
+	testFixedSizeWidth bool
 )
 
 func main() {
 	f := zli.NewFlags(os.Args)
 	var (
-		help         = f.Bool(false, "help")
+		help         = f.Optional().String("", "help")
 		version      = f.Bool(false, "version")
 		manpage      = f.Bool(false, "manpage")
 		completion   = f.String("", "completion")
@@ -72,6 +58,7 @@ func main() {
 		hyperlink    = f.Optional().String("never", "hyperlink", "hyper")
 		color        = f.Optional().String("auto", "color", "colour")
 		colorBSD     = f.Bool(false, "G")
+		prColors     = f.Bool(false, "print-colors", "print-colours")
 		sortReverse  = f.Bool(false, "r", "reverse")
 		sortSize     = f.Bool(false, "S")
 		sortTime     = f.Bool(false, "t")
@@ -106,9 +93,34 @@ func main() {
 		minCols      = f.Int(0, "m", "min")
 		noExt        = f.Bool(false, "e", "no-ext")
 		dirSize      = f.Bool(false, "D", "dirsize")
+		bar          = f.Bool(false, "bar")
+		hash         = f.String("", "hash")
+		dupes        = f.Bool(false, "dupes")
+		sniff        = f.Bool(false, "sniff")
+		exe          = f.Bool(false, "exe")
+		text         = f.Bool(false, "text")
+		filterType   = f.String("", "type")
+		filterSize   = f.String("", "filesize")
+		filterNewer  = f.String("", "newer")
+		filterPerm   = f.String("", "perm")
+		filterEmpty  = f.Bool(false, "empty")
+		dirsOnly     = f.Bool(false, "dirs-only")
+		filesOnly    = f.Bool(false, "files-only")
+		groupFlag    = f.String("", "group")
+		browse       = f.Bool(false, "browse")
+		from         = f.String("", "from")
+		files0From   = f.String("", "files0-from")
+		compare      = f.Bool(false, "compare")
+		snapshot     = f.String("", "snapshot")
+		changes      = f.String("", "changes")
+		watch        = f.Bool(false, "watch")
 	)
 	zli.F(f.Parse(zli.AllowMultiple()))
-	if colorBSD.Bool() && !color.Set() {
+	if browse.Bool() { // Output is on /dev/tty, and stdout is usually redirected.
+		_, noColor := os.LookupEnv("NO_COLOR")
+		zli.WantColor = !noColor && os.Getenv("TERM") != "dumb"
+	}
+	if (colorBSD.Bool() || prColors.Bool()) && !color.Set() {
 		*color.Pointer() = "always"
 	}
 	switch strings.ToLower(color.String()) {
@@ -120,9 +132,38 @@ func main() {
 	default:
 		zli.Fatalf("invalid value for -color: %q", color)
 	}
-	setColor()
-	if help.Bool() {
-		fmt.Fprint(zli.Stdout, usage)
+	var colors *listing.Colors
+	if zli.WantColor {
+		var err error
+		colors, err = listing.LoadColors(termBackground)
+		// Invalid entries are skipped, so just warn.
+		var errs interface{ Unwrap() []error }
+		if errors.As(err, &errs) {
+			for _, e := range errs.Unwrap() {
+				zli.Errorf(e)
+			}
+		}
+	}
+	if help.Set() {
+		if h := help.String(); h != "" {
+			if fl, ok := usage.Flag(h); ok {
+				fmt.Fprint(zli.Stdout, fl.Format(columns))
+				return
+			}
+			if s, ok := usage.Section(h); ok {
+				fmt.Fprint(zli.Stdout, s.Format(columns))
+				return
+			}
+			zli.Fatalf("no flag or section %q; use -help to see the full help", h)
+		}
+		fmt.Fprint(zli.Stdout, usage.Format(columns))
+		return
+	}
+	if prColors.Bool() {
+		if colors == nil {
+			colors = &listing.Colors{}
+		}
+		colors.Print(zli.Stdout)
 		return
 	}
 	if version.Bool() {
@@ -130,13 +171,20 @@ func main() {
 		return
 	}
 	if manpage.Bool() {
-		fmt.Print(usage.Mandoc("elles", 1))
+		fmt.Fprint(zli.Stdout, usage.Mandoc("elles", 1))
 		return
 	}
 	if completion.Set() {
+		const site = "https://github.com/arp242/elles"
 		switch shell := completion.String(); shell {
 		case "zsh":
-			fmt.Print(zsh)
+			fmt.Fprint(zli.Stdout, zsh)
+		case "bash":
+			fmt.Fprint(zli.Stdout, usage.CompleteBash("elles", site))
+		case "fish":
+			fmt.Fprint(zli.Stdout, usage.CompleteFish("elles", site))
+		case "powershell", "pwsh":
+			fmt.Fprint(zli.Stdout, usage.CompletePowerShell("elles", site))
 		default:
 			zli.Fatalf("no completion for %q", shell)
 		}
@@ -161,17 +209,15 @@ func main() {
 		zli.Fatalf("invalid value for -hyperlink: %q", hyperlink)
 	}
 
-	nostat := list.Int() == 0 && !classify.Bool() && !inode.Bool() && !asJSON.Bool()
 	switch {
 	case sortNone.Bool():
 		*sortFlag.Pointer() = "none"
 	case sortNoneAll.Bool():
 		*sortFlag.Pointer() = "none-all"
 	case sortSize.Bool():
-		*sortFlag.Pointer(), nostat = "size", false
-		nostat = false
+		*sortFlag.Pointer() = "size"
 	case sortTime.Bool():
-		*sortFlag.Pointer(), nostat = "time", false
+		*sortFlag.Pointer() = "time"
 	case sortVersion.Bool():
 		*sortFlag.Pointer() = "version"
 	case sortExt.Bool():
@@ -179,11 +225,6 @@ func main() {
 	case sortWidth.Bool():
 		*sortFlag.Pointer() = "width"
 	}
-	switch sortFlag.String() {
-	case "name", "none", "none-all", "size", "time", "version", "ext", "extension", "width":
-	default:
-		zli.Fatalf("invalid value for -sort: %q", sortFlag.String())
-	}
 	timeField := "mtime"
 	if timeCreate.Bool() {
 		timeField = "btime"
@@ -191,565 +232,212 @@ func main() {
 		timeField = "atime"
 	}
 
-	if len(f.Args) == 0 {
-		f.Args = []string{"."}
-	}
-
-	errs := &errGroup{MaxSize: 100}
-
-	// Gather list to print.
-	toPrint := gather(f.Args, errs, all.Bool(), recurse.Bool(), dirSize.Bool(),
-		prDir.Bool(), derefCmdline.Bool(), derefAll.Bool(), nostat)
-
-	// Order it.
-	order(toPrint, sortFlag.String(), timeField, sortReverse.Bool(), dirsFirst.Bool(), dirSize.Bool())
-
-	// Print as JSON.
-	if asJSON.Bool() {
-		printJSON(toPrint, errs)
-		return
-	}
-
-	opt := opts{
-		blockSize:   blockSize.String(),
-		classify:    classify.Bool(),
-		cols:        cols.Bool(),
-		comma:       comma.Bool(),
-		dirSlash:    dirSlash.Bool(),
-		fullTime:    fullTime.Int(),
-		group:       group.Bool(),
-		hyperlink:   doLink,
-		inode:       inode.Bool(),
-		list:        list.Int(),
-		numericUID:  numericUID.Bool(),
-		octal:       octal.Bool(),
-		total:       total.Bool(),
-		one:         one.Bool(),
-		quote:       quote.Int(),
-		recurse:     recurse.Bool(),
-		timeField:   timeField,
-		trim:        trim.Bool(),
-		maxColWidth: width.Int(),
-		derefAll:    derefAll.Bool(),
-		minCols:     minCols.Int(),
-		noExt:       noExt.Bool(),
-		dirSize:     dirSize.Bool(),
-	}
-
-	draw(toPrint, errs, opt, cols.Set())
-}
-
-func draw(toPrint []printable, errs *errGroup, opt opts, colsSet bool) {
-	var tsize int64
-	for i, p := range toPrint {
-		// Print direcrory headers, but not when recursing with -D and there are
-		// no directories.
-		if len(toPrint) > 1 && p.dir != "" /*&& !(opt.dirsOnly && len(p.fi) == 0)*/ {
-			if i > 0 {
-				fmt.Fprintln(zli.Stdout)
-			}
-			fmt.Fprintln(zli.Stdout, filepath.ToSlash(filepath.Clean(p.dir))+":")
+	l := listing.Lister{
+		Out: zli.Stdout,
+		Options: listing.Options{
+			All:         all.Bool(),
+			Directory:   prDir.Bool(),
+			Recurse:     recurse.Bool(),
+			DerefArgs:   derefCmdline.Bool(),
+			DerefAll:    derefAll.Bool(),
+			DirSize:     dirSize.Bool(),
+			Type:        filterType.String(),
+			FileSize:    filterSize.String(),
+			Newer:       filterNewer.String(),
+			Perm:        filterPerm.String(),
+			Empty:       filterEmpty.Bool(),
+			DirsOnly:    dirsOnly.Bool(),
+			FilesOnly:   filesOnly.Bool(),
+			JSON:        asJSON.Bool(),
+			Long:        list.Int(),
+			One:         one.Bool(),
+			Cols:        cols.Set(),
+			Width:       columns,
+			MaxColWidth: width.Int(),
+			MinCols:     minCols.Int(),
+			Trim:        trim.Bool(),
+			Hyperlink:   doLink,
+			Classify:    classify.Bool(),
+			DirSlash:    dirSlash.Bool(),
+			Inode:       inode.Bool(),
+			NumericUID:  numericUID.Bool(),
+			Group:       group.Bool(),
+			Octal:       octal.Bool(),
+			NoExt:       noExt.Bool(),
+			Comma:       comma.Bool(),
+			Total:       total.Bool(),
+			Bar:         bar.Bool(),
+			Hash:        hash.String(),
+			Sniff:       sniff.Bool(),
+			Exe:         exe.Bool(),
+			Text:        text.Bool(),
+			Quote:       quote.Int(),
+			Colors:      colors,
+			FullTime:    fullTime.Int(),
+			BlockSize:   blockSize.String(),
+			TimeField:   timeField,
+			Sort:        sortFlag.String(),
+			Reverse:     sortReverse.Bool(),
+			DirsFirst:   dirsFirst.Bool(),
+			GroupBy:     groupFlag.String(),
+
+			FixedSizeWidth: testFixedSizeWidth,
+		},
+	}
+
+	if browse.Bool() {
+		if len(f.Args) > 1 {
+			zli.Fatalf("-browse accepts only one directory")
 		}
-
-		// Format for output in memory first. This makes alignment much easier
-		// because we may or may not add things such as "/". Even with very
-		// large directories it shouldn't take more than a few hundred K.
-		cc := getCols(p, opt)
-		tsize += cc.tsize
-
-	refmt:
-		var (
-			fmtRows = make([]string, 0, len(cc.rows))
-			widths  = make([]int, 0, len(cc.rows))
-			longest int
-			buf     strings.Builder
-			w       int
-		)
-		for _, r := range cc.rows {
-			buf.Reset()
-			w = 0
-			for i, c := range r {
-				if i > 0 {
-					buf.WriteString(" ")
-					w++
-				}
-
-				if c.prop&borderToLeft != 0 {
-					buf.WriteString("│ ")
-					w += 2
-				}
-				if c.prop&alignNone != 0 {
-					w += c.w
-					buf.WriteString(c.s)
-				} else if c.prop&alignLeft != 0 {
-					pad := cc.longest[i] - c.w
-					buf.WriteString(c.s)
-					buf.WriteString(strings.Repeat(" ", pad))
-					w += c.w + pad
-				} else {
-					pad := cc.longest[i] - c.w
-					buf.WriteString(strings.Repeat(" ", pad))
-					buf.WriteString(c.s)
-					w += c.w + pad
-				}
-			}
-
-			b := buf.String()
-			if opt.maxColWidth > 0 && w > opt.maxColWidth {
-				b = termtext.Slice(b, 0, opt.maxColWidth-1) + reset + "…"
-				w = opt.maxColWidth
-			}
-			fmtRows, widths = append(fmtRows, b), append(widths, w)
-			if w > longest {
-				longest = w
-			}
+		dir := "."
+		if len(f.Args) == 1 {
+			dir = f.Args[0]
 		}
-
-	one:
-		if (opt.one && !colsSet) || (opt.list > 0 && !colsSet) {
-			for i, f := range fmtRows {
-				if columns > 0 && opt.trim && widths[i] > columns {
-					f = termtext.Slice(f, 0, columns-1) + reset + "…"
-				}
-				fmt.Fprintln(zli.Stdout, f)
-			}
-		} else {
-			var (
-				colwidths []int
-				rows      [][]string
-				pad       = 2
-			)
-			if opt.list > 0 {
-				pad = 4
-			}
-			for i := range 200 {
-				if i == 0 {
-					continue
-				}
-				r, w := recol(fmtRows, widths, i, pad)
-				if sum(w) > columns {
-					if i <= 1 {
-						rows, colwidths = r, w
-					}
-					break
-				}
-				rows, colwidths = r, w
-			}
-			if opt.minCols > 0 && len(colwidths) < opt.minCols {
-				if opt.maxColWidth == 0 {
-					opt.maxColWidth = longest - 1
-				} else {
-					opt.maxColWidth--
-				}
-				goto refmt
-			}
-
-			// Only space for one column; restart as if -1 was set. Saves some
-			// special-fu here.
-			if len(colwidths) == 1 {
-				opt.one, colsSet = true, false
-				goto one
-			}
-
-			for i, r := range rows {
-				for j, c := range r {
-					x := i + len(rows)*j
-					if opt.list > 0 && j != len(r)-1 {
-						fmt.Fprint(zli.Stdout, c, strings.Repeat(" ", colwidths[j]-widths[x]-2))
-						fmt.Fprint(zli.Stdout, "┃ ")
-					} else {
-						fmt.Fprint(zli.Stdout, c)
-						if j != len(r)-1 {
-							fmt.Fprint(zli.Stdout, strings.Repeat(" ", colwidths[j]-widths[x]))
-						}
-					}
-				}
-				fmt.Fprintln(zli.Stdout)
-			}
+		sel, err := l.Browse(dir)
+		zli.F(err)
+		if sel == "" {
+			zli.Exit(1)
 		}
+		fmt.Fprintln(zli.Stdout, sel)
+		return
 	}
 
-	// ls prints the total at the top, but printing it at the bottom makes much
-	// more sense to me.
-	if opt.list > 0 && opt.total {
-		sz, _ := listSize(fakeFileinfo{tsize}, "", opt.blockSize, opt.comma, false)
-		fmt.Fprintln(zli.Stdout, "Total:", sz)
+	var err error
+	switch {
+	case compare.Bool():
+		if len(f.Args) != 2 {
+			zli.Fatalf("-compare needs two directories")
+		}
+		err = l.Compare(f.Args[0], f.Args[1])
+	case watch.Bool():
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		err = l.Watch(ctx, f.Args...)
+		stop()
+	case dupes.Bool():
+		err = l.Dupes(f.Args...)
+	case snapshot.Set():
+		err = writeSnapshot(l, snapshot.String(), f.Args)
+	case changes.Set():
+		err = listChanges(l, changes.String(), f.Args)
+	case from.Set() || files0From.Set():
+		err = listFrom(l, from.String(), files0From.String(), f.Args)
+	default:
+		err = l.List(f.Args...)
 	}
 
-	// Print errors last, so they're more visible. ls does this at the top, and
-	// it's easy to miss if pushed off the screen.
-	for _, e := range errs.List() {
-		zli.Errorf(e)
-	}
-	if errs.Len() > 0 {
+	// Errors for entries that couldn't be read are printed last, so they're
+	// more visible. ls does this at the top, and it's easy to miss if pushed
+	// off the screen.
+	var errs interface{ Unwrap() []error }
+	if errors.As(err, &errs) {
+		for _, e := range errs.Unwrap() {
+			zli.Errorf(e)
+		}
 		zli.Exit(1)
 	}
+	zli.F(err)
 }
 
-type fakeFileinfo struct{ sz int64 }
-
-func (f fakeFileinfo) Name() string       { return "" }
-func (f fakeFileinfo) Size() int64        { return f.sz }
-func (f fakeFileinfo) Mode() fs.FileMode  { return 0 }
-func (f fakeFileinfo) ModTime() time.Time { return time.Time{} }
-func (f fakeFileinfo) IsDir() bool        { return false }
-func (f fakeFileinfo) Sys() any           { return nil }
-
-func recol(paths []string, pathWidths []int, ncols, pad int) ([][]string, []int) {
-	var (
-		rows   = make([][]string, 0, 8)
-		widths = make([]int, ncols)
-		height = int(math.Ceil(float64(len(paths)) / float64(ncols)))
-	)
-	for i := range height {
-		row := make([]string, 0, ncols)
-		for c := range ncols {
-			j := i + height*c
-			if j > len(paths)-1 {
-				break
-			}
-
-			l := pathWidths[j]
-			if c < ncols-1 {
-				l += pad
-			}
-			if l > widths[c] {
-				widths[c] = l
-			}
-			row = append(row, paths[j])
-		}
-		rows = append(rows, row)
+// List the paths read from a file for -from and -files0-from; "-" reads from
+// stdin.
+func listFrom(l listing.Lister, from, files0From string, args []string) error {
+	if from != "" && files0From != "" {
+		return errors.New("can't use -from and -files0-from together")
 	}
-	if i := slices.Index(widths, 0); i > -1 {
-		widths = widths[:i]
+	if len(args) > 0 {
+		return errors.New("can't use -from or -files0-from with paths")
 	}
-	return rows, widths
-}
-
-func sum(s []int) int {
-	var n int
-	for _, ss := range s {
-		n += ss
+	p, sep := from, byte('\n')
+	if files0From != "" {
+		p, sep = files0From, 0
 	}
-	return n
-}
-
-// Gather list of everything we want to print.
-func gather(args []string, errs *errGroup, all, recurse, dirSize, prDir, derefCmd, derefAll, nostat bool) []printable {
-	var (
-		toPrint    = make([]printable, 0, 16)
-		filesIndex = -1 // index in toPrint for individual files.
-		stat       = os.Lstat
-	)
-	if derefCmd {
-		stat = os.Stat
+	if p == "" {
+		return errors.New("-from and -files0-from need a file, or - for stdin")
 	}
-	//cwd, err := os.Getwd()
-	//errs.Append(err)
 
-	var addArg func(string)
-	addArg = func(a string) {
-		fi, err := stat(a)
+	var r io.Reader = os.Stdin
+	if p != "-" {
+		fp, err := os.Open(p)
 		if err != nil {
-			if a == "." && errors.Is(err, os.ErrNotExist) {
-				return
-			}
-			if errs.Append(err) {
-				return
-			}
+			return err
 		}
-
-		if fi.IsDir() && !prDir { /// Directory.
-			ls, err := os2.ReadDir(a)
-			if err != nil {
-				if a == "." && errors.Is(err, os.ErrNotExist) {
-					return
-				}
-				errs.Append(err)
-				return
-			}
-
-			d := a
-			//if strings.TrimRight(d, "/") == "." {
-			//	d = cwd
-			//}
-			if !filepath.IsAbs(d) {
-				if d == "." || d == "./" {
-					d = "."
-				} else {
-					d = string(append([]byte{'.', filepath.Separator}, d...))
-				}
-			}
-			ad, err := filepath.Abs(d)
-			errs.Append(err)
-			pr := printable{
-				dir:    d,
-				absdir: ad,
-				fi:     make([]fileInfo, 0, len(ls)),
-			}
-			var subdirs []string
-			for _, l := range ls {
-				if os2.Hidden(ad, l) && !all {
-					continue
-				}
-				//if !l.IsDir() && dirsOnly { continue }
-
-				// Don't call stat if we don't need to.
-				if nostat {
-					pr.fi = append(pr.fi, fileInfo{fakeFileInfo{l}, "", ""})
-				} else {
-					var fi fs.FileInfo
-					if derefAll {
-						fi, err = os.Stat(filepath.Join(ad, l.Name()))
-					} else {
-						fi, err = l.Info()
-					}
-					if errs.Append(err) {
-						// Don't skip the entire file, just don't add stat info.
-						pr.fi = append(pr.fi, fileInfo{fakeFileInfo{l}, "", ""})
-					} else {
-						if fi.IsDir() && dirSize {
-							fi = &rdir{path: filepath.Join(ad, l.Name()), fi: fi}
-						}
-						pr.fi = append(pr.fi, fileInfo{fi, "", ""})
-					}
-				}
-
-				if recurse && l.IsDir() {
-					subdirs = append(subdirs, filepath.Join(d, l.Name()))
-				}
-			}
-			toPrint = append(toPrint, pr)
-			for _, s := range subdirs {
-				addArg(s)
-			}
-		} else { /// Single file (or directory with -d).
-			if prDir {
-				a = strings.TrimRight(a, "/")
-			}
-			d := strings.TrimSuffix(a, fi.Name())
-			ad, err := filepath.Abs(d)
-			errs.Append(err)
-			if fi.IsDir() && dirSize {
-				fi = &rdir{path: filepath.Join(ad, fi.Name()), fi: fi}
-			}
-
-			if filesIndex == -1 {
-				toPrint = append(toPrint, printable{
-					dir:     d,
-					absdir:  ad,
-					isFiles: true,
-					fi:      []fileInfo{{fi, d, ad}},
-				})
-				filesIndex = len(toPrint) - 1
-			} else {
-				toPrint[filesIndex].fi = append(toPrint[filesIndex].fi, fileInfo{fi, d, ad})
-			}
-		}
-	}
-	for _, a := range args {
-		// Make sure "ls /" and "ls C:" work on Windows.
-		if runtime.GOOS == "windows" {
-			if a == "/" {
-				wd, err := os.Getwd()
-				if err == nil {
-					a = filepath.VolumeName(wd) + `\`
-				}
-			} else if len(a) == 2 && a[1] == ':' {
-				a += `\`
-			}
-		}
-		addArg(a)
+		defer fp.Close()
+		r = fp
 	}
-	return toPrint
+	return l.ListFrom(r, sep)
 }
 
-//func getEnv(name string) (string, bool) {
-//	l, ok := os.LookupEnv(name)
-//	if !ok {
-//		return "", false
-//	}
-//	l = strings.SplitN(l, ".", 2)[0] // Remove ".UTF-8" or ".ASCII" encoding
-//	if l == "" || l == "C" {         // We can't do anything with this.
-//		return "", false
-//	}
-//	return l, true
-//}
-
-// Sort files.
-func order(toPrint []printable, sortby, timeField string, reverse, dirsFirst, dirSize bool) {
-	var (
-		sorter func(a, b fileInfo) int
-		// TODO: Hack for Linux btime, until we rewrite some of the stdlib stuff.
-		sorter2 func(printable) func(a, b fileInfo) int
-
-		nameSort = func(a, b fileInfo) int { return cmp.Compare(a.Name(), b.Name()) }
-	)
-
-	// var (
-	// 	lang     language.Tag
-	// 	haveLang bool
-	// )
-	// for _, v := range []string{"LC_COLLATE", "LC_ALL", "LANG"} {
-	// 	if e, ok := getEnv(v); ok {
-	// 		langs, _, err := language.ParseAcceptLanguage(e)
-	// 		if err != nil || len(langs) == 0 {
-	// 			zli.Errorf("invalid %s: %s", v, err)
-	// 		}
-	// 		lang, haveLang = langs[0], true
-	// 		break
-	// 	}
-	// }
-	//if haveLang {
-	//	col := collate.New(lang, collate.WithCase)
-	//	nameSort = func(a, b fs.FileInfo) int { return col.CompareString(a.Name(), b.Name()) }
-	//}
-
-	switch sortby {
-	case "size":
-		// Make sure we have consistent sorting for -S, and also sort "below" 0.
-		sorter = func(a, b fileInfo) int {
-			n1, n2 := a.Size(), b.Size()
-			if (!dirSize && a.IsDir()) || a.Mode()&fs.ModeSymlink != 0 {
-				n1 = -1
-			}
-			if (!dirSize && b.IsDir()) || b.Mode()&fs.ModeSymlink != 0 {
-				n2 = -1
-			}
-			return cmp.Compare(n2, n1)
-		}
-	case "time":
-		switch timeField {
-		case "btime":
-			sorter = nil
-			sorter2 = func(p printable) func(a, b fileInfo) int {
-				return func(a, b fileInfo) int { return os2.Btime(p.absdir, b).Compare(os2.Btime(p.absdir, a)) }
-			}
-		case "atime":
-			sorter = func(a, b fileInfo) int { return os2.Atime(b).Compare(os2.Atime(a)) }
-		default:
-			sorter = func(a, b fileInfo) int { return b.ModTime().Compare(a.ModTime()) }
-		}
-	case "ext", "extension":
-		sorter = func(a, b fileInfo) int { return cmp.Compare(filepath.Ext(a.Name()), filepath.Ext(b.Name())) }
-	case "version":
-		sorter = func(a, b fileInfo) int { return versCompare(a.Name(), b.Name()) }
-	case "width":
-		// TODO: maybe make it sort by display width (with quotes and all of
-		// that)? That's what GNU ls does.
-		sorter = func(a, b fileInfo) int { return cmp.Compare(len([]rune(a.Name())), len([]rune(b.Name()))) }
-	case "none", "none-all":
-		sorter, nameSort = nil, nil
-	default:
-		sorter, nameSort = nameSort, nil
+// Write a snapshot for -snapshot.
+func writeSnapshot(l listing.Lister, p string, args []string) error {
+	if p == "" {
+		return errors.New("-snapshot needs a file")
 	}
-	if sorter != nil || sorter2 != nil {
-		for _, p := range toPrint {
-			if nameSort != nil {
-				slices.SortFunc(p.fi, nameSort)
-			}
-			if sorter2 != nil {
-				slices.SortStableFunc(p.fi, sorter2(p))
-			} else {
-				slices.SortStableFunc(p.fi, sorter)
-			}
-		}
+	fp, err := os.Create(p)
+	if err != nil {
+		return err
 	}
-	if reverse {
-		for _, p := range toPrint {
-			slices.Reverse(p.fi)
-		}
+	err = l.Snapshot(fp, args...)
+	if cErr := fp.Close(); err == nil {
+		err = cErr
 	}
-	if dirsFirst {
-		isdir := func(dir string, fi fileInfo) bool {
-			if fi.IsDir() {
-				return true
-			}
-			if fi.Mode()&fs.ModeSymlink == 0 {
-				return false
-			}
-			// Symlink to dir should be counted as a "directory".
-			l, err := os.Readlink(filepath.Join(dir, fi.Name()))
-			if err != nil {
-				return false
-			}
-			st, err := os.Stat(filepath.Join(dir, l))
-			return err == nil && st.IsDir()
-		}
-		for _, p := range toPrint {
-			sort.SliceStable(p.fi, func(i, j int) bool {
-				return isdir(p.dir, p.fi[i]) && !isdir(p.dir, p.fi[j])
-			})
-		}
-	}
-	slices.SortFunc(toPrint, func(a, b printable) int {
-		if a.isFiles {
-			return -1
-		}
-		return cmp.Compare(a.dir, b.dir)
-	})
+	return err
 }
 
-// cmp(a, b) should return a negative number when a < b, a positive number when
-// a > b and zero when a == b.
-func versCompare(a, b string) int {
-	if a == b {
-		return 0
-	}
-	getNum := func(s string) (int, int, int) {
-		var nonzero bool
-		start, end, zeros := -1, -1, 0
-		for i, c := range s {
-			if start == -1 && isdigit(c) {
-				if c == '0' {
-					zeros++
-				} else {
-					nonzero = true
-				}
-				start = i
-				continue
-			}
-			if start > -1 && c >= '1' {
-				nonzero = true
-			}
-			if !nonzero {
-				zeros++
-			}
-			if start > -1 && !isdigit(c) {
-				end = i
-				break
-			}
-		}
-		if start > -1 && end == -1 {
-			end = len(s)
-		}
-		return start, end, zeros
+// List the changes since a snapshot for -changes.
+func listChanges(l listing.Lister, p string, args []string) error {
+	if p == "" {
+		return errors.New("-changes needs a file")
 	}
-
-	startA, endA, zeroA := getNum(a)
-	if startA == -1 {
-		return cmp.Compare(a, b)
+	if len(args) > 0 {
+		return errors.New("can't use -changes with paths; the directories in the snapshot are compared")
 	}
-	startB, endB, zeroB := getNum(b)
-	if startB == -1 {
-		return cmp.Compare(a, b)
+	fp, err := os.Open(p)
+	if err != nil {
+		return err
 	}
+	defer fp.Close()
+	return l.Changes(fp)
+}
 
-	if zeroA != zeroB {
-		return zeroB - zeroA
+// Report if the terminal has a "light" or "dark" background, or "" if we can't
+// tell; this is used to pick the colour theme.
+//
+// This asks the terminal with an OSC 11 query. This is followed by a DA1 query,
+// which every terminal answers, so we don't need to wait for the timeout on
+// terminals that don't understand OSC 11.
+func termBackground() string {
+	if !isTerm || os.Getenv("TERM") == "dumb" {
+		return ""
+	}
+	reply, err := os2.QueryTerminal("\x1b]11;?\x1b\\\x1b[c", 250*time.Millisecond, func(b []byte) bool {
+		return reDA1.Match(b)
+	})
+	if err != nil {
+		return ""
 	}
-
-	na, _ := strconv.ParseInt(a[startA:endA], 10, 64)
-	nb, _ := strconv.ParseInt(b[startB:endB], 10, 64)
-
-	return int(na - nb)
+	return parseOSC11(reply)
 }
 
-func isdigit(c rune) bool { return c >= '0' && c <= '9' }
-
-type fakeFileInfo struct{ fs.DirEntry }
+var (
+	reDA1   = regexp.MustCompile(`\x1b\[\?[0-9;]*c`)
+	reOSC11 = regexp.MustCompile(`\x1b\]11;rgba?:([0-9a-fA-F]{1,4})/([0-9a-fA-F]{1,4})/([0-9a-fA-F]{1,4})`)
+)
 
-func (fakeFileInfo) ModTime() time.Time  { return time.Time{} }
-func (fakeFileInfo) Sys() any            { return nil }
-func (fakeFileInfo) Size() int64         { return -1 }
-func (f fakeFileInfo) Mode() fs.FileMode { return f.Type() }
+// Get "light" or "dark" from the reply to an OSC 11 query, which looks like
+// "\e]11;rgb:ffff/ffff/ffff\e\\".
+func parseOSC11(reply []byte) string {
+	m := reOSC11.FindSubmatch(reply)
+	if m == nil {
+		return ""
+	}
+	var rgb [3]float64
+	for i := range rgb {
+		n, _ := strconv.ParseUint(string(m[i+1]), 16, 16)
+		rgb[i] = float64(n) / float64(uint64(1)<<(4*len(m[i+1]))-1)
+	}
+	// Relative luminance, as in WCAG.
+	if 0.2126*rgb[0]+0.7152*rgb[1]+0.0722*rgb[2] > 0.5 {
+		return "light"
+	}
+	return "dark"
+}
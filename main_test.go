@@ -1,13 +1,23 @@
 package main
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
 	"net"
 	"os"
+	"os/exec"
 	"os/user"
 	"path/filepath"
 	"reflect"
+	"regexp"
 	"runtime"
 	"strconv"
 	"strings"
@@ -15,62 +25,12 @@ import (
 	"time"
 
 	"zgo.at/elles/os2"
+	"zgo.at/elles/zli2"
 )
 
 // Includes tests converted from FreeBSD (commit 0dfd11abc) and GNU coreutils
 // (commit bbc972b).
 
-func TestGroupDigits(t *testing.T) {
-	tests := []struct {
-		in, want string
-	}{
-		{"", ""},
-		{"1", "1"},
-		{"12", "12"},
-		{"123", "123"},
-		{"1234", "1,234"},
-		{"123456", "123,456"},
-		{"12345678", "12,345,678"},
-
-		{"123.0", "123.0"},
-		{"123.10", "123.10"},
-		{"1234.0", "1,234.0"},
-		{"1234.10", "1,234.10"},
-		{"123456.0", "123,456.0"},
-		{"123456.10", "123,456.10"},
-		{"12345678.0", "12,345,678.0"},
-		{"12345678.10", "12,345,678.10"},
-
-		{"102G", "102G"},
-		{"1024G", "1,024G"},
-	}
-	for _, tt := range tests {
-		t.Run(tt.in, func(t *testing.T) {
-			have := groupDigits(tt.in)
-			if have != tt.want {
-				t.Errorf("\nhave: %q\nwant: %q", have, tt.want)
-			}
-		})
-	}
-}
-
-func BenchmarkGroupDigits(b *testing.B) {
-	var g any
-	b.Run("no suffix", func(b *testing.B) {
-		b.ReportAllocs()
-		for n := 0; n < b.N; n++ {
-			g = groupDigits("12345678.10")
-		}
-	})
-	b.Run("with suffix", func(b *testing.B) {
-		b.ReportAllocs()
-		for n := 0; n < b.N; n++ {
-			g = groupDigits("12345678K")
-		}
-	})
-	_ = g
-}
-
 func TestJSON(t *testing.T) {
 	if isCI() || runtime.GOOS == "windows" {
 		t.Skip("TODO")
@@ -85,7 +45,8 @@ func TestJSON(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	err = json.Unmarshal([]byte(`
+	ids := strings.NewReplacer("UID", strconv.Itoa(os.Getuid()), "GID", strconv.Itoa(os.Getgid()))
+	err = json.Unmarshal([]byte(ids.Replace(norm(`
 		[{
 		  "abs_dir": "/tmp/TestJSON3123184094/001",
 		  "dir":     ".",
@@ -97,7 +58,11 @@ func TestJSON(t *testing.T) {
 		      "name":        "file1",
 		      "permission":  420,
 		      "size":        0,
-		      "type":        0
+		      "type":        0,
+		      "owner":       "martin",
+		      "group":       "tournoij",
+		      "uid":         "UID",
+		      "gid":         "GID"
 		    },
 		    {
 		      "access_time": "2024-06-10T01:39:35.284680724+01:00",
@@ -106,10 +71,14 @@ func TestJSON(t *testing.T) {
 		      "name":        "file2",
 		      "permission":  420,
 		      "size":        0,
-		      "type":        0
+		      "type":        0,
+		      "owner":       "martin",
+		      "group":       "tournoij",
+		      "uid":         "UID",
+		      "gid":         "GID"
 		    }
 		  ]
-		}]`), &want)
+		}]`))), &want)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1295,6 +1264,57 @@ func TestWidth(t *testing.T) {
 	}
 }
 
+func TestDisplayWidth(t *testing.T) {
+	defer func() { columns = 80 }()
+	start(t)
+
+	for _, f := range []string{"a", "bb", "ccc", "dddd", "日本語", "アセット素材", "ééé", "👍🏽xx"} {
+		touch(t, f)
+	}
+
+	{
+		columns = 30
+		have := mustRun(t, "-C")
+		want := norm(`
+			a   ccc   ééé           日本語
+			bb  dddd  アセット素材  👍🏽xx`)
+		if have != want {
+			t.Errorf("\nhave:\n%s\n\nwant:\n%s", have, want)
+		}
+	}
+	{
+		// Never cut through a double-width character or combining characters.
+		have := mustRun(t, "-1w3")
+		want := norm(`
+			a
+			bb
+			ccc
+			dd…
+			ééé
+			ア…
+			日…
+			👍🏽…`)
+		if have != want {
+			t.Errorf("\nhave:\n%s\n\nwant:\n%s", have, want)
+		}
+	}
+	{
+		have := mustRun(t, "-1w2")
+		want := norm(`
+			a
+			bb
+			c…
+			d…
+			é…
+			…
+			…
+			…`)
+		if have != want {
+			t.Errorf("\nhave:\n%s\n\nwant:\n%s", have, want)
+		}
+	}
+}
+
 func TestRecurse(t *testing.T) {
 	start(t)
 
@@ -1852,3 +1872,1025 @@ func TestNamelessUID(t *testing.T) {
 		}
 	}
 }
+
+func TestCompletion(t *testing.T) {
+	for _, shell := range []string{"zsh", "bash", "fish", "powershell"} {
+		t.Run(shell, func(t *testing.T) {
+			out := mustRun(t, "-completion="+shell)
+			if !strings.Contains(out, "sort") || !strings.Contains(out, "always") {
+				t.Errorf("incomplete output:\n%s", out)
+			}
+		})
+	}
+
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("no bash")
+	}
+	tmp := t.TempDir()
+	echoTrunc(t, mustRun(t, "-completion=bash"), tmp, "elles.bash")
+
+	tests := []struct {
+		words []string
+		want  string
+	}{
+		{[]string{"-so"}, "-sort="},
+		{[]string{"-sort", "=", "t"}, "time"},
+		{[]string{"-sort", "="}, "none size time version extension width"},
+		{[]string{"-sort", "t"}, "time"},
+		{[]string{"--sort", "=", "v"}, "version"},
+		{[]string{"-sort=", "v"}, "version"},
+		{[]string{"-color", "=", "a"}, "always auto"},
+		{[]string{"-completion", "=", "f"}, "fish"},
+		{[]string{"--col"}, "--color="},
+		{[]string{"-S", "-sor"}, ""},       // Conflicts
+		{[]string{"-sort=time", "-S"}, ""}, // Conflicts
+		{[]string{"-l", "-l"}, "-l"},       // Repeatable
+		{[]string{"-a", "-al"}, "-almost-all"},
+		{[]string{"-all", "-al"}, "-almost-all"},
+		{[]string{"-he"}, "-help="},
+		{[]string{"-l", "-he"}, ""},
+		{[]string{"-version", "-"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.words, " "), func(t *testing.T) {
+			// Split -sort=v like bash does.
+			words := []string{"elles"}
+			for _, w := range tt.words {
+				if a, b, ok := strings.Cut(w, "="); ok && w != "=" {
+					words = append(words, a, "=")
+					if b != "" {
+						words = append(words, b)
+					}
+				} else {
+					words = append(words, w)
+				}
+			}
+			script := fmt.Sprintf(`source %q; COMP_WORDS=(%s); COMP_CWORD=%d; compopt() { :; }; _elles; echo "${COMPREPLY[*]}"`,
+				join(tmp, "elles.bash"), strings.Join(words, " "), len(words)-1)
+			out, err := exec.Command("bash", "-c", script).CombinedOutput()
+			if err != nil {
+				t.Fatalf("%s: %s", err, out)
+			}
+			if have := strings.TrimSpace(string(out)); have != tt.want {
+				t.Errorf("\nhave: %q\nwant: %q", have, tt.want)
+			}
+		})
+	}
+}
+
+// Make sure all flags registered in main() are documented in the usage, and
+// that the usage doesn't document flags that don't exist.
+func TestUsageFlags(t *testing.T) {
+	type reg struct {
+		kind     string
+		optional bool
+		names    []string
+	}
+	var regs []reg
+
+	fp, err := parser.ParseFile(token.NewFileSet(), "main.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range fp.Decls {
+		if fn, ok := d.(*ast.FuncDecl); !ok || fn.Name.Name != "main" {
+			continue
+		}
+		ast.Inspect(d, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok || len(call.Args) < 2 {
+				return true
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			recv, optional := sel.X, false
+			if c, ok := recv.(*ast.CallExpr); ok {
+				if s, ok := c.Fun.(*ast.SelectorExpr); ok && s.Sel.Name == "Optional" {
+					recv, optional = s.X, true
+				}
+			}
+			if id, ok := recv.(*ast.Ident); !ok || id.Name != "f" {
+				return true
+			}
+			r := reg{kind: sel.Sel.Name, optional: optional}
+			for _, a := range call.Args[1:] {
+				if lit, ok := a.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+					s, _ := strconv.Unquote(lit.Value)
+					r.names = append(r.names, s)
+				}
+			}
+			regs = append(regs, r)
+			return true
+		})
+	}
+	if len(regs) < 10 {
+		t.Fatalf("found only %d flags in main.go", len(regs))
+	}
+
+	documented := make(map[string]zli2.Flag)
+	for _, s := range usage.Sections {
+		for _, f := range s.Flags {
+			for _, n := range append(f.Bare(), f.Aliases...) {
+				documented[n] = f
+			}
+		}
+	}
+
+	registered := make(map[string]bool)
+	for _, r := range regs {
+		for _, n := range r.names {
+			registered[n] = true
+			f, ok := documented[n]
+			if !ok {
+				t.Errorf("flag -%s is not documented", n)
+				continue
+			}
+			switch {
+			case r.kind == "Bool" && f.Arg != "":
+				t.Errorf("-%s: boolean flag documented with argument %q", n, f.Arg)
+			case r.kind != "Bool" && r.kind != "IntCounter" && f.Arg == "":
+				t.Errorf("-%s: %s flag documented without argument", n, r.kind)
+			case r.kind == "Int" && f.Kind != "number":
+				t.Errorf("-%s: Int flag documented with argument kind %q", n, f.Kind)
+			case r.kind == "IntCounter" && !f.Repeat:
+				t.Errorf("-%s: IntCounter flag not documented as repeatable", n)
+			case r.optional != f.Optional:
+				t.Errorf("-%s: optional is %t in main.go, but %t in the usage", n, r.optional, f.Optional)
+			}
+		}
+	}
+
+	for n := range documented {
+		if registered[n] {
+			continue
+		}
+		// Combined short flags, such as -tc.
+		combined := true
+		for _, c := range n {
+			combined = combined && registered[string(c)]
+		}
+		if !combined {
+			t.Errorf("flag -%s is documented, but doesn't exist", n)
+		}
+	}
+}
+
+func TestManpage(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "0")
+
+	t.Run("fixtures", func(t *testing.T) {
+		tests := []struct {
+			in, want string
+		}{
+			{`
+x lists things. https://example.com
+{args=dir}
+
+Flags:
+
+    -a, -all        All; also see -b.
+    -b=..           Set it; one, two, or three (-a).
+    -c=..           Opt. Again.@@
+                    Next line.
+                    {optional arg=number}
+
+Environment:
+
+    X_A   Does x.
+    X_B
+    X_C   \set.
+`, `
+.Dd January 1, 1970
+.Dt X 1
+.Os
+.Sh NAME
+.Nm x
+.Nd lists things
+.Sh SYNOPSIS
+.Nm
+.Op Fl a
+.Op Ar dir
+.Sh DESCRIPTION
+.Nm
+lists things.
+.Pp
+.Lk https://example.com
+.Ss Flags
+.Bl -tag -width Ds
+.It Fl a , Fl all
+All; also see
+.Fl b .
+.It Fl b Ns = Ns Ar value
+Set it; one, two, or three
+.Fl ( a ) .
+.It Fl c Ns Op = Ns Ar number
+Opt.
+Again.
+.br
+Next line.
+.El
+.Sh ENVIRONMENT
+.Bl -tag -width Ds
+.It Ev X_A , Ev X_B
+Does x.
+.It Ev X_C
+\eset.
+.El
+.Sh EXIT STATUS
+.Ex -std
+`},
+
+			{`
+x does x.
+
+Examples:
+
+    Example:
+
+        x -a
+        .hidden
+
+    Text with -c=z -d.
+
+Flags:
+
+    -,   Comma.
+
+Exit status:
+
+    Exits 2 on errors.
+`, `
+.Dd January 1, 1970
+.Dt X 1
+.Os
+.Sh NAME
+.Nm x
+.Nd does x
+.Sh SYNOPSIS
+.Nm
+.Sh DESCRIPTION
+.Nm
+does x.
+.Ss Examples
+Example:
+.Bd -literal -offset indent
+x -a
+\&.hidden
+.Ed
+.Pp
+Text with -c=z -d.
+.Ss Flags
+.Bl -tag -width Ds
+.It Fl \&,
+Comma.
+.El
+.Sh EXIT STATUS
+Exits 2 on errors.
+`},
+		}
+
+		for _, tt := range tests {
+			t.Run("", func(t *testing.T) {
+				have := zli2.MustParse(tt.in).Mandoc("x", 1)
+				want := strings.TrimPrefix(tt.want, "\n")
+				if have != want {
+					t.Errorf("\nhave:\n%s\nwant:\n%s", have, want)
+				}
+			})
+		}
+	})
+
+	// Some basic checks that mandoc -T lint would report, as it's often not
+	// installed.
+	t.Run("lint", func(t *testing.T) {
+		var (
+			man      = usage.Mandoc("elles", 1)
+			stack    []string
+			sections []string
+			open     = map[string]string{"Bl": "El", "Bd": "Ed"}
+			literal  bool
+		)
+		for i, l := range strings.Split(strings.TrimSuffix(man, "\n"), "\n") {
+			switch {
+			case l == "" && !literal:
+				t.Errorf("line %d: blank line", i+1)
+			case !literal && strings.HasPrefix(l, " "):
+				t.Errorf("line %d: leading whitespace: %q", i+1, l)
+			case strings.HasSuffix(l, " "):
+				t.Errorf("line %d: trailing whitespace: %q", i+1, l)
+			}
+			if !strings.HasPrefix(l, ".") {
+				continue
+			}
+			macro, args, _ := strings.Cut(l[1:], " ")
+			switch macro {
+			default:
+				t.Errorf("line %d: unexpected macro: %q", i+1, l)
+			case "Dd", "Dt", "Os", "Nm", "Nd", "Op", "Fl", "Ar", "Ev", "Lk", "It", "Pp", "br", "Ss", "Ex":
+			case "Sh":
+				sections = append(sections, args)
+			case "Bl", "Bd":
+				stack = append(stack, open[macro])
+				literal = macro == "Bd"
+			case "El", "Ed":
+				if len(stack) == 0 || stack[len(stack)-1] != macro {
+					t.Fatalf("line %d: unexpected %q; open: %v", i+1, macro, stack)
+				}
+				stack, literal = stack[:len(stack)-1], false
+			}
+		}
+		if len(stack) > 0 {
+			t.Errorf("unclosed blocks: %v", stack)
+		}
+		want := []string{"NAME", "SYNOPSIS", "DESCRIPTION", "ENVIRONMENT", "EXIT STATUS"}
+		if !reflect.DeepEqual(sections, want) {
+			t.Errorf("sections:\nhave: %v\nwant: %v", sections, want)
+		}
+
+		if _, err := exec.LookPath("mandoc"); err != nil {
+			t.Skip("mandoc not in PATH")
+		}
+		cmd := exec.Command("mandoc", "-T", "lint", "-W", "warning")
+		cmd.Stdin = strings.NewReader(man)
+		out, err := cmd.CombinedOutput()
+		if err != nil || len(out) > 0 {
+			t.Errorf("mandoc -T lint: %v\n%s", err, out)
+		}
+	})
+}
+
+func TestHelp(t *testing.T) {
+	t.Run("format", func(t *testing.T) {
+		u := zli2.MustParse(`
+x does things, and this intro is long enough to wrap.
+
+Flags:
+
+    -a, -all         A flag with a long description that needs to be
+                     reflowed to the width.
+    -b=..            Values:@@
+                       one    The first.@@
+                       two    The second.
+    -very-long-flag  Long flag.
+
+Text:
+
+    A paragraph to
+    reflow.
+
+        Indented text is kept as-is.
+
+    Environment:
+
+    VAR   Description
+          over two lines.
+    OTHER
+`)
+		tests := []struct {
+			width int
+			want  string
+		}{
+			{40, `
+x does things, and this intro is long
+enough to wrap.
+
+Flags:
+
+    -a, -all         A flag with a long
+                     description that
+                     needs to be reflowed
+                     to the width.
+    -b=..            Values:
+                       one    The first.
+                       two    The second.
+    -very-long-flag  Long flag.
+
+Text:
+
+    A paragraph to reflow.
+
+        Indented text is kept as-is.
+
+    Environment:
+
+    VAR   Description over two lines.
+    OTHER
+`},
+			// Flag text is always at least 20 columns wide.
+			{30, `
+x does things, and this intro
+is long enough to wrap.
+
+Flags:
+
+    -a, -all         A flag with a long
+                     description that
+                     needs to be reflowed
+                     to the width.
+    -b=..            Values:
+                       one    The first.
+                       two    The second.
+    -very-long-flag  Long flag.
+
+Text:
+
+    A paragraph to reflow.
+
+        Indented text is kept as-is.
+
+    Environment:
+
+    VAR   Description over two
+          lines.
+    OTHER
+`},
+		}
+		for _, tt := range tests {
+			t.Run(strconv.Itoa(tt.width), func(t *testing.T) {
+				have := u.Format(tt.width)
+				want := strings.TrimPrefix(tt.want, "\n")
+				if have != want {
+					t.Errorf("\nhave:\n%s\nwant:\n%s", have, want)
+				}
+			})
+		}
+	})
+
+	t.Run("lookup", func(t *testing.T) {
+		tests := []struct {
+			arg, want string
+		}{
+			{"sort", "-sort=..         Sort by"},
+			{"-sort", "-sort=..         Sort by"},
+			{"B", "-B, -blocks=..   Format for file sizes; as:\n"},
+			{"block-size", "-B, -blocks=..   Format"}, // Alias.
+			{"sorting", "Sorting:\n\n    -r, -reverse"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.arg, func(t *testing.T) {
+				have := mustRun(t, "-help="+tt.arg)
+				if !strings.HasPrefix(strings.TrimSpace(have), tt.want) {
+					t.Errorf("\nhave:\n%s\nwant prefix:\n%s", have, tt.want)
+				}
+			})
+		}
+
+		if out, ok := run(t, "-help=nonexistent"); ok {
+			t.Errorf("no error for unknown flag:\n%s", out)
+		}
+	})
+}
+
+func TestFilter(t *testing.T) {
+	start(t)
+	touch(t, "empty")
+	echoTrunc(t, strings.Repeat("x", 2000), "medium")
+	echoTrunc(t, strings.Repeat("x", 3<<20), "big")
+	echoTrunc(t, "#!/bin/sh\n", "script.sh")
+	chmod(t, 0o755, "script.sh")
+	chmod(t, 0o644, "medium")
+	touchDate(t, time.Date(2000, 1, 1, 12, 0, 0, 0, time.Local), "old")
+	symlink(t, "medium", "link")
+	mkdirAll(t, "emptydir")
+	mkdirAll(t, "dir/sub")
+	echoTrunc(t, strings.Repeat("x", 2000), "dir/sub/deep")
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-type=d"}, "dir emptydir"},
+		{[]string{"-type=f,l"}, "big empty link medium old script.sh"},
+		{[]string{"-type=l"}, "link"},
+		{[]string{"-type=f", "-filesize=+1k"}, "big medium"},
+		{[]string{"-type=f", "-filesize=+1.5M"}, "big"},
+		{[]string{"-type=f", "-filesize=-1k"}, "empty old script.sh"},
+		{[]string{"-type=f", "-filesize=2000"}, "medium"},
+		{[]string{"-type=f", "-filesize=+1KiB"}, "big medium"},
+		{[]string{"-type=f", "-filesize=+1MiB"}, "big"},
+		{[]string{"-type=f", "-filesize=-2kb"}, "empty medium old script.sh"},
+		{[]string{"-type=f", "-filesize=10B"}, "script.sh"},
+		{[]string{"-type=f", "-perm=/111"}, "script.sh"},
+		{[]string{"-type=f", "-perm=-700"}, "script.sh"},
+		{[]string{"-perm=644", "medium", "script.sh"}, "medium"},
+		{[]string{"-empty"}, "empty emptydir old"},
+		{[]string{"-newer=1d"}, "big dir empty emptydir link medium script.sh"},
+		{[]string{"-newer=1999-12-31", "-type=f", "-filesize=0"}, "empty old"},
+		{[]string{"-newer=old", "-type=f", "-filesize=0"}, "empty"},
+		{[]string{"-filesize=+1k", "-type=f", "-R"}, ".:\nbig medium\n\ndir/sub:\ndeep"},
+		{[]string{"-empty", "-R", "-S"}, "empty old emptydir"}, // Directories without matches are skipped.
+		{[]string{"-newer=1w", "-type=f", "-filesize=+2k"}, "big"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			have := strings.ReplaceAll(mustRun(t, append([]string{"-1"}, tt.args...)...), "\n", " ")
+			have = strings.ReplaceAll(have, "  ", "\n\n")
+			have = strings.ReplaceAll(have, ": ", ":\n")
+			if have != tt.want {
+				t.Errorf("\nhave: %q\nwant: %q", have, tt.want)
+			}
+		})
+	}
+
+	t.Run("json", func(t *testing.T) {
+		var have []struct {
+			Dir     string `json:"dir"`
+			Entries []struct {
+				Name string `json:"name"`
+			} `json:"entries"`
+		}
+		err := json.Unmarshal([]byte(mustRun(t, "-j", "-R", "-type=f", "-filesize=2000")), &have)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(have) != 2 || have[0].Dir != "." || have[1].Dir != "./dir/sub" ||
+			len(have[0].Entries) != 1 || have[0].Entries[0].Name != "medium" ||
+			len(have[1].Entries) != 1 || have[1].Entries[0].Name != "deep" {
+			t.Errorf("%+v", have)
+		}
+	})
+
+	t.Run("-size is -s", func(t *testing.T) {
+		if have, want := mustRun(t, "-l", "-size"), mustRun(t, "-l", "-s"); have != want {
+			t.Errorf("\nhave:\n%s\nwant:\n%s", have, want)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		for _, a := range []string{"-type=x", "-type=f,", "-filesize=1X", "-filesize=1iB", "-filesize=+", "-perm=999", "-perm=u+x", "-newer=nonexistent"} {
+			if out, ok := run(t, a); ok {
+				t.Errorf("%s: no error:\n%s", a, out)
+			}
+		}
+	})
+}
+
+func TestDirsOnly(t *testing.T) {
+	start(t)
+	mkdirAll(t, "dir/sub/deeper")
+	mkdirAll(t, "other")
+	touch(t, "file")
+	touch(t, "dir/file")
+	touch(t, "dir/sub/deeper/file")
+	symlink(t, "dir", "link-dir")
+	symlink(t, "file", "link-file")
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-dirs-only"}, "dir link-dir other"},
+		{[]string{"-files-only"}, "file link-file"},
+		{[]string{"-dirs-only", "-R"}, ".:\ndir link-dir other\n\ndir:\nsub\n\ndir/sub:\ndeeper"},
+		{[]string{"-files-only", "-R"}, ".:\nfile link-file\n\ndir:\nfile\n\ndir/sub/deeper:\nfile"},
+		{[]string{"-dirs-only", "file", "dir", "link-dir"}, "link-dir\n\ndir:\nsub"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			have := strings.ReplaceAll(mustRun(t, append([]string{"-1"}, tt.args...)...), "\n", " ")
+			have = strings.ReplaceAll(have, "  ", "\n\n")
+			have = strings.ReplaceAll(have, ": ", ":\n")
+			if have != tt.want {
+				t.Errorf("\nhave: %q\nwant: %q", have, tt.want)
+			}
+		})
+	}
+
+	if out, ok := run(t, "-dirs-only", "-files-only"); ok {
+		t.Errorf("no error:\n%s", out)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	start(t)
+	now := time.Now()
+	touch(t, "b.go")
+	touch(t, "README")
+	echoTrunc(t, "#!/bin/sh\n", "run")
+	chmod(t, 0o755, "run")
+	touchDate(t, now.AddDate(0, 0, -3), "a.txt")
+	touchDate(t, time.Date(2000, 1, 1, 12, 0, 0, 0, time.Local), "old.go")
+	mkdirAll(t, "dir")
+	touch(t, "dir/x.go")
+	mkdirAll(t, "empty")
+	symlink(t, "dir", "link-dir")
+	symlink(t, "README", "link-file")
+
+	u, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-group=type"}, "Directories:\ndir empty link-dir\n\nSymlinks:\nlink-file\n\nExecutables:\nrun\n\nFiles:\nREADME a.txt b.go old.go"},
+		{[]string{"-group=ext"}, "Directories:\ndir empty link-dir\n\n.go:\nb.go old.go\n\n.txt:\na.txt\n\nNo extension:\nREADME link-file run"},
+		{[]string{"-group=day", "-files-only"}, "Today:\nREADME b.go link-file run\n\nPast week:\na.txt\n\nOlder:\nold.go"},
+		{[]string{"-group=day", "-files-only", "-r"}, "Today:\nrun link-file b.go README\n\nPast week:\na.txt\n\nOlder:\nold.go"},
+		{[]string{"-group=owner", "-n", "-files-only"}, u.Uid + ":\nREADME a.txt b.go link-file old.go run"},
+		{[]string{"-group=ext", "-R", "dir", "empty"}, "dir:\n.go:\nx.go\n\nempty:"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			have := strings.ReplaceAll(mustRun(t, append([]string{"-1"}, tt.args...)...), "\n", " ")
+			have = strings.ReplaceAll(have, "  ", "\n\n")
+			have = strings.ReplaceAll(have, ": ", ":\n")
+			if have != tt.want {
+				t.Errorf("\nhave: %q\nwant: %q", have, tt.want)
+			}
+		})
+	}
+
+	t.Run("total", func(t *testing.T) {
+		out := mustRun(t, "-l", "-total", "-group=type")
+		if n := strings.Count(out, "\nSubtotal: "); n != 4 {
+			t.Errorf("%d subtotals:\n%s", n, out)
+		}
+		if !strings.Contains(out, "\nTotal: ") {
+			t.Errorf("no total:\n%s", out)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var have []struct {
+			Group   string `json:"group"`
+			Entries []struct {
+				Name string `json:"name"`
+			} `json:"entries"`
+		}
+		err := json.Unmarshal([]byte(mustRun(t, "-j", "-group=ext", "-files-only")), &have)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var groups []string
+		for _, g := range have {
+			groups = append(groups, fmt.Sprintf("%s=%d", g.Group, len(g.Entries)))
+		}
+		if h := strings.Join(groups, " "); h != ".go=2 .txt=1 No extension=3" {
+			t.Error(h)
+		}
+	})
+
+	if out, ok := run(t, "-group=size"); ok {
+		t.Errorf("no error:\n%s", out)
+	}
+}
+
+func TestArchive(t *testing.T) {
+	start(t)
+	mtime := time.Date(2024, 5, 6, 7, 8, 0, 0, time.Local)
+	{
+		fp, err := os.Create("t.tar.gz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		gz := gzip.NewWriter(fp)
+		tw := tar.NewWriter(gz)
+		for _, h := range []tar.Header{
+			{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0o755},
+			{Name: "dir/file", Typeflag: tar.TypeReg, Mode: 0o644, Size: 5},
+			{Name: "dir/exec", Typeflag: tar.TypeReg, Mode: 0o755, Size: 2},
+			{Name: "dir/.hidden", Typeflag: tar.TypeReg, Mode: 0o644},
+			{Name: "dir/link", Typeflag: tar.TypeSymlink, Linkname: "file", Mode: 0o777},
+			{Name: "dir/dirlink", Typeflag: tar.TypeSymlink, Linkname: "../implicit", Mode: 0o777},
+			{Name: "implicit/sub/x", Typeflag: tar.TypeReg, Mode: 0o600, Size: 1},
+			{Name: "../escape", Typeflag: tar.TypeReg, Mode: 0o644},
+		} {
+			h.ModTime, h.Uname, h.Gname, h.Uid, h.Gid = mtime, "alice", "staff", 1000, 50
+			if err := tw.WriteHeader(&h); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tw.Write([]byte(strings.Repeat("x", int(h.Size)))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := errors.Join(tw.Close(), gz.Close(), fp.Close()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	{
+		fp, err := os.Create("z.zip")
+		if err != nil {
+			t.Fatal(err)
+		}
+		zw := zip.NewWriter(fp)
+		for _, f := range []struct {
+			name, data string
+			mode       fs.FileMode
+		}{
+			{"a/b/c.txt", "hello", 0o644},
+			{"a/l", "b/c.txt", fs.ModeSymlink | 0o777},
+			{"top", "", 0o644},
+		} {
+			h := &zip.FileHeader{Name: f.name, Modified: mtime}
+			h.SetMode(f.mode)
+			w, err := zw.CreateHeader(h)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write([]byte(f.data)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := errors.Join(zw.Close(), fp.Close()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"t.tar.gz"}, "dir escape implicit"},
+		{[]string{"-d", "t.tar.gz"}, "t.tar.gz"},
+		{[]string{"t.tar.gz/dir"}, "dirlink exec file link"},
+		{[]string{"-a", "t.tar.gz/dir"}, ".hidden dirlink exec file link"},
+		{[]string{"-F", "t.tar.gz/dir"}, "dirlink@ exec* file link@"},
+		{[]string{"-S", "t.tar.gz/dir"}, "file exec dirlink link"},
+		{[]string{"-dirs-only", "t.tar.gz/dir"}, "dirlink"},
+		{[]string{"t.tar.gz/dir/file", "z.zip/top"}, "t.tar.gz/dir/file z.zip/top"},
+		{[]string{"-R", "t.tar.gz/implicit"}, "t.tar.gz/implicit:\nsub\n\nt.tar.gz/implicit/sub:\nx"},
+		{[]string{"t.tar.gz/dir/dirlink"}, "t.tar.gz/dir/dirlink"},
+		{[]string{"-H", "t.tar.gz/dir/dirlink"}, "sub"},
+		{[]string{"z.zip"}, "a top"},
+		{[]string{"z.zip/a"}, "b l"},
+		{[]string{"t.tar.gz", "z.zip"}, "t.tar.gz z.zip"},
+		{[]string{"z.zip/", "t.tar.gz"}, "t.tar.gz\n\nz.zip:\na\ntop"},
+		{[]string{"-L", "-dirs-only", "z.zip/a"}, "b"},
+
+		{[]string{"-ll", "t.tar.gz/dir"}, `
+			lrwxrwxrwx alice :staff · May  6 07:08 │ dirlink → ../implicit
+			-rwxr-xr-x alice :staff 2 May  6 07:08 │ exec
+			-rw-r--r-- alice :staff 5 May  6 07:08 │ file
+			lrwxrwxrwx alice :staff · May  6 07:08 │ link → file`},
+		{[]string{"-ll", "-n", "t.tar.gz/dir/exec"}, `
+			-rwxr-xr-x 1000 :50 2 May  6 07:08 │ t.tar.gz/dir/exec`},
+		{[]string{"-ll", "-type=l", "z.zip/a"}, `
+			lrwxrwxrwx -  · May  6 07:08 │ l → b/c.txt`},
+	}
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			have := mustRun(t, append([]string{"-1"}, tt.args...)...)
+			want := strings.TrimSpace(norm(tt.want))
+			if !strings.Contains(want, "│") && !strings.Contains(want, ":") {
+				have = strings.Join(strings.Fields(have), " ")
+			}
+			if have != want {
+				t.Errorf("\nhave:\n%s\nwant:\n%s", have, want)
+			}
+		})
+	}
+
+	if out, ok := run(t, "t.tar.gz/nonexistent"); ok || !strings.Contains(out, "file does not exist") {
+		t.Errorf("ok=%t; out:\n%s", ok, out)
+	}
+	echoTrunc(t, "not a zip", "bad.zip")
+	if out := mustRun(t, "bad.zip"); out != "bad.zip" {
+		t.Error(out)
+	}
+	if out, ok := run(t, "bad.zip/dir"); ok || !strings.Contains(out, "reading archive") {
+		t.Errorf("ok=%t; out:\n%s", ok, out)
+	}
+}
+
+func TestBar(t *testing.T) {
+	start(t)
+	echoTrunc(t, strings.Repeat("x", 300), "a")
+	echoTrunc(t, strings.Repeat("x", 100), "b")
+	touch(t, "empty")
+	symlink(t, "a", "link")
+
+	have := strings.TrimSpace(mustRun(t, "-bar", "-S"))
+	want := strings.TrimSpace(norm(`
+		 75.0% ███████▌ a
+		 25.0% ██▌      b
+		  0.0%          empty
+		  0.0%          link
+	`))
+	if have != want {
+		t.Errorf("\nhave:\n%s\nwant:\n%s", have, want)
+	}
+}
+
+func TestTotal(t *testing.T) {
+	start(t)
+	echoTrunc(t, "hello\n", "a")
+	echoTrunc(t, "xx\n", "b.txt")
+	touch(t, ".hidden")
+	mkdirAll(t, "dir")
+	echoTrunc(t, "0123456789\n", "dir/c")
+	symlink(t, "a", "link")
+
+	// Allocated size depends on the filesystem.
+	alloc := regexp.MustCompile(`\(\S+ allocated\)`)
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-R"}, `
+			.:
+			a
+			b.txt
+			dir
+			link
+			Total: 2 files, 1 directory, 1 symlink; 9 (… allocated); 1 hidden
+
+			dir:
+			c
+			Total: 1 file; 11 (… allocated)
+
+			Grand total: 3 files, 1 directory, 1 symlink; 20 (… allocated); 1 hidden
+		`},
+		{[]string{"-R", "-filesize=-10"}, `
+			a
+			b.txt
+			link
+			Total: 2 files, 1 symlink; 9 (… allocated); 1 hidden, 1 filtered
+		`},
+		{[]string{"-a", "-type=f"}, `
+			.hidden
+			a
+			b.txt
+			Total: 3 files; 9 (… allocated); 2 filtered
+		`},
+	}
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			out := alloc.ReplaceAllString(mustRun(t, append([]string{"-total"}, tt.args...)...), "(… allocated)")
+			want := strings.TrimSpace(norm(tt.want))
+			if out != want {
+				t.Errorf("\nhave:\n%s\nwant:\n%s", out, want)
+			}
+		})
+	}
+
+	t.Run("json", func(t *testing.T) {
+		var have []struct {
+			Dir   string `json:"dir"`
+			Total *struct {
+				Files, Dirs, Symlinks, Hidden int
+				Size                          int64
+			} `json:"total"`
+		}
+		err := json.Unmarshal([]byte(mustRun(t, "-j", "-total", "-a", "dir", ".")), &have)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sums []string
+		for _, h := range have {
+			sums = append(sums, fmt.Sprintf("%q f=%d d=%d l=%d sz=%d hidden=%d",
+				h.Dir, h.Total.Files, h.Total.Dirs, h.Total.Symlinks, h.Total.Size, h.Total.Hidden))
+		}
+		want := `"." f=3 d=1 l=1 sz=9 hidden=0` + "\n" +
+			`"./dir" f=1 d=0 l=0 sz=11 hidden=0` + "\n" +
+			`"" f=4 d=1 l=1 sz=20 hidden=0`
+		if h := strings.Join(sums, "\n"); h != want {
+			t.Errorf("\nhave:\n%s\nwant:\n%s", h, want)
+		}
+	})
+}
+
+func TestFrom(t *testing.T) {
+	start(t)
+	mkdirAll(t, "dir")
+	touch(t, "dir/file")
+	touch(t, "new\nline")
+	echoTrunc(t, "dir/file\ndir\n", "list")
+	echoTrunc(t, "dir/file\x00new\nline\x00", "list0")
+
+	tests := []struct {
+		args []string
+		want string
+		ok   bool
+	}{
+		{[]string{"-F", "-from=list"}, "dir/\ndir/file", true},
+		{[]string{"-Q", "-files0-from=list0"}, "dir/file\n\"new\\nline\"", true},
+		{[]string{"-from=nope"}, "elles: open nope: no such file or directory", false},
+		{[]string{"-from=list", "dir"}, "elles: can't use -from or -files0-from with paths", false},
+		{[]string{"-from=list", "-files0-from=list0"}, "elles: can't use -from and -files0-from together", false},
+	}
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			have, ok := run(t, tt.args...)
+			if ok != tt.ok {
+				t.Errorf("ok=%t", ok)
+			}
+			if have != tt.want {
+				t.Errorf("\nhave:\n%s\nwant:\n%s", have, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	start(t)
+	mkdirAll(t, "a")
+	mkdirAll(t, "b")
+	touch(t, "a/same")
+	touch(t, "b/same")
+	touch(t, "a/left")
+	touch(t, "b/right")
+	echoTrunc(t, "x", "a/diff")
+	echoTrunc(t, "xx", "b/diff")
+	mtime := time.Date(2024, 3, 15, 14, 0, 0, 0, time.Local)
+	for _, f := range []string{"a/diff", "b/diff"} {
+		if err := os.Chtimes(f, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		args []string
+		want string
+		ok   bool
+	}{
+		{[]string{"-compare", "a", "b"}, "| diff  size 1 → 2\n< left\n> right\n  same", true},
+		{[]string{"-compare", "a"}, "elles: -compare needs two directories", false},
+		{[]string{"-compare", "a", "b/same"}, `elles: -compare: not a directory: "b/same"`, false},
+		{[]string{"-compare", "-json", "a", "b"}, "elles: can't use -json with -compare", false},
+	}
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			have, ok := run(t, tt.args...)
+			if ok != tt.ok {
+				t.Errorf("ok=%t", ok)
+			}
+			if have != tt.want {
+				t.Errorf("\nhave:\n%s\nwant:\n%s", have, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	start(t)
+	mkdirAll(t, "opt", "sub")
+	touch(t, "opt", "file")
+	touch(t, "opt", "removed")
+	touch(t, "opt", "sub", "x")
+	mustRun(t, "-R", "-snapshot=snap", "opt")
+
+	echoTrunc(t, "new", "opt", "file")
+	rm(t, "opt", "removed")
+	touch(t, "opt", "added")
+	chmod(t, 0o700, "opt", "sub", "x")
+
+	tests := []struct {
+		args []string
+		want string
+		ok   bool
+	}{
+		{[]string{"-changes=snap"}, "opt:\n> added\n| file  size 0 → 3\n< removed\n\nopt/sub:\n| x  mode -rw-r--r-- → -rwx------", true},
+		{[]string{"-changes=snap", "-n"}, "opt:\n> added\n| file  size 0 → 3\n< removed\n\nopt/sub:\n| x  mode -rw-r--r-- → -rwx------", true},
+		{[]string{"-changes=snap", "opt"}, "elles: can't use -changes with paths; the directories in the snapshot are compared", false},
+		{[]string{"-changes=nope"}, "elles: open nope: no such file or directory", false},
+		{[]string{"-snapshot=snap2", "opt/file"}, `elles: -snapshot: not a directory: "file"`, false},
+	}
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			have, ok := run(t, tt.args...)
+			if ok != tt.ok {
+				t.Errorf("ok=%t", ok)
+			}
+			if have != tt.want {
+				t.Errorf("\nhave:\n%s\nwant:\n%s", have, tt.want)
+			}
+		})
+	}
+}
+
+func TestDupes(t *testing.T) {
+	start(t)
+	mkdirAll(t, "sub")
+	echoTrunc(t, "hello\n", "a")
+	echoTrunc(t, "hello\n", "sub", "b")
+	echoTrunc(t, "world\n", "c")
+	touch(t, "empty1")
+	touch(t, "empty2")
+
+	tests := []struct {
+		args []string
+		want string
+		ok   bool
+	}{
+		{[]string{"-hash=xxhash", "a", "c", "sub"}, "e4c191d091bd8853 a\n71d2dfb69f566eaa c\n\nsub:\ne4c191d091bd8853 b", true},
+		{[]string{"-dupes"}, "", true},
+		{[]string{"-dupes", "-R"}, "2 × 6 (sha256 5891b5b522d5):\na\nsub/b", true},
+		{[]string{"-hash=md5"}, `elles: invalid value for -hash: "md5"`, false},
+	}
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			have, ok := run(t, tt.args...)
+			if ok != tt.ok {
+				t.Errorf("ok=%t", ok)
+			}
+			if have != tt.want {
+				t.Errorf("\nhave:\n%s\nwant:\n%s", have, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+//go:build linux
+
+package os2
+
+import (
+	"io/fs"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// HasCapability reports if the file has any capabilities set (see
+// capabilities(7)).
+func HasCapability(absdir string, fi fs.FileInfo) bool {
+	sz, err := unix.Lgetxattr(filepath.Join(absdir, fi.Name()), "security.capability", nil)
+	return err == nil && sz > 0
+}
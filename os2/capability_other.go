@@ -0,0 +1,7 @@
+//go:build !linux
+
+package os2
+
+import "io/fs"
+
+func HasCapability(absdir string, fi fs.FileInfo) bool { return false }
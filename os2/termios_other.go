@@ -0,0 +1,7 @@
+//go:build aix || linux || solaris
+
+package os2
+
+import "golang.org/x/sys/unix"
+
+const ioctlGetTermios, ioctlSetTermios = unix.TCGETS, unix.TCSETS
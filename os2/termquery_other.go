@@ -0,0 +1,12 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+
+package os2
+
+import (
+	"errors"
+	"time"
+)
+
+func QueryTerminal(query string, timeout time.Duration, done func([]byte) bool) ([]byte, error) {
+	return nil, errors.New("QueryTerminal: not supported on this platform")
+}
@@ -0,0 +1,67 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+
+package os2
+
+import (
+	"errors"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// QueryTerminal writes query to the controlling terminal and reads the reply
+// until done reports it's complete or until the timeout expires.
+//
+// This does nothing if we're not the foreground process, as changing the
+// terminal settings would stop the process with SIGTTOU.
+func QueryTerminal(query string, timeout time.Duration, done func([]byte) bool) ([]byte, error) {
+	fd, err := unix.Open("/dev/tty", unix.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer unix.Close(fd)
+
+	fg, err := unix.IoctlGetInt(fd, unix.TIOCGPGRP)
+	if err != nil {
+		return nil, err
+	}
+	if pg, err := unix.Getpgid(0); err != nil || pg != fg {
+		return nil, errors.New("not the foreground process")
+	}
+
+	old, err := unix.IoctlGetTermios(fd, ioctlGetTermios)
+	if err != nil {
+		return nil, err
+	}
+	raw := *old
+	raw.Lflag &^= unix.ECHO | unix.ICANON
+	raw.Cc[unix.VMIN], raw.Cc[unix.VTIME] = 0, uint8(max(1, timeout/(100*time.Millisecond)))
+	if err := unix.IoctlSetTermios(fd, ioctlSetTermios, &raw); err != nil {
+		return nil, err
+	}
+	defer unix.IoctlSetTermios(fd, ioctlSetTermios, old)
+
+	if _, err := unix.Write(fd, []byte(query)); err != nil {
+		return nil, err
+	}
+
+	var (
+		reply    = make([]byte, 0, 64)
+		buf      = make([]byte, 64)
+		deadline = time.Now().Add(timeout)
+	)
+	for !done(reply) && time.Now().Before(deadline) {
+		n, err := unix.Read(fd, buf)
+		if err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+			return reply, err
+		}
+		if n == 0 { // VTIME expired.
+			break
+		}
+		reply = append(reply, buf[:n]...)
+	}
+	return reply, nil
+}
@@ -0,0 +1,16 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+
+package os2
+
+import (
+	"errors"
+	"os"
+)
+
+func OpenTerminal() (*os.File, func(), error) {
+	return nil, nil, errors.New("OpenTerminal: not supported on this platform")
+}
+
+func TerminalSize(fp *os.File) (int, int, error) {
+	return 0, 0, errors.New("TerminalSize: not supported on this platform")
+}
@@ -0,0 +1,51 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+
+package os2
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// OpenTerminal opens the controlling terminal in raw mode, so that it can be
+// used interactively even if stdout is redirected. The returned function
+// restores the terminal settings and closes it.
+func OpenTerminal() (*os.File, func(), error) {
+	fp, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	fd := int(fp.Fd())
+
+	old, err := unix.IoctlGetTermios(fd, ioctlGetTermios)
+	if err != nil {
+		fp.Close()
+		return nil, nil, err
+	}
+	// Same as cfmakeraw(3).
+	raw := *old
+	raw.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	raw.Oflag &^= unix.OPOST
+	raw.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	raw.Cflag &^= unix.CSIZE | unix.PARENB
+	raw.Cflag |= unix.CS8
+	raw.Cc[unix.VMIN], raw.Cc[unix.VTIME] = 1, 0
+	if err := unix.IoctlSetTermios(fd, ioctlSetTermios, &raw); err != nil {
+		fp.Close()
+		return nil, nil, err
+	}
+	return fp, func() {
+		unix.IoctlSetTermios(fd, ioctlSetTermios, old)
+		fp.Close()
+	}, nil
+}
+
+// TerminalSize gets the width and height of the terminal fp.
+func TerminalSize(fp *os.File) (int, int, error) {
+	ws, err := unix.IoctlGetWinsize(int(fp.Fd()), unix.TIOCGWINSZ)
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(ws.Col), int(ws.Row), nil
+}
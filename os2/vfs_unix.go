@@ -16,8 +16,8 @@ import (
 	"zgo.at/zli"
 )
 
-// TODO: unused at the moment; ls -l prints this, but I don't think I've ever
-// used it in 25 years. Should maybe add option though.
+// ls -l prints this, but I don't think I've ever used it in 25 years. Only used
+// for the "mh" colour at the moment.
 func Numlinks(absdir string, fi fs.FileInfo) uint64 {
 	if fi.Sys() == nil {
 		return 0
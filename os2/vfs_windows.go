@@ -11,7 +11,7 @@ import (
 	"zgo.at/zli"
 )
 
-func Numlinks(absdir string, fi fs.FileInfo) int {
+func Numlinks(absdir string, fi fs.FileInfo) uint64 {
 	fp, err := os.Open(filepath.Join(absdir, fi.Name()))
 	if err != nil {
 		return 1
@@ -24,7 +24,7 @@ func Numlinks(absdir string, fi fs.FileInfo) int {
 		zli.Errorf(err)
 		return 1
 	}
-	return int(info.NumberOfLinks)
+	return uint64(info.NumberOfLinks)
 }
 
 func OwnerID(absdir string, fi fs.FileInfo) (string, string) {
@@ -0,0 +1,89 @@
+package os2
+
+import (
+	"os"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Watcher reports changes to directories.
+type Watcher struct {
+	// C receives a value when a watched directory or one of its entries
+	// changes. Changes are coalesced if C isn't read.
+	C <-chan struct{}
+
+	fp      *os.File
+	c       chan struct{}
+	mu      sync.Mutex
+	watched map[string]int // Watch descriptors by path.
+}
+
+// NewWatcher creates a new watcher, using inotify. Directories are added with
+// Add.
+func NewWatcher() (*Watcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	c := make(chan struct{}, 1)
+	w := &Watcher{C: c, c: c, fp: os.NewFile(uintptr(fd), "inotify"), watched: make(map[string]int)}
+	go w.read()
+	return w, nil
+}
+
+// Add a directory to watch; adding the same directory more than once is a
+// no-op.
+func (w *Watcher) Add(dir string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.watched[dir]; ok {
+		return nil
+	}
+	wd, err := unix.InotifyAddWatch(int(w.fp.Fd()), dir, unix.IN_CREATE|unix.IN_DELETE|
+		unix.IN_MODIFY|unix.IN_ATTRIB|unix.IN_CLOSE_WRITE|unix.IN_MOVED_FROM|unix.IN_MOVED_TO|
+		unix.IN_DELETE_SELF|unix.IN_MOVE_SELF)
+	if err != nil {
+		return &os.PathError{Op: "inotify_add_watch", Path: dir, Err: err}
+	}
+	w.watched[dir] = wd
+	return nil
+}
+
+func (w *Watcher) forget(wd int32) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for dir, d := range w.watched {
+		if int32(d) == wd {
+			delete(w.watched, dir)
+		}
+	}
+}
+
+// Close the watcher.
+func (w *Watcher) Close() error { return w.fp.Close() }
+
+func (w *Watcher) read() {
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := w.fp.Read(buf)
+		if err != nil {
+			return
+		}
+		// Don't need to know what changed, as everything is listed again, but
+		// need to forget directories that are gone so they can be added again
+		// if they're re-created.
+		for off := 0; off+unix.SizeofInotifyEvent <= n; {
+			ev := (*unix.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			if ev.Mask&unix.IN_IGNORED != 0 {
+				w.forget(ev.Wd)
+			}
+			off += unix.SizeofInotifyEvent + int(ev.Len)
+		}
+		select {
+		case w.c <- struct{}{}:
+		default:
+		}
+	}
+}
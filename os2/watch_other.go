@@ -0,0 +1,50 @@
+//go:build !linux
+
+package os2
+
+import (
+	"sync"
+	"time"
+)
+
+// Watcher reports changes to directories.
+type Watcher struct {
+	// C receives a value when a watched directory or one of its entries
+	// changes. Changes are coalesced if C isn't read.
+	C <-chan struct{}
+
+	done chan struct{}
+	once sync.Once
+}
+
+// NewWatcher creates a new watcher. This platform has no support for
+// notifications, so this just sends on C every second.
+func NewWatcher() (*Watcher, error) {
+	c := make(chan struct{}, 1)
+	w := &Watcher{C: c, done: make(chan struct{})}
+	go func() {
+		t := time.NewTicker(time.Second)
+		defer t.Stop()
+		for {
+			select {
+			case <-w.done:
+				return
+			case <-t.C:
+				select {
+				case c <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return w, nil
+}
+
+// Add a directory to watch.
+func (w *Watcher) Add(dir string) error { return nil }
+
+// Close the watcher.
+func (w *Watcher) Close() error {
+	w.once.Do(func() { close(w.done) })
+	return nil
+}
@@ -13,56 +13,168 @@ var zsh string
 
 var usage = zli2.MustParse(`
 elles prints directory contents. https://github.com/arp242/elles
+{args=file...}
 
 What to list:
 
+    An archive (zip, jar, tar, tar.gz, or tar.bz2) is listed as a directory if
+    it's the only path on the commandline, with the modes, times, owners, and
+    symlink targets stored in the archive. Use a path such as file.zip/dir to
+    list a directory inside the archive, file.zip/ to list an archive along
+    with other paths, or -d to list the archive file itself.
+
     -a, -all         Show entries starting with . (except . and ..) or the
                      "hidden" attribute (on Windows)
     -d, -directory   List directories themselves, rather than their contents.
     -H               Follow symlinks of commandline arguments.
     -L               Follow all symlinks.
     -R, -recursive   List subdirectories recursively.
+    -from=file       Read the paths to list from file, one per line, or from
+                     stdin with -from=-. The paths are listed as files, as with
+                     -d, and can't be combined with paths on the commandline.
+    -files0-from=..  As -from, but the paths are separated by NUL bytes, as
+                     with find -print0 or git ls-files -z.
+                     {conflicts=-from}
     -i, -inode       Print inode numbers.
     -g, -groupname   Always display the group by name in -ll; by default it's
                      only shown if the group group name is different from the
                      username.
 
+Filtering:
+
+    Only list entries matching all of these filters. With -R it still
+    recurses into all subdirectories, but doesn't show directories without
+    any matches.
+
+    -type=..         Only list entries of these types, as a comma-separated
+                     list: f (regular file), d (directory), l (symlink), p
+                     (FIFO), s (socket), c (character device), b (block
+                     device), or D (door).
+    -filesize=..     Only list entries larger than n if prefixed with "+",
+                     smaller than n if prefixed with "-", or exactly n
+                     otherwise. n is in bytes, or use K, M, G, or T as a suffix
+                     (powers of 1024), e.g. -filesize=+100M.
+    -newer=..        Only list entries modified after a duration ago (e.g. 2d,
+                     3w, or 90m), a date as 2006-01-02 or "2006-01-02 15:04",
+                     or the modification time of a file. Uses the creation or
+                     access time with -c or -u.
+    -perm=..         Only list entries with these permission bits (in octal):
+                     exactly (-perm=644), with all bits set (-perm=-644), or
+                     with any bit set (-perm=/111).
+    -empty           Only list empty files and directories.
+    -dirs-only       Only list directories, including symlinks to directories.
+                     {conflicts=-files-only}
+    -files-only      Only list entries that aren't directories or symlinks to
+                     directories.
+
 How to list it:
 
     -j, -json        Print as JSON.
+    -browse          Browse interactively: navigate with the arrow keys or
+                     hjkl, type / to filter, s to change the sort order, r to
+                     reverse, a to show hidden files, L to show more columns,
+                     and ? for help. Prints the directory when quitting with q,
+                     or the file when pressing enter on it, and exits with 1 if
+                     cancelled with Q or ^C. For example: cd "$(elles -browse)"
+                     Filters such as -type and -filesize apply to files;
+                     directories are always shown so they can be entered.
+    -compare         Compare two directories: list the entries of both, marked
+                     with < if only in the first directory, > if only in the
+                     second, or | if they differ in type, permissions, size,
+                     modification time (files), owner, or target (symlinks),
+                     followed by the differences. The columns are from the
+                     second directory. Use -R to compare subdirectories as well.
+    -snapshot=file   Write a snapshot of the listed directories to file, for
+                     use with -changes later; use -R to include subdirectories.
+                     The snapshot is the same as the -json output.
+                     {conflicts=-changes}
+    -changes=file    List the entries that changed since the -snapshot in file
+                     was written, marked as with -compare: < if removed, > if
+                     added, or | if changed. All directories in the snapshot
+                     are compared; use the same filters as for -snapshot.
+    -watch           Keep showing the listing, and list again when something
+                     changes. Added and modified entries are highlighted for a
+                     few seconds. Uses inotify on Linux, and lists again every
+                     second on other platforms. Stop with ^C.
     -l               Long listing with size and mtime; use twice to show more.
     -1               List one path per line; default when stdout is not a tty
     -C               List paths in columns; default when stdout is a tty.
                      Single column (-1) is automatically set for -l, but can be
                      overridden with this.
     -group-dirs      Group directories first. Alias: -group-directories-first.
+                     {alias=-group-dir,-group-directories,-group-directories-first}
+    -group=..        Split the listing in groups, each with a header: type
+                     (directories, executables, files, etc.), ext (file
+                     extension), day (today, yesterday, past week, etc.; uses
+                     the creation or access time with -c or -u), or owner.
+                     Directories in -R are grouped individually. Adds
+                     subtotals with -total.
+                     {values=type,ext,day,owner}
     -n               Display user an group ID as number, rather than username.
     -w, -width=..    Maximum column width; longer columns will be trimmed. Set
                      to 0 to disable.
+                     {arg=number}
     -m, -min=n       Minimum number of columns to use, trimming columns that
                      are too long. This does not set the exact number of
                      columns and sometimes results in more columns.
+                     {arg=number}
     -o, -octal       File permissions as octal instead of "rwx…".
-    -total           Print total size in -l output.
+    -total           Print a summary after every directory: the number of
+                     files, directories, symlinks, and other entries, the
+                     apparent size of files (and directories with -D), the
+                     allocated size, and the number of hidden and filtered
+                     entries that weren't listed. Adds a grand total if there
+                     is more than one directory, and a "total" object with -j.
 
 How to format paths:
 
     -color=..        When to apply colours; always, never, or auto (default).
+                     {optional alias=-colour}
     -hyperlink=..    Add link escape codes; always, never (default), or auto.
+                     {optional alias=-hyper}
     -p               Print / after each directory.
     -F               Print /@*=|> after directory, symlink, executable file,
                      socket, FIFO, or door.
     -,               (Comma) Print file sizes with thousands separators.
-    -B, -blocks=..   Format for file sizes; as:
-                       "1" or "B" for bytes
-                       "s" for allocated filesystem blocks
-                       "S" for blocks (differs from "s" for sparse files)
+    -B, -blocks=..   Format for file sizes; as:@@
+                       "1" or "B" for bytes@@
+                       "s" for allocated filesystem blocks@@
+                       "S" for blocks (differs from "s" for sparse files)@@
                        unit as K, M, or G (powers of 1024)
+                     {alias=-block,-block-size values=1,B,s,S,K,M,G}
     -D, -dirsize     Print recursive directory size in -l. May be slow.
-    -c               Use creation ("birth") time for display in -l, and sorting
-                     with -t. Does nothing if neither -l nor -t is given.
-    -u               Use last access time for display in -l, and sorting
-                     with -t. Does nothing if neither -l nor -t is given.
+    -bar             Show the share of the directory total for every entry as a
+                     percentage and bar, to find out what's using disk space.
+                     Sizes are apparent sizes; symlinks are always 0%. Implies
+                     -D; sort with -S to get the largest first.
+    -hash=..         Show a hash of the contents of files: xxhash (fast) or
+                     sha256. Also adds an xxhash or sha256 field to -json.
+                     {values=xxhash,sha256}
+    -sniff           Show the content type of files, from the first few bytes
+                     rather than the extension: images, archives, executables
+                     (ELF, PE, Mach-O), scripts (by the #! line), and the
+                     encoding of text files. Also adds content_type to -json,
+                     and colours files with an unknown or no suffix by their
+                     content type; see -help=colours.
+    -exe             Show what executables are: the format (ELF, PE, Mach-O)
+                     and architecture, whether they're linked statically or
+                     dynamically, and the Go version for Go binaries. Scripts
+                     show the #! line. Also adds exe to -json.
+    -text            Show the number of lines, the line endings (LF, CRLF,
+                     CR, or mixed), and the encoding of files: ascii, utf-8,
+                     utf-8-bom, utf-16le or utf-16be (with a BOM), non-utf-8,
+                     or binary (a NUL byte in the first 8000 bytes). Files are
+                     read in parallel. Also adds text to -json.
+    -dupes           List files with identical contents, grouped by contents
+                     with the largest first. Use -R to include subdirectories.
+                     Files are compared by sha256, or the -hash algorithm if
+                     given. Empty files aren't listed.
+    -c               Use creation ("birth") time for display in -l, sorting
+                     with -t, and -newer. Does nothing if neither -l, -t, nor
+                     -newer is given.
+    -u               Use last access time for display in -l, sorting with -t,
+                     and -newer. Does nothing if neither -l, -t, nor -newer is
+                     given.
     -T               Always display full time info, as "2006-01-02 15:00:00".
                      When given twice it will also display nanoseconds and
                      timezone.
@@ -91,10 +203,17 @@ Sorting:
 
 Other:
 
-    -help            Print this help and edit.
+    -help=..         Print this help and exit. Use -help=name to show only the
+                     help for a flag or section, e.g. -help=sort or
+                     -help=colours.
+                     {optional}
     -version         Print version and exit.
-    -completion=..   Print shell completion file. Supported shells: "zsh".
-    -manpage         Print manpage version of this help.
+    -completion=..   Print shell completion file and exit; bash, fish,
+                     powershell, or zsh.
+    -manpage         Print manpage version of this help and exit.
+    -print-colors    Print the colour configuration in use, with samples,
+                     and exit. Also accepted as -print-colours.
+                     {alias=-print-colours}
 
 Environment:
 
@@ -103,34 +222,93 @@ Environment:
     ELLES_COLORS     Colour configuration; see "Colours" section.
     LS_COLORS
     LSCOLORS
+    ELLES_DIRCOLORS  dircolors database to read if none of the above are set.
+    COLORFGBG        Used to detect the terminal background colour.
+    COLORTERM        Use 24-bit colours if "truecolor" or "24bit".
 
 Colours:
 
-    The defaults colours are identical to FreeBSD ls on all BSD systems and
-    macOS, and GNU ls on everything else. Use LS_COLORS (GNU ls format) or
+    The default colours are identical to GNU ls on dark backgrounds and
+    FreeBSD ls on light backgrounds. If the background can't be detected it
+    uses FreeBSD's on all BSD systems and macOS, and GNU's on everything else.
+    Use LS_COLORS (GNU ls format) or
     LSCOLORS (BSD ls format) to configure the colours. It will try them in that
     order and use the first one that's found (on all platforms).
 
+    If neither is set it reads a dircolors(1) database from ELLES_DIRCOLORS,
+    ~/.dircolors, ~/.dir_colors, or ~/.config/dircolors, whichever is found
+    first. TERM and COLORTERM sections are matched against the current
+    terminal, just like "eval $(dircolors)" would.
+
     ELLES_COLORS can be used for elles-specific colourings. It won't look at
     LS_COLORS or LSCOLORS if it's set. The syntax of this follows GNU's
     LS_COLORS, with additional options:
 
-        default  Explicitly set which defaults to use, "bsd" or "gnu". The BSD
-                 defaults tend to work better on light backgrounds, and the GNU
-                 ones on dark backgrounds.
+        default  Theme to use for the defaults: "gnu", "bsd", "dark", or
+                 "light"; use -print-colors to see them. Use two themes
+                 separated by a comma to pick one based on the terminal
+                 background, e.g. "dark,light". The default is "auto", which
+                 is the same as "gnu,bsd".
+
+                 The background is detected from COLORFGBG or by asking the
+                 terminal. It only asks the terminal if "default" is set, or if
+                 none of ELLES_COLORS, LS_COLORS, LSCOLORS, or a dircolors
+                 database are used. If that doesn't work the first theme is
+                 used, or the second one on BSD systems and macOS.
 
         hidden   Additional highlights for hidden entries (e.g. paths starting
                  with a "."). These are applied after the regular colour codes.
 
+        left     Markers for -compare and -changes: "<" for entries only in
+        right    the left directory, ">" for entries only in the right
+        diff     directory, and "|" for entries that differ.
+
+        name     Any other key is a filename: either an exact name such as
+                 "Makefile", or a glob pattern such as "README*" or
+                 "[Mm]akefile". Use "[d]i" for files that would clash with a
+                 key.
+
+        type&..  Combine a filename or pattern with one or more types with
+                 "&" to only match files of that type, for example "ex&*.sh"
+                 for executable shell scripts or "di&hidden" for hidden
+                 directories. Types are the keys listed above (fi, di, ln, ex,
+                 su, mh, etc.) and "hidden".
+
+        type/..  A name with a "/" matches the content type with -sniff
+                 rather than the filename, for example "image/*" or
+                 "text/x-script.*" (shown with -sniff). Can be combined with
+                 types, e.g. "ex&application/x-elf".
+
+    Colours are picked in this order:
+
+        1. Rules with a type, such as "ex&*.sh".
+        2. The file type colours (di, ln, ex, su, etc.)
+        3. Exact filenames, such as "Makefile" (regular files only).
+        4. Glob patterns, such as "README*" (regular files only).
+        5. Suffixes, such as "*.tar.gz" or "*_test.go" (regular files only).
+        6. With -sniff, the suffix for the content type (e.g. "*.png" for
+           image/png), so files without a suffix still get a colour.
+
+    If several rules of the same kind match then the last one wins.
+
     For example, to use the BSD defaults with a grey background for hidden
     files and highlighting *.exe as red:
 
         ELLES_COLORS='default=bsd:hidden=48;5;255:*.exe=31'
 
+    Or to make test files and generated files stand out in Go trees:
+
+        ELLES_COLORS='*.go=34:*_test.go=36:*_string.go=2:go.mod=33:ex&*.sh=35'
+
+    Colours can also be given as "#rrggbb" for the foreground or "bg#rrggbb"
+    for the background. These are sent as 24-bit colours if COLORTERM is
+    "truecolor" or "24bit", or as the nearest 256-colour otherwise.
+
 Compatibility flags:
 
     -G                Alias for -color=auto.
     -A, -almost-all   Alias for -a (both omit . and ..).
     -h                No-op, as elles uses human-readable sizes by default.
     -s                Alias for -blocks=s
+                      {alias=-size}
 `)
@@ -0,0 +1,314 @@
+package zli2
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var reSentence = regexp.MustCompile(`\. [A-Z]`)
+
+// Get the first sentence of the text, for shell completions that show a short
+// description.
+func short(text string) string {
+	text = strings.Join(strings.Fields(strings.ReplaceAll(text, "@@", "")), " ")
+	if m := reSentence.FindStringIndex(text); m != nil {
+		text = text[:m[0]]
+	}
+	if i := strings.Index(text, "; "); i > -1 {
+		text = text[:i]
+	}
+	return strings.TrimSuffix(text, ".")
+}
+
+func (u Usage) allFlags() []Flag {
+	var all []Flag
+	for _, s := range u.Sections {
+		all = append(all, s.Flags...)
+	}
+	return all
+}
+
+// CompleteBash generates a completion script for bash.
+func (u Usage) CompleteBash(name, site string) string {
+	var (
+		fn                       = "_" + strings.NewReplacer("-", "_", ".", "_").Replace(name)
+		all                      = u.allFlags()
+		names, exit, args, first []string
+		values, excl             = new(strings.Builder), new(strings.Builder)
+	)
+	for _, f := range all {
+		bare := f.Bare()
+		withAlias := append(slices.Clone(bare), f.Aliases...)
+		for _, n := range bare {
+			if f.Arg != "" {
+				n += "="
+			}
+			if f.Exit {
+				first = append(first, "-"+n)
+			} else {
+				names = append(names, "-"+n)
+			}
+		}
+		if f.Exit {
+			exit = append(exit, withAlias...)
+		}
+		if f.Arg != "" {
+			args = append(args, withAlias...)
+			switch {
+			case len(f.Values) > 0:
+				fmt.Fprintf(values, "\t\t\t%s) COMPREPLY=($(compgen -W '%s' -- \"$cur\")) ;;\n",
+					bashPattern(withAlias), strings.Join(f.Values, " "))
+			case f.Kind == "file":
+				fmt.Fprintf(values, "\t\t\t%s) COMPREPLY=($(compgen -f -- \"$cur\")) ;;\n", bashPattern(withAlias))
+			case f.Kind == "dir":
+				fmt.Fprintf(values, "\t\t\t%s) COMPREPLY=($(compgen -d -- \"$cur\")) ;;\n", bashPattern(withAlias))
+			default:
+				fmt.Fprintf(values, "\t\t\t%s) compopt +o default ;;\n", bashPattern(withAlias))
+			}
+		}
+		switch {
+		case f.Repeat:
+			fmt.Fprintf(excl, "\t\t\t%s) ;;\n", bashPattern(withAlias))
+		case len(f.Conflicts) > 0 || len(withAlias) > 1:
+			fmt.Fprintf(excl, "\t\t\t%s) exclude+='%s ' ;;\n",
+				bashPattern(withAlias), strings.Join(append(withAlias, f.Conflicts...), " "))
+		}
+	}
+
+	// What to complete for positional arguments; -o default completes files.
+	positional := "# Use -o default."
+	switch strings.TrimSuffix(u.Args, "...") {
+	case "file":
+	case "dir":
+		positional = `COMPREPLY=($(compgen -d -- "$cur"))`
+	default:
+		positional = "compopt +o default"
+	}
+
+	b := new(strings.Builder)
+	fmt.Fprintf(b, `# Completion for "%[1]s"; %[2]s
+#
+# Save as "%[1]s" in ~/.local/share/bash-completion/completions, or source it
+# from ~/.bashrc.
+
+%[3]s() {
+	local cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]} flag= w
+	local words=("${COMP_WORDS[@]:1:COMP_CWORD-1}")
+
+	# "=" is in COMP_WORDBREAKS by default, so -flag=value is split in three.
+	if [[ $cur == = ]]; then
+		flag=$prev cur=
+	elif [[ $prev == = && $COMP_CWORD -gt 2 ]]; then
+		flag=${COMP_WORDS[COMP_CWORD-2]}
+	elif [[ $cur == -*=* ]]; then
+		flag=${cur%%%%=*} cur=${cur#*=}
+	elif [[ $prev == -* ]]; then
+		w=${prev#-} w=${w#-}
+		case $w in
+			%[4]s) flag=$prev ;;
+		esac
+	fi
+	if [[ -n $flag ]]; then
+		flag=${flag#-} flag=${flag#-}
+		case $flag in
+%[5]s		esac
+		return
+	fi
+
+	# Flags that exit; nothing else makes sense.
+	for w in "${words[@]}"; do
+		w=${w#-} w=${w#-}
+		case $w in
+			%[6]s) return ;;
+		esac
+	done
+
+	if [[ $cur != -* ]]; then
+		%[10]s
+		return
+	fi
+	local exclude=' ' flags=() f
+	for w in "${words[@]}"; do
+		[[ $w == -* ]] || continue
+		w=${w#-} w=${w#-} w=${w%%%%=*}
+		case $w in
+%[7]s			*) exclude+="$w " ;;
+		esac
+	done
+	for f in %[8]s; do
+		w=${f#-} w=${w%%=}
+		[[ $exclude == *" $w "* ]] || flags+=("$f")
+	done
+	[[ $COMP_CWORD -eq 1 ]] && flags+=(%[9]s)
+	local pre=
+	[[ $cur == --* ]] && pre=-  # Also accept --flag.
+	COMPREPLY=($(compgen -P "$pre" -W "${flags[*]}" -- "${cur#$pre}"))
+	[[ ${#COMPREPLY[@]} -eq 1 && ${COMPREPLY[0]} == *= ]] && compopt -o nospace
+}
+
+complete -o default -F %[3]s %[1]s
+`, name, site, fn, bashPattern(args), values, bashPattern(exit), excl,
+		strings.Join(names, " "), strings.Join(first, " "), positional)
+	return b.String()
+}
+
+// Get a case pattern for the flags.
+func bashPattern(names []string) string {
+	p := make([]string, 0, len(names))
+	for _, n := range names {
+		if strings.ContainsAny(n, ",|*?[]()") {
+			n = `'` + n + `'`
+		}
+		p = append(p, n)
+	}
+	if len(p) == 0 {
+		return "''"
+	}
+	return strings.Join(p, "|")
+}
+
+// CompleteFish generates a completion script for fish.
+func (u Usage) CompleteFish(name, site string) string {
+	b := new(strings.Builder)
+	fmt.Fprintf(b, `# Completion for "%[1]s"; %[2]s
+#
+# Save as ~/.config/fish/completions/%[1]s.fish
+
+`, name, site)
+
+	q := func(s string) string { return `'` + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + `'` }
+	seen := func(names []string) string {
+		l := make([]string, 0, len(names))
+		for _, n := range names {
+			if len(n) == 1 {
+				l = append(l, "-s "+n)
+			} else {
+				l = append(l, "-o "+n)
+			}
+		}
+		return strings.Join(l, " ")
+	}
+	switch strings.TrimSuffix(u.Args, "...") {
+	case "file":
+	case "dir":
+		fmt.Fprintf(b, "complete -c %s -f -a '(__fish_complete_directories)'\n", name)
+	default:
+		fmt.Fprintf(b, "complete -c %s -f\n", name)
+	}
+	for _, f := range u.allFlags() {
+		bare := f.Bare()
+		fmt.Fprintf(b, "complete -c %s %s", name, seen(bare))
+
+		var cond []string
+		if f.Exit {
+			cond = append(cond, "test (count (commandline -opc)) -eq 1")
+		}
+		if !f.Repeat {
+			cond = append(cond, "not __fish_seen_argument "+seen(append(bare, f.Aliases...)))
+		}
+		if len(f.Conflicts) > 0 {
+			cond = append(cond, "not __fish_seen_argument "+seen(f.Conflicts))
+		}
+		if len(cond) > 0 {
+			fmt.Fprintf(b, " -n %s", q(strings.Join(cond, "; and ")))
+		}
+		if f.Arg != "" {
+			switch {
+			case len(f.Values) > 0:
+				fmt.Fprintf(b, " -x -a %s", q(strings.Join(f.Values, " ")))
+			case f.Kind == "file":
+				b.WriteString(" -r -F")
+			case f.Kind == "dir":
+				b.WriteString(" -x -a '(__fish_complete_directories)'")
+			default:
+				b.WriteString(" -x")
+			}
+		}
+		fmt.Fprintf(b, " -d %s\n", q(f.Short))
+	}
+	return b.String()
+}
+
+// CompletePowerShell generates a completion script for PowerShell.
+func (u Usage) CompletePowerShell(name, site string) string {
+	q := func(s string) string { return `'` + strings.ReplaceAll(s, `'`, `''`) + `'` }
+	list := func(l []string) string {
+		qq := make([]string, 0, len(l))
+		for _, s := range l {
+			qq = append(qq, q(s))
+		}
+		return "@(" + strings.Join(qq, ", ") + ")"
+	}
+	flags := new(strings.Builder)
+	for _, f := range u.allFlags() {
+		fmt.Fprintf(flags, "        @{ Names = %s; Aliases = %s; Arg = $%t; Kind = %s; Values = %s; Conflicts = %s; Repeat = $%t; Exit = $%t; Desc = %s }\n",
+			list(f.Bare()), list(f.Aliases), f.Arg != "", q(f.Kind), list(f.Values), list(f.Conflicts),
+			f.Repeat, f.Exit, q(f.Short))
+	}
+
+	b := new(strings.Builder)
+	fmt.Fprintf(b, `# Completion for "%[1]s"; %[2]s
+#
+# Add this to your $PROFILE:
+#
+#   %[1]s -completion=powershell | Out-String | Invoke-Expression
+
+Register-ArgumentCompleter -Native -CommandName %[1]s -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+
+    $flags = @(
+%[3]s    )
+    $words = @($commandAst.CommandElements | Select-Object -Skip 1 |
+        Where-Object { $_.Extent.EndOffset -lt $cursorPosition } |
+        ForEach-Object { $_.Extent.Text })
+    $result = [System.Management.Automation.CompletionResult]
+    $quote = { param($s) if ($s -match '^[\w=-]+$') { $s } else { "'$s'" } }
+
+    # -flag=value, or -flag value.
+    $flag, $val = $null, $wordToComplete
+    if ($wordToComplete -match '^--?([^=]+)=(.*)$') {
+        $flag, $val = $Matches[1], $Matches[2]
+    } elseif ($words.Count -gt 0 -and $words[-1] -match '^--?([^=]+)$') {
+        $flag = $Matches[1]
+    }
+    if ($flag) {
+        $f = $flags | Where-Object { $_.Arg -and ($_.Names + $_.Aliases) -ccontains $flag } | Select-Object -First 1
+        if ($f -and ($f.Kind -eq 'file' -or $f.Kind -eq 'dir') -and -not $f.Values) {
+            return  # Use default path completion.
+        }
+        if ($f) {
+            foreach ($v in $f.Values) {
+                if ($v -clike "$val*") {
+                    $c = if ($wordToComplete -match '=') { "-$flag=$v" } else { $v }
+                    $result::new((& $quote $c), $v, 'ParameterValue', $v)
+                }
+            }
+            return
+        }
+    }
+
+    $seen = @($words | Where-Object { $_ -like '-*' } |
+        ForEach-Object { ($_ -replace '^--?', '') -replace '=.*$', '' })
+    if ($flags | Where-Object { $_.Exit -and (($_.Names + $_.Aliases) | Where-Object { $seen -ccontains $_ }) }) {
+        return
+    }
+    if ($wordToComplete -notlike '-*') {
+        return
+    }
+    foreach ($f in $flags) {
+        if ($f.Exit -and $words.Count -gt 0) { continue }
+        if (-not $f.Repeat -and (($f.Names + $f.Aliases) | Where-Object { $seen -ccontains $_ })) { continue }
+        if ($f.Conflicts | Where-Object { $seen -ccontains $_ }) { continue }
+        foreach ($n in $f.Names) {
+            $c = if ($f.Arg) { "-$n=" } else { "-$n" }
+            if ($c -clike "$wordToComplete*") {
+                $result::new((& $quote $c), "-$n", 'ParameterName', $f.Desc)
+            }
+        }
+    }
+}
+`, name, site, flags)
+	return b.String()
+}
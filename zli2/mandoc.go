@@ -0,0 +1,300 @@
+package zli2
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Mandoc generates a manpage in the mdoc format.
+//
+// Sections with flags are added as subsections of DESCRIPTION. The
+// "Environment" section is added as ENVIRONMENT, and is parsed as a list of
+// variable names followed by a description; names without a description are
+// grouped with the previous one. An "Exit status" section is used as EXIT
+// STATUS, or the standard "exits 0 on success, and >0 if an error occurs" if
+// there is none.
+//
+// Indented paragraphs in section text are added as literal displays, and
+// references to flags and URLs in the text are marked up.
+//
+// The date is set from $SOURCE_DATE_EPOCH if it's set, for reproducible builds.
+func (u Usage) Mandoc(name string, sect int) string {
+	m := mdoc{b: new(strings.Builder), flags: make(map[string]bool)}
+	for _, f := range u.allFlags() {
+		for _, n := range append(f.Bare(), f.Aliases...) {
+			m.flags[n] = true
+		}
+	}
+
+	date := time.Now()
+	if e, err := strconv.ParseInt(os.Getenv("SOURCE_DATE_EPOCH"), 10, 64); err == nil {
+		date = time.Unix(e, 0).UTC()
+	}
+	fmt.Fprintf(m.b, ".Dd %s\n", date.Format("January 2, 2006"))
+	fmt.Fprintf(m.b, ".Dt %s %d\n", strings.ToUpper(name), sect)
+	m.b.WriteString(".Os\n")
+
+	// Use the first sentence of the intro as the description, and the rest in
+	// DESCRIPTION.
+	intro := strings.TrimPrefix(strings.Join(strings.Fields(u.Intro), " "), name+" ")
+	desc, rest := intro, ""
+	if i := strings.Index(intro, ". "); i > -1 {
+		desc, rest = intro[:i], intro[i+2:]
+	}
+	desc = strings.TrimSuffix(desc, ".")
+	fmt.Fprintf(m.b, ".Sh NAME\n.Nm %s\n.Nd %s\n", name, m.escape(desc))
+
+	m.b.WriteString(".Sh SYNOPSIS\n.Nm\n")
+	var letters []string
+	for _, f := range u.allFlags() {
+		for _, n := range f.Bare() {
+			if f.Arg == "" && len(n) == 1 && isAlnum(n[0]) && !slices.Contains(letters, n) {
+				letters = append(letters, n)
+			}
+		}
+	}
+	if len(letters) > 0 {
+		slices.Sort(letters)
+		fmt.Fprintf(m.b, ".Op Fl %s\n", strings.Join(letters, ""))
+	}
+	if kind, many := strings.CutSuffix(u.Args, "..."); kind != "" {
+		if many {
+			kind += " ..."
+		}
+		fmt.Fprintf(m.b, ".Op Ar %s\n", kind)
+	}
+
+	m.b.WriteString(".Sh DESCRIPTION\n.Nm\n")
+	m.text(desc + ".")
+	if rest != "" {
+		m.b.WriteString(".Pp\n")
+		m.text(rest)
+	}
+
+	var env, exit *Section
+	for i, s := range u.Sections {
+		switch strings.ToLower(s.Title) {
+		case "environment":
+			env = &u.Sections[i]
+			continue
+		case "exit status":
+			exit = &u.Sections[i]
+			continue
+		}
+
+		fmt.Fprintf(m.b, ".Ss %s\n", m.escape(s.Title))
+		if s.Text != "" {
+			m.section(s.Text)
+		}
+		if len(s.Flags) == 0 {
+			continue
+		}
+		m.b.WriteString(".Bl -tag -width Ds\n")
+		for _, f := range s.Flags {
+			m.b.WriteString(".It")
+			for i, n := range f.Names {
+				if i > 0 {
+					m.b.WriteString(" ,")
+				}
+				m.flag(n, f)
+			}
+			m.b.WriteByte('\n')
+			m.text(f.Text)
+		}
+		m.b.WriteString(".El\n")
+	}
+
+	if env != nil {
+		// Names without a description are grouped with the previous one.
+		var (
+			defs, _ = parseDefs(env.Text)
+			names   [][]string
+			texts   []string
+		)
+		for _, d := range defs {
+			n := strings.TrimSpace(d.term)
+			if len(d.lines) == 0 && len(names) > 0 {
+				names[len(names)-1] = append(names[len(names)-1], n)
+				continue
+			}
+			names, texts = append(names, []string{n}), append(texts, strings.Join(d.lines, "\n"))
+		}
+		m.b.WriteString(".Sh ENVIRONMENT\n.Bl -tag -width Ds\n")
+		for i := range names {
+			fmt.Fprintf(m.b, ".It Ev %s\n", strings.Join(names[i], " , Ev "))
+			m.text(texts[i])
+		}
+		m.b.WriteString(".El\n")
+	}
+
+	m.b.WriteString(".Sh EXIT STATUS\n")
+	if exit != nil {
+		m.section(exit.Text)
+	} else {
+		m.b.WriteString(".Ex -std\n")
+	}
+	return m.b.String()
+}
+
+type mdoc struct {
+	b     *strings.Builder
+	flags map[string]bool // All flag names and aliases, without "-".
+}
+
+func isAlnum(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// Escape backslashes, and periods and apostrophes at the start of the line
+// (which would be a macro).
+func (m mdoc) escape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\e`)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
+
+// Escape a macro argument that would otherwise be parsed as a delimiter (e.g.
+// "-,") or macro (e.g. "-Ar").
+func (m mdoc) arg(s string) string {
+	if len(s) == 1 && !isAlnum(s[0]) || len(s) == 2 && s[0] >= 'A' && s[0] <= 'Z' && s[1] >= 'a' && s[1] <= 'z' {
+		return `\&` + s
+	}
+	return s
+}
+
+// Write a flag name from the usage, such as "-a" or "-sort=..", as macro
+// arguments.
+func (m mdoc) flag(name string, f Flag) {
+	name, arg, hasArg := strings.Cut(strings.TrimPrefix(name, "-"), "=")
+	fmt.Fprintf(m.b, " Fl %s", m.arg(name))
+	if !hasArg {
+		return
+	}
+	if arg == ".." {
+		arg = f.Kind
+		if arg == "string" || arg == "" {
+			arg = "value"
+		}
+	}
+	if f.Optional {
+		fmt.Fprintf(m.b, " Ns Op = Ns Ar %s", arg)
+	} else {
+		fmt.Fprintf(m.b, " Ns = Ns Ar %s", arg)
+	}
+}
+
+// Write section text; paragraphs are separated by blank lines, and indented
+// paragraphs are literal displays.
+func (m mdoc) section(text string) {
+	paras := strings.Split(text, "\n\n")
+	for i := 0; i < len(paras); i++ {
+		if !strings.HasPrefix(paras[i], " ") {
+			if i > 0 { // Not needed directly after .Sh or .Ss.
+				m.b.WriteString(".Pp\n")
+			}
+			m.text(paras[i])
+			continue
+		}
+
+		// Merge indented paragraphs with blank lines in between.
+		block := paras[i]
+		for i+1 < len(paras) && strings.HasPrefix(paras[i+1], " ") {
+			i++
+			block += "\n\n" + paras[i]
+		}
+		lines := strings.Split(block, "\n")
+		indent := -1
+		for _, l := range lines {
+			if l != "" && (indent == -1 || countSpace(l) < indent) {
+				indent = countSpace(l)
+			}
+		}
+		m.b.WriteString(".Bd -literal -offset indent\n")
+		for _, l := range lines {
+			if len(l) >= indent {
+				l = l[indent:]
+			}
+			m.b.WriteString(m.escape(l) + "\n")
+		}
+		m.b.WriteString(".Ed\n")
+	}
+}
+
+var (
+	reFlagRef = regexp.MustCompile(`^([(\[]*)-([a-zA-Z0-9][a-zA-Z0-9-]*)(?:=([^\s,;:()\[\]]*[^\s.,;:()\[\]]))?([.,;:?!)\]]*)$`)
+	reURL     = regexp.MustCompile(`^(https?://[^\s]*[^\s.,;:?!)\]])([.,;:?!)\]]*)$`)
+)
+
+// Write filled text, with one sentence per line. Flags and URLs are marked up,
+// and a "@@" at the end of a line is a hard line break.
+func (m mdoc) text(text string) {
+	var (
+		line  []string
+		words = strings.Fields(strings.ReplaceAll(text, "@@", " @@ "))
+	)
+	flush := func() {
+		if len(line) > 0 {
+			m.b.WriteString(m.escape(strings.Join(line, " ")) + "\n")
+			line = line[:0]
+		}
+	}
+	// "(-a)," → ".Fl ( a ) ,"
+	delims := func(s string) string {
+		return strings.Join(strings.Split(s, ""), " ")
+	}
+	for i, w := range words {
+		if w == "@@" {
+			flush()
+			if i < len(words)-1 {
+				m.b.WriteString(".br\n")
+			}
+			continue
+		}
+
+		if r := reFlagRef.FindStringSubmatch(w); r != nil && m.flags[r[2]] {
+			flush()
+			m.b.WriteString(".Fl")
+			if r[1] != "" {
+				m.b.WriteString(" " + delims(r[1]))
+			}
+			m.b.WriteString(" " + m.arg(r[2]))
+			if r[3] != "" {
+				m.b.WriteString(" Ns = Ns Ar " + m.escape(r[3]))
+			}
+			if r[4] != "" {
+				m.b.WriteString(" " + delims(r[4]))
+			}
+			m.b.WriteByte('\n')
+			continue
+		}
+		if r := reURL.FindStringSubmatch(w); r != nil {
+			flush()
+			m.b.WriteString(".Lk " + r[1])
+			if r[2] != "" {
+				m.b.WriteString(" " + delims(r[2]))
+			}
+			m.b.WriteByte('\n')
+			continue
+		}
+
+		line = append(line, w)
+		// New sentence, new line.
+		if t := strings.TrimRight(w, `"')`); t != "" && strings.ContainsAny(t[len(t)-1:], ".?!") &&
+			i+1 < len(words) && isSentenceStart(words[i+1]) {
+			flush()
+		}
+	}
+	flush()
+}
+
+func isSentenceStart(w string) bool {
+	w = strings.TrimLeft(w, `"'(`)
+	return w != "" && (w[0] >= 'A' && w[0] <= 'Z')
+}
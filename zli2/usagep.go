@@ -2,9 +2,11 @@ package zli2
 
 import (
 	"fmt"
+	"os"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
-	"time"
 
 	"zgo.at/termtext"
 	"zgo.at/zli"
@@ -41,11 +43,51 @@ import (
 //                   never     Never do it.@@
 //                   always    Always force it.@@
 //     -a, -all   All!
+//
+// Some information about flags is inferred from the text, which is used for
+// shell completion:
+//
+//   - Flags ending with "=.." or "=word" take an argument.
+//
+//   - If the description ends with a list of words after a ":" or ";", then
+//     those are the accepted values; for example "When to colour; always,
+//     never, or auto (default)". Words may be quoted and followed by a remark
+//     in parentheses.
+//
+//   - If those values refer to other flags in parentheses, then they're all
+//     alternatives and conflict with each other; for example "Sort by: size
+//     (-S), time (-t)".
+//
+//   - Flags with "twice" in the description can be repeated (e.g. -ll).
+//
+//   - Flags with "and exit" in the description can't be combined with
+//     anything else.
+//
+// This can be set explicitly with an annotation in {..} on the last line of
+// the description, which isn't displayed:
+//
+//     -color=..  When to apply colours.
+//                {optional alias=-colour values=always,never,auto}
+//
+// The annotations are:
+//
+//     short="text"      Short description; the default is the first sentence.
+//     arg=kind          Kind of argument: string, number, file, or dir.
+//     optional          The argument can be omitted.
+//     values=a,b        Accepted values for the argument.
+//     conflicts=-a,-b   Flags that can't be combined with this one.
+//     alias=-a,-b       Additional names that aren't shown.
+//     repeat            Can be given more than once (e.g. -ll).
+//     exit              Exits; can't be combined with anything else.
+//
+// The intro can have an {args=kind} annotation for the positional arguments,
+// with "..." appended if it accepts more than one (e.g. {args=file...}).
 
 type (
 	Usage struct {
-		flags    map[string]string
+		flags    map[string]Flag
 		Intro    string
+		Args     string // Kind of positional arguments, e.g. "file" or "file...".
 		Sections []Section
 	}
 	Section struct {
@@ -55,17 +97,225 @@ type (
 		Flags []Flag
 	}
 	Flag struct {
-		Names []string
-		Text  string
-		Line  int
+		Names     []string
+		Text      string
+		Line      int
+		Short     string   // Short description.
+		Arg       string   // Argument placeholder ("..", "n"); empty if it doesn't take one.
+		Kind      string   // Kind of argument: string, number, file, or dir.
+		Optional  bool     // Argument is optional.
+		Values    []string // Accepted values, if known.
+		Conflicts []string // Flags that conflict with this one, without the "-".
+		Aliases   []string // Names that aren't shown, without the "-".
+		Repeat    bool     // Can be repeated, e.g. -ll.
+		Exit      bool     // Exits; can't be combined with other flags.
+	}
+)
+
+var reAnnotation = regexp.MustCompile(`(?:^|\n)\{([^{}]*)\}$`)
+
+// Remove the {..} annotation from the end of the text, if any.
+func cutAnnotation(text string) (string, map[string]string, error) {
+	m := reAnnotation.FindStringSubmatchIndex(text)
+	if m == nil {
+		return text, nil, nil
+	}
+	ann, err := parseAnnotation(text[m[2]:m[3]])
+	return strings.TrimSpace(text[:m[0]]), ann, err
+}
+
+// Parse key=value pairs; the value may be quoted, and can be omitted.
+func parseAnnotation(s string) (map[string]string, error) {
+	ann := make(map[string]string)
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		i := strings.IndexAny(s, "= ")
+		if i == -1 {
+			i = len(s)
+		}
+		k := s[:i]
+		if k == "" {
+			return nil, fmt.Errorf("annotation without name in %q", s)
+		}
+		s = s[i:]
+		if !strings.HasPrefix(s, "=") {
+			ann[k] = ""
+			continue
+		}
+		s = s[1:]
+		if strings.HasPrefix(s, `"`) {
+			q, err := strconv.QuotedPrefix(s)
+			if err != nil {
+				return nil, fmt.Errorf("annotation %q: %w", k, err)
+			}
+			s = s[len(q):]
+			ann[k], _ = strconv.Unquote(q)
+			continue
+		}
+		v, rest, _ := strings.Cut(s, " ")
+		ann[k], s = v, rest
+	}
+	return ann, nil
+}
+
+func splitFlags(s string) []string {
+	l := strings.Split(s, ",")
+	for i := range l {
+		l[i] = strings.TrimLeft(strings.TrimSpace(l[i]), "-")
+	}
+	return l
+}
+
+func (f *Flag) annotate(ann map[string]string) error {
+	for k, v := range ann {
+		switch k {
+		default:
+			return fmt.Errorf("unknown annotation %q", k)
+		case "short":
+			f.Short = v
+		case "arg":
+			switch v {
+			default:
+				return fmt.Errorf("unknown argument kind %q", v)
+			case "string", "number", "file", "dir":
+				f.Kind = v
+			}
+			if f.Arg == "" {
+				f.Arg = v
+			}
+		case "optional":
+			f.Optional = true
+		case "values":
+			f.Values = strings.Split(v, ",")
+		case "conflicts":
+			f.Conflicts = splitFlags(v)
+		case "alias":
+			f.Aliases = splitFlags(v)
+		case "repeat":
+			f.Repeat = true
+		case "exit":
+			f.Exit = true
+		}
+	}
+	return nil
+}
+
+// Bare gets the names without the leading "-" and "=.." argument.
+func (f Flag) Bare() []string {
+	n := make([]string, 0, len(f.Names))
+	for _, nn := range f.Names {
+		nn, _, _ = strings.Cut(strings.TrimLeft(nn, "-"), "=")
+		n = append(n, nn)
 	}
+	return n
+}
+
+var (
+	reRepeat = regexp.MustCompile(`\btwice\b`)
+	reExit   = regexp.MustCompile(`\band exit\b`)
+	reValue  = regexp.MustCompile(`^"?([a-zA-Z0-9_-]+)"?(?:\s+\((-[a-zA-Z0-9_-]+)\)|\s+\([^)]*\))?$`)
+	reSplit  = regexp.MustCompile(`,\s+(?:or\s+|and\s+)?|\s+or\s+`)
 )
 
+// Get the accepted values from a list at the end of the text, and the flags
+// they refer to.
+func parseValues(text string) (values, refs []string) {
+	text = strings.TrimSuffix(strings.Join(strings.Fields(text), " "), ".")
+	i := strings.LastIndexAny(text, ":;")
+	if i == -1 {
+		return nil, nil
+	}
+	items := reSplit.Split(strings.TrimSpace(text[i+1:]), -1)
+	if len(items) < 2 {
+		return nil, nil
+	}
+	for _, it := range items {
+		m := reValue.FindStringSubmatch(it)
+		if m == nil {
+			return nil, nil
+		}
+		values = append(values, m[1])
+		if m[2] != "" {
+			refs = append(refs, m[2])
+		}
+	}
+	return values, refs
+}
+
+// Infer flag information from the text; see package comment.
+func (u *Usage) inferFlags() {
+	var (
+		all    = make(map[string][]string) // -flag → all names of the flag.
+		groups = make(map[string][]string) // -flag → conflicting flags.
+	)
+	for _, s := range u.Sections {
+		for _, f := range s.Flags {
+			for _, n := range f.Bare() {
+				all[n] = f.Bare()
+			}
+		}
+	}
+	for si := range u.Sections {
+		for fi := range u.Sections[si].Flags {
+			f := &u.Sections[si].Flags[fi]
+			for _, n := range f.Names {
+				if _, a, ok := strings.Cut(n, "="); ok {
+					f.Arg = a
+				}
+			}
+			if f.Arg != "" && f.Kind == "" {
+				f.Kind = "string"
+			}
+			if f.Short == "" {
+				f.Short = short(f.Text)
+			}
+			f.Repeat = f.Repeat || reRepeat.MatchString(f.Text)
+			f.Exit = f.Exit || reExit.MatchString(f.Text)
+			if f.Arg == "" {
+				continue
+			}
+			values, refs := parseValues(f.Text)
+			if f.Values == nil {
+				f.Values = values
+			}
+			if len(refs) == 0 {
+				continue
+			}
+			group := f.Bare()
+			for _, r := range refs {
+				group = append(group, all[strings.TrimLeft(r, "-")]...)
+			}
+			for _, n := range group {
+				groups[n] = append(groups[n], group...)
+			}
+		}
+	}
+	// Conflicts from annotations go both ways.
+	for _, s := range u.Sections {
+		for _, f := range s.Flags {
+			for _, c := range f.Conflicts {
+				for _, n := range all[c] {
+					groups[n] = append(groups[n], f.Bare()...)
+				}
+			}
+		}
+	}
+	for si := range u.Sections {
+		for fi := range u.Sections[si].Flags {
+			f := &u.Sections[si].Flags[fi]
+			for _, c := range groups[f.Bare()[0]] {
+				if !slices.Contains(f.Bare(), c) && !slices.Contains(f.Conflicts, c) {
+					f.Conflicts = append(f.Conflicts, c)
+				}
+			}
+		}
+	}
+}
+
 var reFlag = regexp.MustCompile(`^(?:\t|    )(-(?:[a-zA-Z0-9_.=…-]+|,)(?:, )?)+`)
 
 func Parse(s string) (Usage, error) {
 	var (
-		u       = Usage{flags: make(map[string]string)}
+		u       = Usage{flags: make(map[string]Flag)}
 		lines   = strings.Split(strings.TrimSpace(s), "\n")
 		curSect Section
 		cur     strings.Builder
@@ -85,7 +335,17 @@ func Parse(s string) (Usage, error) {
 		if (l[0] != ' ' && l[0] != '\t') && strings.HasSuffix(l, ":") {
 			if cur.Len() > 0 {
 				if curSect.Title == "" {
-					u.Intro = strings.TrimSpace(cur.String())
+					intro, ann, err := cutAnnotation(strings.TrimSpace(cur.String()))
+					if err != nil {
+						return u, fmt.Errorf("line %d: %w", i+1, err)
+					}
+					u.Intro = intro
+					for k, v := range ann {
+						if k != "args" {
+							return u, fmt.Errorf("line %d: unknown annotation %q", i+1, k)
+						}
+						u.Args = v
+					}
 				} else {
 					curSect.Text = strings.TrimSpace(cur.String())
 					u.Sections = append(u.Sections, curSect)
@@ -110,13 +370,22 @@ func Parse(s string) (Usage, error) {
 				if countSpace(next) < off {
 					break
 				}
-				fl.Text += "\n" + strings.TrimLeft(next, " ")
+				fl.Text += "\n" + next[off:]
 				skip++
 			}
+			text, ann, err := cutAnnotation(fl.Text)
+			if err != nil {
+				return u, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			fl.Text = text
 			for _, n := range fl.Names {
-				u.flags[strings.TrimLeft(n, "-")] = fl.Text
+				if _, a, ok := strings.Cut(n, "="); ok {
+					fl.Arg = a
+				}
+			}
+			if err := fl.annotate(ann); err != nil {
+				return u, fmt.Errorf("line %d: %w", i+1, err)
 			}
-
 			curSect.Flags = append(curSect.Flags, fl)
 			continue
 		}
@@ -128,6 +397,12 @@ func Parse(s string) (Usage, error) {
 		curSect.Text = strings.TrimSpace(cur.String())
 		u.Sections = append(u.Sections, curSect)
 	}
+	u.inferFlags()
+	for _, f := range u.allFlags() {
+		for _, n := range append(f.Bare(), f.Aliases...) {
+			u.flags[n] = f
+		}
+	}
 	return u, nil
 }
 
@@ -150,101 +425,241 @@ func countSpace(s string) int {
 	return n
 }
 
-// Section gets documentation for the section.
-func (u Usage) Section(name string) (string, bool) {
-	s, ok := u.flags[strings.TrimLeft(name, "-")]
-	return s, ok
+// Section gets the section by title, case-insensitive.
+func (u Usage) Section(name string) (Section, bool) {
+	for _, s := range u.Sections {
+		if strings.EqualFold(s.Title, name) {
+			return s, true
+		}
+	}
+	return Section{}, false
+}
+
+// Flag gets the flag by any of its names or aliases, with or without leading
+// "-".
+func (u Usage) Flag(name string) (Flag, bool) {
+	f, ok := u.flags[strings.TrimLeft(name, "-")]
+	return f, ok
 }
 
-// flag gets documentation for the flag.
-func (u Usage) Flag(name string) (string, bool) {
-	s, ok := u.flags[strings.TrimLeft(name, "-")]
-	return s, ok
+// String formats the usage for the width of the terminal; see Format.
+func (u Usage) String() string {
+	return u.Format(TermWidth())
 }
 
-// TODO: store flags map per section.
-// func (s Section) Flag(name string) (string,bool _
-// }
+// TermWidth gets the width of the terminal from $COLUMNS, or the size of
+// stdout. It returns 0 if neither works.
+func TermWidth() int {
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+	n, _, err := zli.TerminalSize(os.Stdout.Fd())
+	if err != nil {
+		return 0
+	}
+	return n
+}
 
-// Should print back the original.
-func (u Usage) String() string {
+// Format the usage, reflowing text to the given width. The default for 0 is
+// 80.
+func (u Usage) Format(width int) string {
+	if width <= 0 {
+		width = 80
+	}
 	b := new(strings.Builder)
-	b.WriteString(u.Intro)
-	b.WriteByte('\n')
-
-	for _, s := range u.Sections {
-		fmt.Fprintf(b, "\n%s%s:%s\n", zli.Bold, s.Title, zli.Reset)
-		if s.Text != "" {
-			fmt.Fprintf(b, "\n    %s", strings.ReplaceAll(s.Text, "\n", "\n    "))
+	for i, p := range strings.Split(u.Intro, "\n\n") {
+		if i > 0 {
+			b.WriteByte('\n')
 		}
+		b.WriteString(reflow(p, "", width))
+	}
+	for _, s := range u.Sections {
 		b.WriteByte('\n')
-		for _, f := range s.Flags {
-			// for i := range f.Names { f.Names[i] = zli.Colorize(f.Names[i], zli.Bold) }
-			n := termtext.AlignLeft(strings.Join(f.Names, ", "), 16)
+		b.WriteString(s.Format(width))
+	}
+	return b.String()
+}
+
+// Format the section title, text, and flags.
+func (s Section) Format(width int) string {
+	if width <= 0 {
+		width = 80
+	}
+	b := new(strings.Builder)
+	fmt.Fprintf(b, "%s%s:%s\n\n", zli.Bold, s.Title, zli.Reset)
 
-			//f.Text = termtext.WordWrap(strings.ReplaceAll(f.Text, "\n", " "), 58, strings.Repeat(" ", 22))
-			f.Text = strings.ReplaceAll(f.Text, "\n", "\n"+strings.Repeat(" ", 22))
-			fmt.Fprintf(b, "    %s  %s\n", n, f.Text)
+	// Paragraphs are reflowed, and indented paragraphs are printed as-is,
+	// except for definition lists like:
+	//
+	//    word  Text which is indented to the
+	//          same column on every line.
+	//    other
+	//
+	// Which are reflowed with a hanging indent, as are indented paragraphs
+	// that follow a definition with the same indent.
+	defCol := -1
+	for i, p := range strings.Split(s.Text, "\n\n") {
+		if s.Text == "" {
+			break
+		}
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		if defs, ok := parseDefs(p); ok {
+			for _, d := range defs {
+				if len(d.lines) == 0 {
+					b.WriteString("    " + d.term + "\n")
+					continue
+				}
+				defCol = len(d.term)
+				text := reflow(strings.Join(d.lines, "\n"), strings.Repeat(" ", 4+defCol), width)
+				b.WriteString("    " + d.term + strings.TrimLeft(text, " "))
+			}
+			continue
 		}
+
+		lines := strings.Split(p, "\n")
+		switch {
+		case !strings.HasPrefix(p, " "):
+			b.WriteString(reflow(p, "    ", width))
+			defCol = -1
+		case defCol > -1 && sameIndent(lines, defCol):
+			b.WriteString(reflow(p, "    ", width))
+		default:
+			defCol = -1
+			for _, l := range lines {
+				b.WriteString("    " + l + "\n")
+			}
+		}
+	}
+	if s.Text != "" && len(s.Flags) > 0 {
+		b.WriteByte('\n')
+	}
+	for _, f := range s.Flags {
+		b.WriteString(f.Format(width))
 	}
 	return b.String()
 }
 
-func (u Usage) Mandoc(name string, sect int) string {
-	b := new(strings.Builder)
+// Format the flag names and text, with the text starting at column 21.
+func (f Flag) Format(width int) string {
+	if width <= 0 {
+		width = 80
+	}
+	const col = 21
+	var (
+		b      = new(strings.Builder)
+		names  = strings.Join(f.Names, ", ")
+		indent = strings.Repeat(" ", col)
+	)
+	if termtext.Width(names) > col-6 {
+		fmt.Fprintf(b, "    %s\n", names)
+	} else {
+		fmt.Fprintf(b, "    %s  ", termtext.AlignLeft(names, col-6))
+	}
+	b.WriteString(strings.TrimPrefix(reflow(f.Text, indent, width), indent))
+	return b.String()
+}
 
-	fmt.Fprintf(b, ".Dd %s \n", time.Now().Format("January 2, 2006"))
-	fmt.Fprintf(b, ".Dt %s %d\n", strings.ToUpper(name), sect)
-	b.WriteString(".Os\n")
-	b.WriteString(".Sh NAME\n")
-	u.Intro = strings.TrimPrefix(u.Intro, name+" ")
-	fmt.Fprintf(b, "%s – %s\n", name, u.Intro)
+var reDef = regexp.MustCompile(`^ *\S+(?: \S+)*  +()\S`)
 
-	for _, s := range u.Sections {
-		fmt.Fprintf(b, ".Sh %s\n", strings.ToUpper(s.Title))
-		if s.Text != "" {
-			fmt.Fprintf(b, ".Pp\n%s\n", s.Text)
+type def struct {
+	term  string   // Including indent and trailing spaces.
+	lines []string // Without indent.
+}
+
+// Parse a definition list; see Section.Format.
+func parseDefs(p string) ([]def, bool) {
+	var (
+		lines = strings.Split(p, "\n")
+		ind   = countSpace(lines[0])
+		defs  []def
+		col   = -1
+	)
+	if !reDef.MatchString(lines[0]) {
+		return nil, false
+	}
+	for _, l := range lines {
+		m := reDef.FindStringSubmatchIndex(l)
+		switch {
+		case col > -1 && countSpace(l) == col && len(l) > col:
+			defs[len(defs)-1].lines = append(defs[len(defs)-1].lines, l[col:])
+		case countSpace(l) == ind && m != nil:
+			col = m[2]
+			defs = append(defs, def{term: l[:col], lines: []string{l[col:]}})
+		case countSpace(l) == ind && !strings.Contains(l[ind:], " "):
+			col = -1
+			defs = append(defs, def{term: l})
+		default:
+			return nil, false
 		}
-		fmt.Fprintf(b, ".Bl -tag -width indent\n")
-		// .It Fl D Ar format               → -D format
-		// .It Fl -color Ns = Ns Ar when    → --color=when
-		for _, f := range s.Flags {
-			for i := range f.Names {
-				f.Names[i] = strings.TrimPrefix(f.Names[i], "-")
+	}
+	return defs, true
+}
+
+// Report if all lines are indented with exactly n spaces.
+func sameIndent(lines []string, n int) bool {
+	for _, l := range lines {
+		if countSpace(l) != n || len(l) == n {
+			return false
+		}
+	}
+	return true
+}
+
+// Reflow text to fit in width, with every line prefixed with prefix. Lines
+// ending in "@@" are hard line breaks, and the text after it keeps its
+// indentation.
+func reflow(text, prefix string, width int) string {
+	var (
+		b    = new(strings.Builder)
+		segs []string
+		cur  []string
+	)
+	for _, l := range strings.Split(text, "\n") {
+		l, brk := strings.CutSuffix(strings.TrimRight(l, " "), "@@")
+		cur = append(cur, l)
+		if brk {
+			segs, cur = append(segs, strings.Join(cur, "\n")), nil
+		}
+	}
+	if len(cur) > 0 {
+		segs = append(segs, strings.Join(cur, "\n"))
+	}
+
+	for _, seg := range segs {
+		var (
+			pre   = prefix + strings.Repeat(" ", countSpace(seg))
+			avail = max(width-termtext.Width(pre), 20)
+			line  string
+		)
+		// Keep single lines that fit as-is, for aligned text after a "@@".
+		if l := strings.TrimSpace(seg); !strings.Contains(l, "\n") && termtext.Width(l) <= avail {
+			b.WriteString(pre + l + "\n")
+			continue
+		}
+		for _, w := range strings.Fields(seg) {
+			switch {
+			case line == "":
+				line = w
+			case termtext.Width(line)+1+termtext.Width(w) > avail:
+				b.WriteString(pre + line + "\n")
+				line = w
+			default:
+				line += " " + w
 			}
-			fmt.Fprintf(b, ".It Fl %s\n", strings.Join(f.Names, " , Fl "))
-			// TODO: marking flags like this breaks some stuff; need to look
-			// into it
-			// regexp.MustCompile(`-\w+`).ReplaceAllStringFunc(f.Text, func(s string) string {
-			// 	s = strings.TrimLeft(s, "-")
-			// 	if _, ok := u.Flag(s); ok {
-			// 		return "\n.Fl " + s + "\n"
-			// 	}
-			// 	return s
-			// })
-			fmt.Fprintf(b, "%s\n", f.Text)
 		}
-		fmt.Fprintf(b, ".El\n")
+		b.WriteString(pre + line + "\n")
 	}
 	return b.String()
 }
 
-// TODO: finish; to really get something decent we need at least:
-//
-// - A short description for flags.
-// - Annotate which flags conflict.
-// - Know if _files is correct.
-// - Flags that can be doubled (-ll).
-//
-// And also:
-//
-// - Flags that take arguments, and what kind.
-// - Positional arguments.
+// CompleteZsh generates a completion script for zsh.
 func (u Usage) CompleteZsh(name, site string) string {
 	b := new(strings.Builder)
 	b.WriteString(fmt.Sprintf(`#compdef %[1]s
 
-# Completion for "elles"; %[2]s 
+# Completion for "%[1]s"; %[2]s
 #
 # Save as "_%[1]s" in any directory in $fpath; see the current list with:
 #
@@ -259,36 +674,78 @@ local arguments
 arguments=(
 `, name, site))
 
-	flRepl := strings.NewReplacer(`'`, `\'`, "\n", " ")
+	q := func(s string) string { return strings.ReplaceAll(s, `'`, `'\''`) }
+	desc := strings.NewReplacer(`'`, `'\''`, "[", `\[`, "]", `\]`)
 	for _, s := range u.Sections {
 		for _, f := range s.Flags {
-			var n string
-			if len(f.Names) > 1 {
-				n = "{" + strings.Join(f.Names, ",") + "}"
-			} else {
-				n = f.Names[0]
+			var excl string
+			switch {
+			case f.Exit:
+				excl = "- :"
+			case f.Repeat:
+				excl = "-" + strings.Join(f.Conflicts, " -")
+			default:
+				excl = "-" + strings.Join(append(append(f.Bare(), f.Aliases...), f.Conflicts...), " -")
 			}
-			fmt.Fprintf(b, "\t(%s)%s'[%s]'\n",
-				strings.Join(f.Names, " "),
-				n,
-				flRepl.Replace(f.Text))
+			if excl == "-" {
+				excl = ""
+			}
+
+			names := make([]string, 0, len(f.Names))
+			for _, n := range f.Bare() {
+				switch {
+				case f.Arg != "" && f.Optional:
+					n += "=-"
+				case f.Arg != "":
+					n += "="
+				}
+				names = append(names, "-"+n)
+			}
+			n := names[0]
+			if len(names) > 1 {
+				n = "{" + strings.Join(names, ",") + "}"
+			}
+
+			var arg string
+			if f.Arg != "" {
+				action := ""
+				switch {
+				case len(f.Values) > 0:
+					action = "(" + strings.Join(f.Values, " ") + ")"
+				case f.Kind == "file":
+					action = "_files"
+				case f.Kind == "dir":
+					action = "_files -/"
+				}
+				msg := f.Arg
+				if msg == ".." {
+					msg = f.Kind
+				}
+				arg = ":" + strings.ReplaceAll(desc.Replace(msg), ":", `\:`) + ":" + q(action)
+			}
+
+			b.WriteString("\t'")
+			if f.Repeat {
+				b.WriteByte('*')
+			}
+			if excl != "" {
+				b.WriteString("(" + excl + ")")
+			}
+			fmt.Fprintf(b, "'%s'[%s]%s'\n", n, desc.Replace(f.Short), arg)
 		}
 		fmt.Fprintf(b, "\n")
 	}
 
-	b.WriteString("\t'*:file:_files'\n")
+	switch kind, many := strings.CutSuffix(u.Args, "..."); {
+	case kind == "file" && many:
+		b.WriteString("\t'*:file:_files'\n")
+	case kind == "file":
+		b.WriteString("\t':file:_files'\n")
+	case kind == "dir" && many:
+		b.WriteString("\t'*:directory:_files -/'\n")
+	case kind == "dir":
+		b.WriteString("\t':directory:_files -/'\n")
+	}
 	b.WriteString(")\n\n_arguments -s -S : $arguments\n")
 	return b.String()
 }
-
-// TODO
-func (u Usage) CompleteBash() string {
-	b := new(strings.Builder)
-	return b.String()
-}
-
-// TODO
-func (u Usage) CompleteFish() string {
-	b := new(strings.Builder)
-	return b.String()
-}